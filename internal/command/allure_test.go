@@ -0,0 +1,62 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func initAllureTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestHttpTestCallableSteps(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 7}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	initAllureTestResource(t)
+
+	testcase := &config.TestCaseHttp{
+		ID:          1,
+		Tags:        []string{"smoke"},
+		Request:     config.RequestHttp{Method: "get", URL: server.URL + "/books/7"},
+		Export:      &config.Export{ExportTo: "BOOK_ID", Xpath: "//id"},
+		VerifyRules: []rule.VerifyRule{&rule.HttpStatusEqualRule{Expected: http.StatusCreated}},
+	}
+	callable := &HttpTestCallable{testcase: testcase, stateGroup: model.NewStateGroup(), vars: &sync.Map{}}
+	tcResult := callable.Call(context.Background()).Value.(HttpTestCaseResult)
+	assert.Equal(t, model.StateFailed, tcResult.State)
+
+	var names, statuses []string
+	for _, step := range tcResult.Steps {
+		names = append(names, step.Name)
+		statuses = append(statuses, step.Status)
+	}
+	assert.Equal(t, []string{util.StepRender, util.StepRequest, util.StepExport, util.StepVerify}, names)
+	assert.Equal(t, []string{"passed", "passed", "passed", "failed"}, statuses)
+	assert.Equal(t, "verify rule #1 failed, HttpStatusEqualRule expected:201, actual:200", tcResult.Steps[3].Error)
+	assert.Equal(t, &rule.Mismatch{Rule: "HttpStatusEqualRule", Expected: "201", Actual: "200"}, tcResult.Mismatch)
+
+	result := newHttpCaseResult("/rules/book.yml", tcResult)
+	assert.Len(t, result.Steps, 4)
+	assert.Contains(t, result.RequestDetail, "GET "+server.URL+"/books/7")
+	assert.Contains(t, result.ResponseDetail, "\"id\": 7")
+	assert.Equal(t, []string{"smoke"}, result.Tags)
+}
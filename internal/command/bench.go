@@ -0,0 +1,419 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+	slog "github.com/vearne/simplelog"
+)
+
+const BenchReportFile = "bench.json"
+
+var errBenchRuleFailed = errors.New("rules verify failed")
+
+// BenchCaseResult is the load test result of a testcase
+type BenchCaseResult struct {
+	Protocol    string  `json:"protocol"`
+	File        string  `json:"file"`
+	ID          uint64  `json:"id"`
+	Description string  `json:"description"`
+	Requests    int     `json:"requests"`
+	Errors      int     `json:"errors"`
+	ErrorRate   float64 `json:"error_rate"`
+	Throughput  float64 `json:"throughput"`
+	P50Ms       float64 `json:"p50_ms"`
+	P90Ms       float64 `json:"p90_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+	MaxMs       float64 `json:"max_ms"`
+}
+
+// BenchReport is the result of autotest bench
+type BenchReport struct {
+	StartTime   time.Time         `json:"start_time"`
+	DurationMs  int64             `json:"duration_ms"`
+	TargetRPS   int               `json:"target_rps,omitempty"`
+	Concurrency int               `json:"concurrency"`
+	Requests    int               `json:"requests"`
+	Errors      int               `json:"errors"`
+	ErrorRate   float64           `json:"error_rate"`
+	Throughput  float64           `json:"throughput"`
+	Cases       []BenchCaseResult `json:"cases"`
+}
+
+// benchTarget is a testcase exercised by autotest bench, exactly one of http and grpc is set
+type benchTarget struct {
+	filePath string
+	http     *config.TestCaseHttp
+	grpc     *config.TestCaseGrpc
+	vars     *sync.Map
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+}
+
+// RunBench runs the selected testcases at the target RPS or concurrency for a duration,
+// the requests are rendered and verified exactly like autotest run does.
+func RunBench(ctx context.Context, cmd *cli.Command) error {
+	confFilePath := cmd.String("config-file")
+	environment := cmd.String("environment")
+	duration := cmd.Duration("duration")
+	rps := cmd.Int("rps")
+	concurrency := cmd.Int("concurrency")
+	maxErrorRate := cmd.Float64("max-error-rate")
+	slog.Info("config-file:%v, environment:%v", confFilePath, environment)
+	slog.Info("duration:%v, rps:%v, concurrency:%v", duration, rps, concurrency)
+	if duration <= 0 || rps < 0 || concurrency <= 0 {
+		return cli.Exit("duration and concurrency must be positive, rps must not be negative",
+			model.ExitCodeConfigError)
+	}
+
+	err := initRun(confFilePath, environment, cmd.StringSlice("var"))
+	if err != nil {
+		return err
+	}
+
+	targets := selectBenchTargets(cmd.StringSlice("file"), cmd.IntSlice("id"))
+	if len(targets) <= 0 {
+		return cli.Exit("no testcase selected", model.ExitCodeConfigError)
+	}
+
+	teardown, err := setupTargets(ctx, targets)
+	defer teardown()
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeInfraError)
+	}
+
+	targets = slices.DeleteFunc(targets, func(target *benchTarget) bool {
+		return target.skipped()
+	})
+	if len(targets) <= 0 {
+		return cli.Exit("all the selected testcases are skipped", model.ExitCodeConfigError)
+	}
+
+	slog.Info("[start]bench, testcases:%v", len(targets))
+	begin := time.Now()
+	// no burst, the requests are sent at a steady rate from the start
+	runBench(ctx, targets, util.NewRateLimiterWithBurst(concurrency, rps, 1), concurrency, begin.Add(duration))
+	elapsed := time.Since(begin)
+	slog.Info("[end]bench, cost:%v", elapsed)
+
+	report := newBenchReport(targets, begin, elapsed, rps, concurrency)
+	printBenchReport(os.Stdout, report)
+	path := cmd.String("output")
+	if len(path) <= 0 {
+		path = filepath.Join(resource.GlobalConfig.Global.Report.DirPath, BenchReportFile)
+	}
+	err = writeBenchReport(path, report)
+	if err != nil {
+		slog.Error("Failed to write bench report: %v", err)
+	} else {
+		slog.Info("bench report:%v", path)
+	}
+
+	if ctx.Err() != nil {
+		return cli.Exit("bench cancelled", model.ExitCodeCancelled)
+	}
+	if report.ErrorRate > maxErrorRate {
+		return cli.Exit(fmt.Sprintf("error rate %.4f exceeds max error rate %.4f",
+			report.ErrorRate, maxErrorRate), model.ExitCodeTestFailed)
+	}
+	return nil
+}
+
+// setupTargets runs the global setup and the setup of the rule files of the targets.
+// The variables of the setups are visible to the testcases, variables exported by other testcases are not,
+// the testcases are not executed in order. teardown runs the teardowns of the setups which ran,
+// it must be called even if an error is returned.
+func setupTargets(ctx context.Context, targets []*benchTarget) (teardown func(), err error) {
+	teardownCtx := context.WithoutCancel(ctx)
+	var teardowns []func()
+	teardown = func() {
+		for i := len(teardowns) - 1; i >= 0; i-- {
+			teardowns[i]()
+		}
+	}
+
+	teardowns = append(teardowns, func() {
+		//nolint: errcheck
+		runHooks(teardownCtx, StageTeardown, resource.GlobalConfig.Teardown, &resource.CustomerVars)
+	})
+	err = runHooks(ctx, StageSetup, resource.GlobalConfig.Setup, &resource.CustomerVars)
+	if err != nil {
+		return teardown, err
+	}
+	fileVars := make(map[string]*sync.Map)
+	for _, target := range targets {
+		if _, ok := fileVars[target.filePath]; ok {
+			target.vars = fileVars[target.filePath]
+			continue
+		}
+		vars := copyVars(&resource.CustomerVars)
+		hooks := resource.FileHooks[target.filePath]
+		teardowns = append(teardowns, func() {
+			//nolint: errcheck
+			runHooks(teardownCtx, StageTeardown, hooks.Teardown, vars)
+		})
+		err = runHooks(ctx, StageSetup, hooks.Setup, vars)
+		if err != nil {
+			return teardown, err
+		}
+		fileVars[target.filePath] = vars
+		target.vars = vars
+	}
+	return teardown, nil
+}
+
+// selectBenchTargets selects the testcases of the rule files in files, matched by path or file name,
+// and with the IDs in ids, as written in the rule file. Empty files or ids select all.
+func selectBenchTargets(files []string, ids []int) []*benchTarget {
+	selected := func(filePath string, id uint64) bool {
+		if len(files) > 0 && !slices.ContainsFunc(files, func(f string) bool {
+			abs, _ := filepath.Abs(f)
+			return f == filepath.Base(filePath) || abs == filePath
+		}) {
+			return false
+		}
+		return len(ids) <= 0 || slices.Contains(ids, int(id))
+	}
+
+	var targets []*benchTarget
+	for _, filePath := range ruleFileOrder(resource.HttpTestCases, resource.GlobalConfig.HttpRuleFiles) {
+		for _, tc := range resource.HttpTestCases[filePath] {
+			if selected(filePath, tc.GetDeclaredID()) {
+				targets = append(targets, &benchTarget{filePath: filePath, http: tc})
+			}
+		}
+	}
+	for _, filePath := range ruleFileOrder(resource.GrpcTestCases, resource.GlobalConfig.GrpcRuleFiles) {
+		for _, tc := range resource.GrpcTestCases[filePath] {
+			if selected(filePath, tc.GetDeclaredID()) {
+				targets = append(targets, &benchTarget{filePath: filePath, grpc: tc})
+			}
+		}
+	}
+	return targets
+}
+
+// runBench sends the requests of the targets in turn until the deadline,
+// the limiter controls the RPS and the concurrency of all the requests
+func runBench(ctx context.Context, targets []*benchTarget, limiter *util.RateLimiter,
+	concurrency int, deadline time.Time) {
+	var counter atomic.Uint64
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil && time.Now().Before(deadline) {
+				target := targets[(counter.Add(1)-1)%uint64(len(targets))]
+				target.run(ctx, limiter)
+			}
+		}()
+	}
+	wg.Wait()
+	limiter.Stop()
+}
+
+func (t *benchTarget) protocol() string {
+	if t.http != nil {
+		return "http"
+	}
+	return "grpc"
+}
+
+func (t *benchTarget) skipped() bool {
+	var skip bool
+	var err error
+	if t.http != nil {
+		skip, _, err = shouldSkip(t.http.Skip, t.http.SkipIf, t.http.LuaSkipIf, t.vars, t.http.RowVars)
+	} else {
+		skip, _, err = shouldSkip(t.grpc.Skip, t.grpc.SkipIf, t.grpc.LuaSkipIf, t.vars, t.grpc.RowVars)
+	}
+	if err != nil {
+		slog.Warn("skip %v testcase, file:%v, id:%v, error:%v", t.protocol(), t.filePath, t.id(), err)
+		return true
+	}
+	if skip {
+		slog.Info("skip %v testcase, file:%v, id:%v", t.protocol(), t.filePath, t.id())
+	}
+	return skip
+}
+
+func (t *benchTarget) id() uint64 {
+	if t.http != nil {
+		return t.http.ID
+	}
+	return t.grpc.ID
+}
+
+func (t *benchTarget) desc() string {
+	if t.http != nil {
+		return t.http.Desc
+	}
+	return t.grpc.Desc
+}
+
+// requestOptions uses the limiter of the bench instead of the configured ones,
+// and does not retry, every attempt is a sample
+func (t *benchTarget) requestOptions(limiter *util.RateLimiter) requestOptions {
+	var opts requestOptions
+	if t.http != nil {
+		opts = newRequestOptions(t.http.RequestOptions)
+	} else {
+		opts = newRequestOptions(t.grpc.RequestOptions)
+	}
+	opts.limiter = limiter
+	opts.keyed = true
+	opts.retry.MaxAttempts = 1
+	return opts
+}
+
+// run sends one request and records its latency, the time spent in the limiter is not included
+func (t *benchTarget) run(ctx context.Context, limiter *util.RateLimiter) {
+	trace, err := t.send(ctx, t.requestOptions(limiter))
+	// the bench was interrupted, the request is not a sample
+	if ctx.Err() != nil {
+		return
+	}
+
+	var latency time.Duration
+	for _, attempt := range trace.Attempts {
+		latency += attempt.Duration
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latencies = append(t.latencies, latency)
+	if err != nil {
+		t.errors++
+	}
+}
+
+func (t *benchTarget) send(ctx context.Context, opts requestOptions) (RequestTrace, error) {
+	if t.http != nil {
+		req, err := renderRequestHttpWithVars(t.http.Request, t.vars, t.http.RowVars)
+		if err != nil {
+			return RequestTrace{}, err
+		}
+		out, trace, err := doHttpRequest(ctx, req, opts)
+		if err != nil {
+			return trace, err
+		}
+		for _, rule := range t.http.VerifyRules {
+			if !rule.Verify(out) {
+				return trace, errBenchRuleFailed
+			}
+		}
+		return trace, nil
+	}
+
+	req, err := renderRequestGrpcWithVars(t.grpc.Request, t.vars, t.grpc.RowVars)
+	if err != nil {
+		return RequestTrace{}, err
+	}
+	resp, trace, err := invokeGrpc(ctx, req, opts)
+	if err != nil {
+		return trace, err
+	}
+	for _, rule := range t.grpc.VerifyRules {
+		if !rule.Verify(resp) {
+			return trace, errBenchRuleFailed
+		}
+	}
+	return trace, nil
+}
+
+func newBenchReport(targets []*benchTarget, begin time.Time, elapsed time.Duration,
+	rps int, concurrency int) BenchReport {
+	report := BenchReport{
+		StartTime:   begin,
+		DurationMs:  elapsed.Milliseconds(),
+		TargetRPS:   rps,
+		Concurrency: concurrency,
+	}
+	for _, target := range targets {
+		target.mu.Lock()
+		latencies := slices.Clone(target.latencies)
+		errCount := target.errors
+		target.mu.Unlock()
+		slices.Sort(latencies)
+
+		result := BenchCaseResult{
+			Protocol:    target.protocol(),
+			File:        target.filePath,
+			ID:          target.id(),
+			Description: target.desc(),
+			Requests:    len(latencies),
+			Errors:      errCount,
+			ErrorRate:   ratio(errCount, len(latencies)),
+			Throughput:  float64(len(latencies)) / elapsed.Seconds(),
+			P50Ms:       milliseconds(percentile(latencies, 50)),
+			P90Ms:       milliseconds(percentile(latencies, 90)),
+			P99Ms:       milliseconds(percentile(latencies, 99)),
+			MaxMs:       milliseconds(percentile(latencies, 100)),
+		}
+		report.Cases = append(report.Cases, result)
+		report.Requests += result.Requests
+		report.Errors += result.Errors
+	}
+	report.ErrorRate = ratio(report.Errors, report.Requests)
+	report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	return report
+}
+
+// percentile uses the nearest-rank method, latencies must be sorted
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) <= 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(latencies))))
+	return latencies[min(max(rank, 1), len(latencies))-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d.Microseconds())) / 1000
+}
+
+func ratio(a, b int) float64 {
+	if b <= 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func printBenchReport(w io.Writer, report BenchReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tREQUESTS\tERRORS\tERROR RATE\tRPS\tP50(ms)\tP90(ms)\tP99(ms)\tMAX(ms)")
+	for _, c := range report.Cases {
+		fmt.Fprintf(tw, "%v:%v:%v\t%d\t%d\t%.2f%%\t%.1f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			c.Protocol, filepath.Base(c.File), c.ID, c.Requests, c.Errors, c.ErrorRate*100,
+			c.Throughput, c.P50Ms, c.P90Ms, c.P99Ms, c.MaxMs)
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%d\t%.2f%%\t%.1f\t\t\t\t\n",
+		report.Requests, report.Errors, report.ErrorRate*100, report.Throughput)
+	tw.Flush() //nolint: errcheck
+}
+
+func writeBenchReport(path string, report BenchReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
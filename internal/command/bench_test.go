@@ -0,0 +1,101 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(latencies, 50))
+	assert.Equal(t, 90*time.Millisecond, percentile(latencies, 90))
+	assert.Equal(t, 99*time.Millisecond, percentile(latencies, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(latencies, 100))
+	assert.Equal(t, time.Millisecond, percentile(latencies[:1], 99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+func TestSelectBenchTargets(t *testing.T) {
+	restoreResource(t)
+	resource.GlobalConfig.HttpRuleFiles = []string{"/rules/a.yml", "/rules/b.yml"}
+	resource.HttpTestCases = map[string][]*config.TestCaseHttp{
+		"/rules/a.yml": {{ID: 1}, {ID: 2}},
+		"/rules/b.yml": {{ID: 1}, {ID: 2001, ParentID: 2}, {ID: 2002, ParentID: 2}},
+	}
+	resource.GrpcTestCases = map[string][]*config.TestCaseGrpc{}
+
+	assert.Len(t, selectBenchTargets(nil, nil), 5)
+	assert.Len(t, selectBenchTargets([]string{"b.yml"}, nil), 3)
+	assert.Len(t, selectBenchTargets(nil, []int{1}), 2)
+	// the rows of a data-driven testcase are selected by its ID
+	targets := selectBenchTargets([]string{"/rules/b.yml"}, []int{2})
+	assert.Len(t, targets, 2)
+	assert.Equal(t, uint64(2001), targets[0].id())
+}
+
+func initBenchTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestRunBench(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	initBenchTestResource(t)
+
+	newTarget := func(id uint64, path string) *benchTarget {
+		return &benchTarget{
+			filePath: "/rules/a.yml",
+			vars:     &sync.Map{},
+			http: &config.TestCaseHttp{
+				ID:          id,
+				Request:     config.RequestHttp{Method: "get", URL: server.URL + path},
+				VerifyRules: []rule.VerifyRule{&rule.HttpStatusEqualRule{Expected: http.StatusOK}},
+			},
+		}
+	}
+	targets := []*benchTarget{newTarget(1, "/ok"), newTarget(2, "/fail")}
+
+	begin := time.Now()
+	runBench(context.Background(), targets, util.NewRateLimiterWithBurst(2, 20, 1), 2, begin.Add(time.Second))
+	report := newBenchReport(targets, begin, time.Since(begin), 20, 2)
+
+	// about 20 requests are sent in a second, in turn
+	assert.InDelta(t, 20, report.Requests, 5)
+	assert.InDelta(t, report.Cases[0].Requests, report.Cases[1].Requests, 1)
+	assert.Equal(t, 0, report.Cases[0].Errors)
+	assert.Equal(t, report.Cases[1].Requests, report.Cases[1].Errors)
+	assert.InDelta(t, 0.5, report.ErrorRate, 0.1)
+	assert.Greater(t, report.Cases[0].P50Ms, 0.0)
+	assert.LessOrEqual(t, report.Cases[0].P90Ms, report.Cases[0].P99Ms)
+
+	var buf bytes.Buffer
+	printBenchReport(&buf, report)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[1], "http:a.yml:1 "))
+	assert.True(t, strings.HasPrefix(lines[3], "TOTAL "))
+}
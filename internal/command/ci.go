@@ -0,0 +1,162 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+// Annotation modes of autotest run
+const (
+	AnnotationGithub = "github"
+	AnnotationGitlab = "gitlab"
+)
+
+// SummaryPrefix marks the machine-readable summary line printed at the end of a run
+const SummaryPrefix = "AUTOTEST_SUMMARY"
+
+// GitlabCodeQualityFile is written to the report directory in gitlab annotation mode
+const GitlabCodeQualityFile = "gl-code-quality-report.json"
+
+type Summary struct {
+	Total     int `json:"total"`
+	Passed    int `json:"passed"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+	Cancelled int `json:"cancelled,omitempty"`
+	Flaky     int `json:"flaky,omitempty"`
+	// the seed of --shuffle
+	Seed       int64  `json:"seed,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	ExitCode   int    `json:"exit_code"`
+	ReportDir  string `json:"report_dir"`
+}
+
+// exitCodeOf returns ExitCodeSuccess if the number of failed and flaky testcases does not exceed maxFailures,
+// ExitCodeInfraError if all the failures were caused by unreachable services or setup,
+// otherwise ExitCodeTestFailed. The quarantined testcases are not counted.
+func exitCodeOf(results *UnifiedTestResults, maxFailures int) int {
+	failures := results.FailedTests
+	for _, tc := range results.TestCases {
+		if tc.Status == util.StatusFailed && tc.Quarantined {
+			failures--
+		}
+		if tc.Status == util.StatusFlaky && !tc.Quarantined {
+			failures++
+		}
+	}
+	if failures <= maxFailures {
+		return model.ExitCodeSuccess
+	}
+	for _, tc := range results.TestCases {
+		if tc.Quarantined {
+			continue
+		}
+		if tc.Status == util.StatusFlaky ||
+			(tc.Status == util.StatusFailed && !isInfraFailure(tc.Reason)) {
+			return model.ExitCodeTestFailed
+		}
+	}
+	return model.ExitCodeInfraError
+}
+
+func isInfraFailure(reason string) bool {
+	return reason == model.ReasonRequestFailed.String() ||
+		reason == model.ReasonSetupFailed.String()
+}
+
+func printSummary(w io.Writer, summary Summary) {
+	b, _ := json.Marshal(summary)
+	fmt.Fprintf(w, "%v %s\n", SummaryPrefix, b)
+}
+
+// writeGithubAnnotations prints a GitHub Actions error annotation for each failed testcase
+func writeGithubAnnotations(w io.Writer, testCases []util.TestCaseResult) {
+	for _, tc := range testCases {
+		if tc.Status != util.StatusFailed {
+			continue
+		}
+		title := fmt.Sprintf("autotest %v testcase %v", tc.Protocol, tc.ID)
+		fmt.Fprintf(w, "::error file=%v,line=%v,title=%v::%v\n",
+			escapeGithubProperty(relPath(tc.File)), max(tc.Line, 1),
+			escapeGithubProperty(title), escapeGithubData(failureMessage(tc)))
+	}
+}
+
+type codeQualityIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"`
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
+
+// writeGitlabCodeQuality writes the failed testcases as a GitLab code quality report
+func writeGitlabCodeQuality(filePath string, testCases []util.TestCaseResult) error {
+	issues := make([]codeQualityIssue, 0)
+	for _, tc := range testCases {
+		if tc.Status != util.StatusFailed {
+			continue
+		}
+		var issue codeQualityIssue
+		issue.Description = fmt.Sprintf("%v testcase %v: %v", tc.Protocol, tc.ID, failureMessage(tc))
+		issue.CheckName = "autotest"
+		issue.Fingerprint = util.MD5(fmt.Sprintf("%v|%v|%v", tc.Protocol, tc.File, tc.ID))
+		issue.Severity = "major"
+		issue.Location.Path = relPath(tc.File)
+		issue.Location.Lines.Begin = max(tc.Line, 1)
+		issues = append(issues, issue)
+	}
+
+	b, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, b, 0644)
+}
+
+func failureMessage(tc util.TestCaseResult) string {
+	if len(tc.ErrorMsg) > 0 {
+		return fmt.Sprintf("%v: %v", tc.Description, tc.ErrorMsg)
+	}
+	return tc.Description
+}
+
+// relPath returns the path of the rule file recorded in the report relative to the working directory,
+// which is usually the repository root
+func relPath(path string) string {
+	path = resource.AbsRulePath(path)
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func escapeGithubData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+func escapeGithubProperty(s string) string {
+	s = escapeGithubData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	assertFailed := util.TestCaseResult{Status: util.StatusFailed, Reason: model.ReasonRuleVerifyFailed.String()}
+	requestFailed := util.TestCaseResult{Status: util.StatusFailed, Reason: model.ReasonRequestFailed.String()}
+	passed := util.TestCaseResult{Status: util.StatusPassed}
+
+	results := &UnifiedTestResults{TestCases: []util.TestCaseResult{passed}}
+	assert.Equal(t, model.ExitCodeSuccess, exitCodeOf(results, 0))
+
+	results = &UnifiedTestResults{FailedTests: 2,
+		TestCases: []util.TestCaseResult{passed, assertFailed, requestFailed}}
+	assert.Equal(t, model.ExitCodeTestFailed, exitCodeOf(results, 0))
+	assert.Equal(t, model.ExitCodeTestFailed, exitCodeOf(results, 1))
+	assert.Equal(t, model.ExitCodeSuccess, exitCodeOf(results, 2))
+
+	// only infrastructure failures
+	results = &UnifiedTestResults{FailedTests: 1,
+		TestCases: []util.TestCaseResult{passed, requestFailed}}
+	assert.Equal(t, model.ExitCodeInfraError, exitCodeOf(results, 0))
+
+	// flaky testcases fail the run, quarantined testcases don't
+	flaky := util.TestCaseResult{Status: util.StatusFlaky, Reason: model.ReasonFlaky.String()}
+	results = &UnifiedTestResults{FlakyTests: 1, TestCases: []util.TestCaseResult{passed, flaky}}
+	assert.Equal(t, model.ExitCodeTestFailed, exitCodeOf(results, 0))
+	assert.Equal(t, model.ExitCodeSuccess, exitCodeOf(results, 1))
+
+	quarantinedFailed := assertFailed
+	quarantinedFailed.Quarantined = true
+	flaky.Quarantined = true
+	results = &UnifiedTestResults{FailedTests: 1, FlakyTests: 1,
+		TestCases: []util.TestCaseResult{passed, quarantinedFailed, flaky}}
+	assert.Equal(t, model.ExitCodeSuccess, exitCodeOf(results, 0))
+}
+
+func TestWriteGithubAnnotations(t *testing.T) {
+	wd, _ := os.Getwd()
+	cases := []util.TestCaseResult{
+		{ID: 1, Protocol: "http", File: filepath.Join(wd, "rules", "a.yml"), Line: 12,
+			Status: util.StatusFailed, Description: "get book", ErrorMsg: "expected 1,\ngot 100%"},
+		{ID: 2, Protocol: "http", Status: util.StatusPassed},
+	}
+	var buf bytes.Buffer
+	writeGithubAnnotations(&buf, cases)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "::error file=rules/a.yml,line=12,title=autotest http testcase 1::"+
+		"get book: expected 1,%0Agot 100%25", lines[0])
+}
+
+func TestWriteGitlabCodeQuality(t *testing.T) {
+	path := filepath.Join(t.TempDir(), GitlabCodeQualityFile)
+	cases := []util.TestCaseResult{
+		{ID: 3, Protocol: "grpc", File: "/tmp/b.yml", Status: util.StatusFailed, Description: "say hello"},
+		{ID: 4, Protocol: "grpc", Status: util.StatusSkipped},
+	}
+	err := writeGitlabCodeQuality(path, cases)
+	assert.NoError(t, err)
+
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var issues []codeQualityIssue
+	assert.NoError(t, json.Unmarshal(b, &issues))
+	assert.Len(t, issues, 1)
+	assert.Equal(t, "/tmp/b.yml", issues[0].Location.Path)
+	assert.Equal(t, 1, issues[0].Location.Lines.Begin)
+	assert.Equal(t, "grpc testcase 3: say hello", issues[0].Description)
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"os"
+	"path/filepath"
 	"time"
 
-	"github.com/antchfx/jsonquery"
-	"github.com/antchfx/xpath"
 	"github.com/urfave/cli/v3"
+	"github.com/vearne/autotest/internal/model"
 	"github.com/vearne/autotest/internal/resource"
 	"github.com/vearne/autotest/internal/rule"
 	"github.com/vearne/autotest/internal/util"
@@ -25,10 +25,25 @@ var (
 
 // UnifiedTestResults 统一的测试结果
 type UnifiedTestResults struct {
-	TotalTests  int
-	PassedTests int
-	FailedTests int
+	TotalTests   int
+	PassedTests  int
+	FailedTests  int
+	SkippedTests int
+	// testcases interrupted by SIGINT or SIGTERM
+	CancelledTests int
+	// repeated testcases that passed only sometimes
+	FlakyTests  int
 	FailedCases []string
+	TestCases   []util.TestCaseResult
+}
+
+// maskResults masks the values of the secrets in the results,
+// all the secrets are known when the testcases have finished
+func maskResults(results *UnifiedTestResults) {
+	results.FailedCases = resource.SecretMasker.MaskStrings(results.FailedCases)
+	for i := range results.TestCases {
+		results.TestCases[i] = resource.SecretMasker.MaskTestCaseResult(results.TestCases[i])
+	}
 }
 
 // CombineResults 合并HTTP和gRPC测试结果
@@ -41,15 +56,22 @@ func CombineResults(httpResults, grpcResults *UnifiedTestResults) *UnifiedTestRe
 	}
 
 	combined := &UnifiedTestResults{
-		TotalTests:  httpResults.TotalTests + grpcResults.TotalTests,
-		PassedTests: httpResults.PassedTests + grpcResults.PassedTests,
-		FailedTests: httpResults.FailedTests + grpcResults.FailedTests,
+		TotalTests:     httpResults.TotalTests + grpcResults.TotalTests,
+		PassedTests:    httpResults.PassedTests + grpcResults.PassedTests,
+		FailedTests:    httpResults.FailedTests + grpcResults.FailedTests,
+		SkippedTests:   httpResults.SkippedTests + grpcResults.SkippedTests,
+		CancelledTests: httpResults.CancelledTests + grpcResults.CancelledTests,
+		FlakyTests:     httpResults.FlakyTests + grpcResults.FlakyTests,
 	}
 
 	// 合并失败用例
 	combined.FailedCases = append(combined.FailedCases, httpResults.FailedCases...)
 	combined.FailedCases = append(combined.FailedCases, grpcResults.FailedCases...)
 
+	// 合并用例详情
+	combined.TestCases = append(combined.TestCases, httpResults.TestCases...)
+	combined.TestCases = append(combined.TestCases, grpcResults.TestCases...)
+
 	return combined
 }
 
@@ -60,20 +82,138 @@ func RunTestCases(ctx context.Context, cmd *cli.Command) error {
 	environment := cmd.String("environment")
 	slog.Info("environment:%v", environment)
 
+	maxFailures := cmd.Int("max-failures")
+	annotations := cmd.String("annotations")
+	slog.Info("max-failures:%v, annotations:%v", maxFailures, annotations)
+	if len(annotations) > 0 && annotations != AnnotationGithub && annotations != AnnotationGitlab {
+		return cli.Exit(fmt.Sprintf("unknown annotations:%v, github | gitlab", annotations),
+			model.ExitCodeConfigError)
+	}
+
+	err := initRun(confFilePath, environment, cmd.StringSlice("var"))
+	if err != nil {
+		return err
+	}
+
+	// 4.4. repeat the testcases to detect the flaky ones, the quarantined testcases don't fail the run
+	err = applyRunOptions(cmd.Int("repeat"), cmd.String("quarantine"))
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
+	}
+
+	// 4.5. randomise the execution order, the seed is printed so that the order can be reproduced
+	var seed int64
+	if cmd.Bool("shuffle") {
+		seed = cmd.Int64("seed")
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		slog.Info("4.5. Shuffle test cases, seed:%v", seed)
+		shuffleTestCases(seed)
+	}
+
+	// 5. Initialize the executor and execute the testcase concurrently
+	// (if the execution fails, you may need to explain the reason for the failure)
+	slog.Info("5. Execute test cases")
+	startTime := time.Now()
+
+	// global setup, the exported variables are visible to all the rule files
+	// teardown must not be interrupted by the cancellation of the run
+	teardownCtx := context.WithoutCancel(ctx)
+	err = runHooks(ctx, StageSetup, resource.GlobalConfig.Setup, &resource.CustomerVars)
+	if err != nil {
+		//nolint: errcheck
+		runHooks(teardownCtx, StageTeardown, resource.GlobalConfig.Teardown, &resource.CustomerVars)
+		if ctx.Err() != nil {
+			return cli.Exit("run cancelled during global setup", model.ExitCodeCancelled)
+		}
+		return cli.Exit(err.Error(), model.ExitCodeInfraError)
+	}
+
+	// on SIGINT or SIGTERM, no more testcases are submitted and in-flight requests are cancelled
+	httpResults := HttpAutomateTest(ctx, resource.HttpTestCases)
+	grpcResults := GrpcAutomateTest(ctx, resource.GrpcTestCases)
+
+	// global teardown always runs, even if the run was terminated or cancelled
+	//nolint: errcheck
+	runHooks(teardownCtx, StageTeardown, resource.GlobalConfig.Teardown, &resource.CustomerVars)
+
+	endTime := time.Now()
+	totalDuration := endTime.Sub(startTime)
+
+	// 6. output cache statistics
+	slog.Info("6. Cache statistics")
+	outputCacheStats()
+
+	// 7. generate unified reports and send notifications
+	slog.Info("7. Generate reports and send notifications")
+	combinedResults := CombineResults(httpResults, grpcResults)
+	// the values of the secrets are masked in the reports, notifications and annotations
+	maskResults(combinedResults)
+	err = generateUnifiedReportsAndNotifications(combinedResults, startTime, endTime, totalDuration)
+	if err != nil {
+		slog.Error("Failed to generate reports or send notifications: %v", err)
+		// 不返回错误，因为测试已经完成，报告生成失败不应该影响整体结果
+	}
+
+	// 8. annotations for CI
+	switch annotations {
+	case AnnotationGithub:
+		writeGithubAnnotations(os.Stdout, combinedResults.TestCases)
+	case AnnotationGitlab:
+		path := filepath.Join(resource.GlobalConfig.Global.Report.DirPath, GitlabCodeQualityFile)
+		err = writeGitlabCodeQuality(path, combinedResults.TestCases)
+		if err != nil {
+			slog.Error("Failed to write code quality report: %v", err)
+		} else {
+			slog.Info("code quality report:%v", path)
+		}
+	}
+
+	// 9. summary and exit code
+	exitCode := exitCodeOf(combinedResults, maxFailures)
+	if ctx.Err() != nil {
+		exitCode = model.ExitCodeCancelled
+	}
+	printSummary(os.Stdout, Summary{
+		Total:      combinedResults.TotalTests,
+		Passed:     combinedResults.PassedTests,
+		Failed:     combinedResults.FailedTests,
+		Skipped:    combinedResults.SkippedTests,
+		Cancelled:  combinedResults.CancelledTests,
+		Flaky:      combinedResults.FlakyTests,
+		Seed:       seed,
+		DurationMs: totalDuration.Milliseconds(),
+		ExitCode:   exitCode,
+		ReportDir:  resource.GlobalConfig.Global.Report.DirPath,
+	})
+	if exitCode == model.ExitCodeCancelled {
+		return cli.Exit(fmt.Sprintf("run cancelled, %d testcases cancelled",
+			combinedResults.CancelledTests), exitCode)
+	}
+	if exitCode != model.ExitCodeSuccess {
+		return cli.Exit(fmt.Sprintf("%d testcases failed, %d testcases flaky, max failures:%d",
+			combinedResults.FailedTests, combinedResults.FlakyTests, maxFailures), exitCode)
+	}
+	return nil
+}
+
+// initRun parses and validates the config files, then initializes the resources and loads the variables
+func initRun(confFilePath string, environment string, vars []string) error {
 	// 1. Parsing configuration files
 	slog.Info("1. Parse config file")
 	// 1.1 config file
 	err := resource.ParseConfigFile(confFilePath)
 	if err != nil {
 		slog.Error("config file parse error, %v", err)
-		return err
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
 	}
 	// 2. validate config
 	slog.Info("2. validate config file")
 	err = AllCheck()
 	if err != nil {
 		slog.Error("validate config file, error:%v", err)
-		return err
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
 	}
 
 	// 2.5. Initialize Lua VM with preloaded files
@@ -81,7 +221,7 @@ func RunTestCases(ctx context.Context, cmd *cli.Command) error {
 	err = resource.InitLuaVM()
 	if err != nil {
 		slog.Error("initialize Lua VM failed, error:%v", err)
-		return err
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
 	}
 
 	// 3. initialize logger & RestyClient & RetryClient & Cache & RateLimiter & EnvironmentManager & ReportGenerator & NotificationService
@@ -97,37 +237,33 @@ func RunTestCases(ctx context.Context, cmd *cli.Command) error {
 	resource.InitReportGenerator()
 	resource.InitNotificationService()
 
+	return loadVars(environment, vars)
+}
+
+// loadVars loads the variables, the later sources override the earlier ones:
+// the base environments, the environment, its env_file, the secrets and --var
+func loadVars(environment string, vars []string) error {
 	// 4. Load specified environment
 	slog.Info("4. Load environment configuration")
-	err = resource.LoadEnvironment(environment)
+	err := resource.LoadEnvironment(environment)
 	if err != nil {
 		slog.Error("failed to load environment '%s': %v", environment, err)
-		return err
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
 	}
 
-	// 5. Initialize the executor and execute the testcase concurrently
-	// (if the execution fails, you may need to explain the reason for the failure)
-	slog.Info("5. Execute test cases")
-	startTime := time.Now()
-
-	httpResults := HttpAutomateTest(resource.HttpTestCases)
-	grpcResults := GrpcAutomateTest(resource.GrpcTestCases)
-
-	endTime := time.Now()
-	totalDuration := endTime.Sub(startTime)
-
-	// 6. output cache statistics
-	slog.Info("6. Cache statistics")
-	outputCacheStats()
-
-	// 7. generate unified reports and send notifications
-	slog.Info("7. Generate reports and send notifications")
-	err = generateUnifiedReportsAndNotifications(httpResults, grpcResults, startTime, endTime, totalDuration)
+	// 4.1. Load the secrets, their values are masked in logs and reports
+	err = resource.LoadSecrets()
 	if err != nil {
-		slog.Error("Failed to generate reports or send notifications: %v", err)
-		// 不返回错误，因为测试已经完成，报告生成失败不应该影响整体结果
+		slog.Error("failed to load secrets: %v", err)
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
 	}
 
+	// 4.2. --var overrides the variables of every other source
+	err = resource.SetVars(vars)
+	if err != nil {
+		slog.Error("failed to set variables: %v", err)
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
+	}
 	return nil
 }
 
@@ -140,7 +276,7 @@ func ValidateConfig(ctx context.Context, cmd *cli.Command) error {
 	err := resource.ParseConfigFile(filePath)
 	if err != nil {
 		slog.Error("config file parse error, %v", err)
-		return err
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
 	}
 
 	slog.Info("=== validate config file ===")
@@ -149,15 +285,50 @@ func ValidateConfig(ctx context.Context, cmd *cli.Command) error {
 		slog.Info("Validating Lua preload files...")
 		if err := resource.ValidateLuaFiles(); err != nil {
 			slog.Error("Lua file validation failed: %v", err)
-			return err
+			return cli.Exit(err.Error(), model.ExitCodeConfigError)
 		}
 	}
 
-	return AllCheck()
+	err = AllCheck()
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
+	}
+	return nil
 }
 
 func AllCheck() error {
 	var err error
+	err = CheckHooks()
+	if err != nil {
+		return err
+	}
+
+	retry := resource.GlobalConfig.Global.Retry
+	err = ValidateRetry(retry.Backoff, retry.Jitter, retry.RetryOnGrpcCodes)
+	if err != nil {
+		return fmt.Errorf("global retry error, %w", err)
+	}
+
+	err = ValidateRateLimitKeys(resource.GlobalConfig.Global.Concurrency.Keys)
+	if err != nil {
+		return fmt.Errorf("global concurrency error, %w", err)
+	}
+
+	err = ValidateNotifierChannels(resource.GlobalConfig.Global.Notifications.Channels)
+	if err != nil {
+		return fmt.Errorf("global notifications error, %w", err)
+	}
+
+	err = ValidateSecrets(resource.GlobalConfig.Secrets)
+	if err != nil {
+		return fmt.Errorf("secrets error, %w", err)
+	}
+
+	err = ValidateEnvironments(resource.GlobalConfig.Environments)
+	if err != nil {
+		return fmt.Errorf("environments error, %w", err)
+	}
+
 	err = CheckTestCaseHttp()
 	if err != nil {
 		return err
@@ -171,6 +342,33 @@ func AllCheck() error {
 	return nil
 }
 
+func CheckHooks() error {
+	slog.Info("CheckHooks")
+
+	err := ValidateHooks(StageSetup, resource.GlobalConfig.Setup)
+	if err != nil {
+		return err
+	}
+	err = ValidateHooks(StageTeardown, resource.GlobalConfig.Teardown)
+	if err != nil {
+		return err
+	}
+
+	for filePath, hooks := range resource.FileHooks {
+		err = ValidateHooks(StageSetup, hooks.Setup)
+		if err != nil {
+			slog.Error("filePath:%v, %v", filePath, err)
+			return err
+		}
+		err = ValidateHooks(StageTeardown, hooks.Teardown)
+		if err != nil {
+			slog.Error("filePath:%v, %v", filePath, err)
+			return err
+		}
+	}
+	return nil
+}
+
 func CheckTestCaseHttp() error {
 	slog.Info("CheckTestCaseHttp")
 
@@ -189,36 +387,59 @@ func CheckTestCaseHttp() error {
 				switch r.Name() {
 				case "HttpBodyEqualRule":
 					rule := r.(*rule.HttpBodyEqualRule)
-					_, err := xpath.Compile(rule.Xpath)
+					err := ValidateQuery(tc.ID, rule.Query())
 					if err != nil {
-						slog.Error("rule error, testCaseId:%v, xpath:%v", tc.ID, rule.Xpath)
 						return err
 					}
 				case "HttpBodyAtLeastOneRule":
 					rule := r.(*rule.HttpBodyAtLeastOneRule)
-					_, err := xpath.Compile(rule.Xpath)
+					err := ValidateQuery(tc.ID, rule.Query())
 					if err != nil {
-						slog.Error("rule error, testCaseId:%v, xpath:%v", tc.ID, rule.Xpath)
 						return err
 					}
 				default:
 					slog.Debug("ignore rule:%v", r.Name())
 				}
 			}
+
+			// 1.3 skip condition
+			err := ValidateSkipIf(tc.ID, tc.SkipIf, tc.LuaSkipIf)
+			if err != nil {
+				return err
+			}
+
+			// 1.4 export
+			if tc.Export != nil {
+				err := ValidateQuery(tc.ID, tc.Export.Query())
+				if err != nil {
+					return err
+				}
+				err = ValidateExportType(tc.ID, tc.Export.Type)
+				if err != nil {
+					return err
+				}
+			}
+
+			// 1.5 timeout, retry and rate limiter
+			err = ValidateRequestOptions(tc.ID, tc.RequestOptions, resource.GlobalConfig.Global.Concurrency.Keys)
+			if err != nil {
+				return err
+			}
+
+			// 1.6 repeat
+			if tc.Repeat < 0 {
+				return fmt.Errorf("repeat must not be negative, testCaseId:%v", tc.ID)
+			}
 		}
 	}
 
 	slog.Info("2. check if ID is duplicate")
 	for filePath, testcases := range resource.HttpTestCases {
 		slog.Info("filePath:%v, len(testcases):%v", filePath, len(testcases))
-		exist := make(map[uint64]struct{})
-		for _, tc := range testcases {
-			_, ok := exist[tc.ID]
-			if ok {
-				slog.Error("filePath:%v, ID [%v] is duplicate", filePath, tc.ID)
-				return ErrorIDduplicate
-			}
-			exist[tc.ID] = struct{}{}
+		err := checkDuplicateIDs(filePath, testcases)
+		if err != nil {
+			slog.Error("%v", err)
+			return err
 		}
 	}
 	slog.Info("3. check dependencies")
@@ -226,7 +447,7 @@ func CheckTestCaseHttp() error {
 		slog.Info("filePath:%v, len(testcases):%v", filePath, len(testcases))
 		exist := make(map[uint64]struct{})
 		for _, tc := range testcases {
-			exist[tc.ID] = struct{}{}
+			exist[tc.GetDeclaredID()] = struct{}{}
 		}
 		for _, tc := range testcases {
 			for _, dID := range tc.DependOnIDs {
@@ -235,7 +456,7 @@ func CheckTestCaseHttp() error {
 						tc.ID, dID)
 					return ErrorDependencyNotExist
 				}
-				if dID >= tc.ID {
+				if dID >= tc.GetDeclaredID() {
 					slog.Error("The ID of the dependent testcase must be smaller "+
 						"than the ID of the current testcase, testcase:%v, dependent testcase:%v",
 						tc.ID, dID)
@@ -247,6 +468,39 @@ func CheckTestCaseHttp() error {
 	return nil
 }
 
+// checkDuplicateIDs checks the IDs of the testcases of a rule file. The testcases expanded from
+// a data-driven testcase have the IDs id*1000+row, the error names the row using a duplicate ID.
+func checkDuplicateIDs[T interface {
+	GetID() uint64
+	GetDeclaredID() uint64
+}](filePath string, testcases []T) error {
+	// ID -> declared ID
+	exist := make(map[uint64]uint64)
+	for _, tc := range testcases {
+		id := tc.GetID()
+		if declared, ok := exist[id]; ok {
+			for _, parent := range []uint64{declared, tc.GetDeclaredID()} {
+				if parent != id {
+					return fmt.Errorf("%w, filePath:%v, ID [%v] is also the ID of row %v of the data-driven testcase %v",
+						ErrorIDduplicate, filePath, id, id-resource.DerivedID(parent, 0), parent)
+				}
+			}
+			return fmt.Errorf("%w, filePath:%v, ID [%v] is duplicate", ErrorIDduplicate, filePath, id)
+		}
+		exist[id] = tc.GetDeclaredID()
+	}
+	// the ID of a data-driven testcase is still referenced by dependOnIDs
+	for _, tc := range testcases {
+		if parent := tc.GetDeclaredID(); parent != tc.GetID() {
+			if _, ok := exist[parent]; ok {
+				return fmt.Errorf("%w, filePath:%v, ID [%v] is used by a data-driven testcase and another testcase",
+					ErrorIDduplicate, filePath, parent)
+			}
+		}
+	}
+	return nil
+}
+
 func CheckTestCaseGrpc() error {
 	slog.Info("CheckTestCaseGrpc")
 
@@ -265,36 +519,61 @@ func CheckTestCaseGrpc() error {
 				switch r.Name() {
 				case "GrpcBodyEqualRule":
 					rule := r.(*rule.GrpcBodyEqualRule)
-					_, err := xpath.Compile(rule.Xpath)
+					err := ValidateQuery(tc.ID, rule.Query())
 					if err != nil {
-						slog.Error("rule error, testCaseId:%v, xpath:%v", tc.ID, rule.Xpath)
 						return err
 					}
 				case "GrpcBodyAtLeastOneRule":
 					rule := r.(*rule.GrpcBodyAtLeastOneRule)
-					_, err := xpath.Compile(rule.Xpath)
+					err := ValidateQuery(tc.ID, rule.Query())
 					if err != nil {
-						slog.Error("rule error, testCaseId:%v, xpath:%v", tc.ID, rule.Xpath)
 						return err
 					}
 				default:
 					slog.Debug("ignore rule:%v", r.Name())
 				}
 			}
+
+			// 1.3 skip condition
+			err := ValidateSkipIf(tc.ID, tc.SkipIf, tc.LuaSkipIf)
+			if err != nil {
+				return err
+			}
+
+			// 1.4 export
+			if tc.Export != nil {
+				q := tc.Export.Query()
+				q.Format = rule.FormatJSON
+				err := ValidateQuery(tc.ID, q)
+				if err != nil {
+					return err
+				}
+				err = ValidateExportType(tc.ID, tc.Export.Type)
+				if err != nil {
+					return err
+				}
+			}
+
+			// 1.5 timeout, retry and rate limiter
+			err = ValidateRequestOptions(tc.ID, tc.RequestOptions, resource.GlobalConfig.Global.Concurrency.Keys)
+			if err != nil {
+				return err
+			}
+
+			// 1.6 repeat
+			if tc.Repeat < 0 {
+				return fmt.Errorf("repeat must not be negative, testCaseId:%v", tc.ID)
+			}
 		}
 	}
 
 	slog.Info("2. check if ID is duplicate")
 	for filePath, testcases := range resource.GrpcTestCases {
 		slog.Info("filePath:%v, len(testcases):%v", filePath, len(testcases))
-		exist := make(map[uint64]struct{})
-		for _, tc := range testcases {
-			_, ok := exist[tc.ID]
-			if ok {
-				slog.Error("filePath:%v, ID [%v] is duplicate", filePath, tc.ID)
-				return ErrorIDduplicate
-			}
-			exist[tc.ID] = struct{}{}
+		err := checkDuplicateIDs(filePath, testcases)
+		if err != nil {
+			slog.Error("%v", err)
+			return err
 		}
 	}
 	slog.Info("3. check dependencies")
@@ -302,7 +581,7 @@ func CheckTestCaseGrpc() error {
 		slog.Info("filePath:%v, len(testcases):%v", filePath, len(testcases))
 		exist := make(map[uint64]struct{})
 		for _, tc := range testcases {
-			exist[tc.ID] = struct{}{}
+			exist[tc.GetDeclaredID()] = struct{}{}
 		}
 		for _, tc := range testcases {
 			for _, dID := range tc.DependOnIDs {
@@ -311,7 +590,7 @@ func CheckTestCaseGrpc() error {
 						tc.ID, dID)
 					return ErrorDependencyNotExist
 				}
-				if dID >= tc.ID {
+				if dID >= tc.GetDeclaredID() {
 					slog.Error("The ID of the dependent testcase must be smaller "+
 						"than the ID of the current testcase, testcase:%v, dependent testcase:%v",
 						tc.ID, dID)
@@ -329,25 +608,39 @@ func ExtractXpath(ctx context.Context, cmd *cli.Command) error {
 	xpathStr := cmd.String("xpath")
 	slog.Info("xpathStr:%v", xpathStr)
 
-	jsonStr := cmd.String("json")
-	slog.Info("jsonStr:%v", jsonStr)
+	jsonPath := cmd.String("jsonpath")
+	jmesPath := cmd.String("jmespath")
+	slog.Info("jsonpath:%v, jmespath:%v", jsonPath, jmesPath)
 
-	_, err := xpath.Compile(xpathStr)
+	body := cmd.String("body")
+	if len(body) <= 0 {
+		body = cmd.String("json")
+	}
+	slog.Info("body:%v", body)
+
+	format, err := rule.NormalizeFormat(cmd.String("format"))
 	if err != nil {
-		slog.Error("xpath syntax error")
+		slog.Error("format error, %v", err)
 		return nil
 	}
+	if len(format) <= 0 {
+		format = rule.FormatJSON
+	}
 
-	doc, err := jsonquery.Parse(strings.NewReader(jsonStr))
+	q := rule.Query{Format: format, Xpath: xpathStr, JSONPath: jsonPath, JMESPath: jmesPath}
+	err = ValidateQuery(0, q)
 	if err != nil {
-		slog.Error("jsonStr format error")
+		slog.Error("expression syntax error")
 		return nil
 	}
-	nodes := jsonquery.Find(doc, xpathStr)
-	for idx, node := range nodes {
-		if node != nil {
-			slog.Info("[%v] = %v", idx, node.Value())
-		}
+
+	values, err := rule.FindAll(body, q)
+	if err != nil {
+		slog.Error("body format error, format:%v, %v", format, err)
+		return nil
+	}
+	for idx, value := range values {
+		slog.Info("[%v] = %v", idx, value)
 	}
 	return nil
 }
@@ -373,10 +666,7 @@ func outputCacheStats() {
 }
 
 // generateUnifiedReportsAndNotifications 生成统一报告并发送通知
-func generateUnifiedReportsAndNotifications(httpResults, grpcResults *UnifiedTestResults, startTime, endTime time.Time, totalDuration time.Duration) error {
-	// 合并测试结果
-	combinedResults := CombineResults(httpResults, grpcResults)
-
+func generateUnifiedReportsAndNotifications(combinedResults *UnifiedTestResults, startTime, endTime time.Time, totalDuration time.Duration) error {
 	if combinedResults.TotalTests == 0 {
 		slog.Info("No test cases to report")
 		return nil
@@ -387,28 +677,20 @@ func generateUnifiedReportsAndNotifications(httpResults, grpcResults *UnifiedTes
 	reportData.Summary.TotalTests = combinedResults.TotalTests
 	reportData.Summary.PassedTests = combinedResults.PassedTests
 	reportData.Summary.FailedTests = combinedResults.FailedTests
-	reportData.Summary.SkippedTests = 0 // 当前架构没有跳过的测试
+	reportData.Summary.SkippedTests = combinedResults.SkippedTests
+	reportData.Summary.CancelledTests = combinedResults.CancelledTests
+	reportData.Summary.FlakyTests = combinedResults.FlakyTests
 	reportData.Summary.Duration = totalDuration
 	reportData.Summary.StartTime = startTime
 	reportData.Summary.EndTime = endTime
 
-	if combinedResults.TotalTests > 0 {
-		reportData.Summary.PassRate = float64(combinedResults.PassedTests) / float64(combinedResults.TotalTests) * 100
+	// 跳过和取消的用例不计入通过率
+	executed := combinedResults.TotalTests - combinedResults.SkippedTests - combinedResults.CancelledTests
+	if executed > 0 {
+		reportData.Summary.PassRate = float64(combinedResults.PassedTests) / float64(executed) * 100
 	}
 
-	// 转换测试用例详情（这里简化处理，实际项目中可能需要更详细的信息）
-	for i, failedCase := range combinedResults.FailedCases {
-		testCaseResult := util.TestCaseResult{
-			ID:          uint64(i + 1),
-			Description: failedCase,
-			Status:      "failed",
-			Duration:    time.Second, // 简化处理
-			StartTime:   startTime,
-			EndTime:     endTime,
-			ErrorMsg:    "Test case failed", // 简化处理
-		}
-		reportData.TestCases = append(reportData.TestCases, testCaseResult)
-	}
+	reportData.TestCases = combinedResults.TestCases
 
 	// 生成报告
 	if resource.ReportGenerator != nil {
@@ -423,16 +705,25 @@ func generateUnifiedReportsAndNotifications(httpResults, grpcResults *UnifiedTes
 		slog.Warn("ReportGenerator not initialized, skipping report generation")
 	}
 
+	// 记录历史结果并更新趋势页面
+	err := recordHistory(reportData)
+	if err != nil {
+		slog.Error("Failed to record history: %v", err)
+	}
+
 	// 发送通知
 	if resource.NotificationService != nil {
 		notificationResult := util.TestResult{
-			TotalTests:  combinedResults.TotalTests,
-			PassedTests: combinedResults.PassedTests,
-			FailedTests: combinedResults.FailedTests,
-			Duration:    totalDuration,
-			StartTime:   startTime,
-			EndTime:     endTime,
-			FailedCases: combinedResults.FailedCases,
+			TotalTests:     combinedResults.TotalTests,
+			PassedTests:    combinedResults.PassedTests,
+			FailedTests:    combinedResults.FailedTests,
+			SkippedTests:   combinedResults.SkippedTests,
+			CancelledTests: combinedResults.CancelledTests,
+			FlakyTests:     combinedResults.FlakyTests,
+			Duration:       totalDuration,
+			StartTime:      startTime,
+			EndTime:        endTime,
+			FailedCases:    combinedResults.FailedCases,
 		}
 
 		err := resource.NotificationService.SendTestResult(notificationResult)
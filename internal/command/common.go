@@ -2,15 +2,24 @@ package command
 
 import (
 	"embed"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/antchfx/jsonquery"
 	"github.com/flosch/pongo2/v6"
 	"github.com/spf13/cast"
 	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/luavm"
+	"github.com/vearne/autotest/internal/model"
 	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
 )
 
 //go:embed template/*.tpl
@@ -20,6 +29,26 @@ type ResultInfo struct {
 	Total        int
 	SuccessCount int
 	FailedCount  int
+	SkippedCount int
+	// testcases interrupted by SIGINT or SIGTERM
+	CancelledCount int
+	// repeated testcases that passed only sometimes
+	FlakyCount int
+}
+
+// unifiedHTMLReportLink the link of report.html from the pages of testcases,
+// empty if the unified html report is not generated
+func unifiedHTMLReportLink() string {
+	formats := resource.GlobalConfig.Global.Report.Formats
+	if len(formats) == 0 {
+		return "../report.html"
+	}
+	for _, format := range formats {
+		if strings.EqualFold(format, "html") {
+			return "../report.html"
+		}
+	}
+	return ""
 }
 
 type CaseShow struct {
@@ -30,13 +59,23 @@ type CaseShow struct {
 	Link        string
 }
 
-func templateRenderWithVars(tplStr string, vars *sync.Map) (string, error) {
+// templateRenderWithVars renders the template with the environment variables,
+// the exported variables and the row variables of a data-driven testcase.
+func templateRenderWithVars(tplStr string, vars *sync.Map, rowVars map[string]any) (string, error) {
 	// Compile the template first (i. e. creating the AST)
 	tpl, err := pongo2.FromString(tplStr)
 	if err != nil {
 		return "", err
 	}
 
+	// Now you can render the template with the given
+	// pongo2.Context how often you want to.
+	return tpl.Execute(pongo2.Context(collectVars(vars, rowVars)))
+}
+
+// collectVars merges the variables visible to a testcase,
+// row variables override exported variables, which override environment variables.
+func collectVars(vars *sync.Map, rowVars map[string]any) map[string]any {
 	kvs := make(map[string]any)
 	for key, value := range resource.EnvVars {
 		kvs[key] = value
@@ -49,28 +88,398 @@ func templateRenderWithVars(tplStr string, vars *sync.Map) (string, error) {
 		})
 	}
 
-	// Now you can render the template with the given
-	// pongo2.Context how often you want to.
-	return tpl.Execute(pongo2.Context(kvs))
+	for key, value := range rowVars {
+		kvs[key] = value
+	}
+	return kvs
+}
+
+// skipCondition turns a skipIf expression into a template,
+// a plain expression such as "ENV == 'dev'" is wrapped into an if tag.
+func skipCondition(expr string) string {
+	if strings.Contains(expr, "{{") || strings.Contains(expr, "{%") {
+		return expr
+	}
+	return "{% if " + expr + " %}true{% endif %}"
 }
 
-func exportTo(jsonStr string, export *config.Export) (any, error) {
-	doc, err := jsonquery.Parse(strings.NewReader(jsonStr))
+// shouldSkip evaluates skip, skipIf and luaSkipIf of a testcase
+func shouldSkip(skip bool, skipIf string, luaSkipIf string,
+	vars *sync.Map, rowVars map[string]any) (bool, model.Reason, error) {
+	if skip {
+		return true, model.ReasonSkipped, nil
+	}
+
+	if len(skipIf) > 0 {
+		result, err := templateRenderWithVars(skipCondition(skipIf), vars, rowVars)
+		if err != nil {
+			return false, model.ReasonSkipConditionError, err
+		}
+		switch strings.ToLower(strings.TrimSpace(result)) {
+		case "true", "yes", "1":
+			return true, model.ReasonSkipConditionMet, nil
+		}
+	}
+
+	if len(luaSkipIf) > 0 {
+		globals := make(map[string]lua.LValue)
+		for key, value := range collectVars(vars, rowVars) {
+			globals[key] = toLuaValue(value)
+		}
+		source := luaSkipIf +
+			`
+
+		return skip();
+	`
+		value, err := luavm.ExecuteLuaWithGlobalsPool(nil, globals, source)
+		if err != nil {
+			return false, model.ReasonSkipConditionError, err
+		}
+		if lua.LVAsBool(value) {
+			return true, model.ReasonSkipConditionMet, nil
+		}
+	}
+	return false, model.ReasonSuccess, nil
+}
+
+// requestOptions are the timeout, retry policy and rate limiter of a request
+type requestOptions struct {
+	timeout time.Duration
+	retry   util.RetryPolicy
+	limiter *util.RateLimiter
+	// the limiter is selected by rateLimitKey, the target of the request does not change it
+	keyed bool
+	// records every attempt of the request in the HAR file when set
+	har     *util.HarRecorder
+	harCase util.HarCase
+}
+
+// RequestTrace records how a request was sent, it shows up in the timing of the testcase
+type RequestTrace struct {
+	// every attempt of the request, including the retries
+	Attempts []util.RetryAttempt
+	// time spent waiting for the rate limiter
+	LimiterWait time.Duration
+}
+
+// newCaseStep records a step of a run of the testcase which started at start
+func newCaseStep(name string, start time.Time, err error) util.CaseStep {
+	step := util.CaseStep{Name: name, Status: util.StatusPassed, StartTime: start, EndTime: time.Now()}
+	if err != nil {
+		step.Status = util.StatusFailed
+		step.Error = err.Error()
+	}
+	return step
+}
+
+// newRequestOptions merges the options of a testcase, which already inherited
+// the options of its rule file, over the global settings
+func newRequestOptions(opts config.RequestOptions) requestOptions {
+	result := requestOptions{
+		timeout: resource.GlobalConfig.Global.RequestTimeout,
+		retry:   util.NewRetryPolicy(resource.GlobalConfig).Merge(opts.Retry),
+		limiter: resource.RateLimiter,
+	}
+	if opts.Timeout > 0 {
+		result.timeout = opts.Timeout
+	}
+	if limiter, ok := resource.KeyedRateLimiters[opts.RateLimitKey]; ok {
+		result.limiter = limiter
+		result.keyed = true
+	}
+	return result
+}
+
+// limiterFor returns the rate limiter of the target, the URL or the gRPC address of the request,
+// a key whose pattern matches the target wins over the per-host limiter, which wins over the global one
+func (o requestOptions) limiterFor(target string) *util.RateLimiter {
+	if !o.keyed {
+		if limiter := resource.TargetRateLimiters.Get(target); limiter != nil {
+			return limiter
+		}
+	}
+	return o.limiter
+}
+
+// newTestCaseResult converts the result of a testcase for the unified reports
+func newTestCaseResult(protocol string, filePath string, line int, id uint64, desc string,
+	state model.State, reason model.Reason, err error, start, end time.Time,
+	trace RequestTrace) util.TestCaseResult {
+	result := util.TestCaseResult{
+		ID:          id,
+		Description: desc,
+		Protocol:    protocol,
+		File:        resource.RelRulePath(filePath),
+		Line:        line,
+		StartTime:   start,
+		EndTime:     end,
+		LimiterWait: trace.LimiterWait,
+	}
+	// only the retried requests are recorded, they show the flaky testcases
+	if len(trace.Attempts) > 1 {
+		result.Attempts = trace.Attempts
+	}
+	if !start.IsZero() && !end.IsZero() {
+		result.Duration = end.Sub(start)
+	}
+
+	switch state {
+	case model.StateSuccessFul:
+		result.Status = util.StatusPassed
+	case model.StateSkipped:
+		result.Status = util.StatusSkipped
+		result.Reason = reason.String()
+	case model.StateCancelled:
+		result.Status = util.StatusCancelled
+		result.Reason = reason.String()
+	case model.StateFlaky:
+		result.Status = util.StatusFlaky
+		result.Reason = reason.String()
+		result.ErrorMsg = reason.String()
+		if err != nil {
+			result.ErrorMsg = err.Error()
+		}
+	default:
+		result.Status = util.StatusFailed
+		result.Reason = reason.String()
+		result.ErrorMsg = reason.String()
+		if err != nil {
+			result.ErrorMsg = fmt.Sprintf("%v: %v", reason, err)
+		}
+	}
+	return result
+}
+
+// toLuaValue converts a variable to a Lua value, objects and arrays become tables
+func toLuaValue(value any) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case map[string]any:
+		table := &lua.LTable{Metatable: lua.LNil}
+		for key, item := range v {
+			table.RawSetString(key, toLuaValue(item))
+		}
+		return table
+	case []any:
+		table := &lua.LTable{Metatable: lua.LNil}
+		for _, item := range v {
+			table.Append(toLuaValue(item))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprintf("%v", v))
+	}
+}
+
+// fromLuaValue converts a Lua value to a variable,
+// a table with only the array part becomes an array, other tables become objects.
+// Integral numbers become int like the exported values.
+func fromLuaValue(value lua.LValue) any {
+	return normalizeNumbers(luaToGo(value))
+}
+
+func luaToGo(value lua.LValue) any {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return float64(v)
+	case lua.LBool:
+		return bool(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == v.Len() {
+			var keys int
+			v.ForEach(func(lua.LValue, lua.LValue) { keys++ })
+			if keys == n {
+				list := make([]any, 0, n)
+				for i := 1; i <= n; i++ {
+					list = append(list, luaToGo(v.RawGetInt(i)))
+				}
+				return list
+			}
+		}
+		m := make(map[string]any)
+		v.ForEach(func(key, item lua.LValue) {
+			m[key.String()] = luaToGo(item)
+		})
+		return m
+	default:
+		return value.String()
+	}
+}
+
+// flakyError describes a repeated testcase that passed only sometimes
+func flakyError(passed, runs int, reason model.Reason, err error) error {
+	if err != nil {
+		return fmt.Errorf("passed %d of %d runs, last failure %v: %w", passed, runs, reason, err)
+	}
+	return fmt.Errorf("passed %d of %d runs, last failure %v", passed, runs, reason)
+}
+
+// copyVars copies the variables, so that a rule file executed in parallel
+// can see the variables exported by the global setup.
+func copyVars(src *sync.Map) *sync.Map {
+	dst := &sync.Map{}
+	src.Range(func(key, value any) bool {
+		dst.Store(key, value)
+		return true
+	})
+	return dst
+}
+
+// exportTo extracts the exported variable from the body,
+// format is the body format detected from the response.
+func exportTo(body string, format string, export *config.Export) (any, error) {
+	q := export.Query()
+	if len(q.Format) <= 0 {
+		q.Format = format
+	}
+	if export.Type == config.ExportTypeArray {
+		return exportArray(body, q)
+	}
+
+	value, found, err := rule.FindOne(body, q)
 	if err != nil {
 		return nil, err
 	}
-	node := jsonquery.FindOne(doc, export.Xpath)
-	if node != nil && node.Value() != nil {
-		value := node.Value()
-		str := fmt.Sprintf("%v", value)
-		switch export.Type {
-		case "integer":
-			return cast.ToInt(str), nil
-		case "float":
-			return cast.ToFloat64(str), nil
-		default:
-			return str, nil
+	// the testcases using the variable would render "<nil>"
+	if !found || value == nil {
+		return nil, fmt.Errorf("exported value is not found, %v", q.Expression())
+	}
+	str := fmt.Sprintf("%v", value)
+	switch export.Type {
+	case config.ExportTypeInteger:
+		// JSON numbers, %v prints 1000000 as 1e+06
+		if f, ok := value.(float64); ok && f == math.Trunc(f) {
+			return int(f), nil
+		}
+		// base 10 only, "0123" is 123
+		v, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("exported value is not an integer, %v", str)
+		}
+		return int(v), nil
+	case config.ExportTypeFloat:
+		if f, ok := value.(float64); ok {
+			return f, nil
+		}
+		v, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, fmt.Errorf("exported value is not a float, %v", str)
+		}
+		return v, nil
+	case config.ExportTypeBool:
+		return cast.ToBoolE(value)
+	case config.ExportTypeJSON:
+		return structuredValue(value, false), nil
+	case config.ExportTypeObject:
+		v, ok := structuredValue(value, true).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("exported value is not an object, %v", str)
+		}
+		return v, nil
+	default:
+		return str, nil
+	}
+}
+
+// exportArray returns every value matched by the query,
+// a single matched array (or a string holding one) is returned as is.
+// JMESPath returns the whole result of the expression.
+func exportArray(body string, q rule.Query) (any, error) {
+	var values []any
+	if len(q.JMESPath) > 0 {
+		value, found, err := rule.FindOne(body, q)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			values = []any{value}
+		}
+	} else {
+		var err error
+		values, err = rule.FindAll(body, q)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(values) == 1 {
+		if list, ok := structuredValue(values[0], true).([]any); ok {
+			return list, nil
 		}
 	}
-	return nil, nil
+	result := make([]any, 0, len(values))
+	for _, value := range values {
+		result = append(result, structuredValue(value, false))
+	}
+	return result, nil
+}
+
+// structuredValue parses a string holding a JSON object or array
+// (any JSON value if scalar is true), keeps other values as they are.
+// Integral numbers become int, so that templates print them without decimals.
+func structuredValue(value any, scalar bool) any {
+	if str, ok := value.(string); ok {
+		trimmed := strings.TrimSpace(str)
+		if scalar || strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			var parsed any
+			if err := json.Unmarshal([]byte(trimmed), &parsed); err == nil {
+				value = parsed
+			}
+		}
+	}
+	return normalizeNumbers(value)
+}
+
+// normalizeNumbers converts the integral float64 in value to int
+func normalizeNumbers(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int(v)
+		}
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = normalizeNumbers(item)
+		}
+		return result
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			result = append(result, normalizeNumbers(item))
+		}
+		return result
+	}
+	return value
+}
+
+// maskedField is a zap field of value with the values of the secrets masked,
+// value is logged as JSON, or as a string if it can't be marshalled or masking breaks the JSON
+func maskedField(key string, value any) zap.Field {
+	if !resource.SecretMasker.Enabled() {
+		return zap.Any(key, value)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return zap.String(key, resource.SecretMasker.Mask(fmt.Sprintf("%+v", value)))
+	}
+	masked := resource.SecretMasker.Mask(string(b))
+	if !json.Valid([]byte(masked)) {
+		return zap.String(key, masked)
+	}
+	return zap.Reflect(key, json.RawMessage(masked))
+}
+
+// maskedError is the message of err with the values of the secrets masked, empty if err is nil
+func maskedError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return resource.SecretMasker.Mask(err.Error())
 }
@@ -0,0 +1,94 @@
+package command
+
+import (
+	"maps"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+)
+
+// restoreResource restores the global resources when the test ends, even if it failed,
+// the fixture of each test file calls it before changing them
+func restoreResource(t *testing.T) {
+	cfg := resource.GlobalConfig
+	httpTestCases, grpcTestCases, fileHooks := resource.HttpTestCases, resource.GrpcTestCases, resource.FileHooks
+	configDir, envVars := resource.ConfigDir, maps.Clone(resource.EnvVars)
+	restyClient, retryClient := resource.RestyClient, resource.RetryClient
+	cacheManager, rateLimiter := resource.CacheManager, resource.RateLimiter
+	keyedRateLimiters, targetRateLimiters := resource.KeyedRateLimiters, resource.TargetRateLimiters
+	environmentManager, harRecorder := resource.EnvironmentManager, resource.HarRecorder
+	secretMasker, mask := resource.SecretMasker, rule.Mask
+	t.Cleanup(func() {
+		resource.GlobalConfig = cfg
+		resource.HttpTestCases, resource.GrpcTestCases, resource.FileHooks = httpTestCases, grpcTestCases, fileHooks
+		resource.ConfigDir, resource.EnvVars = configDir, envVars
+		resource.RestyClient, resource.RetryClient = restyClient, retryClient
+		resource.CacheManager, resource.RateLimiter = cacheManager, rateLimiter
+		resource.KeyedRateLimiters, resource.TargetRateLimiters = keyedRateLimiters, targetRateLimiters
+		resource.EnvironmentManager, resource.HarRecorder = environmentManager, harRecorder
+		resource.SecretMasker, rule.Mask = secretMasker, mask
+	})
+}
+
+func TestShouldSkip(t *testing.T) {
+	restoreResource(t)
+	resource.EnvVars["ENV"] = "dev"
+
+	vars := &sync.Map{}
+	vars.Store("BOOK_ID", 3)
+
+	tests := []struct {
+		name      string
+		skip      bool
+		skipIf    string
+		luaSkipIf string
+		want      bool
+		reason    model.Reason
+	}{
+		{name: "skip", skip: true, want: true, reason: model.ReasonSkipped},
+		{name: "表达式成立", skipIf: "ENV == 'dev'", want: true, reason: model.ReasonSkipConditionMet},
+		{name: "表达式不成立", skipIf: "ENV == 'staging'", want: false, reason: model.ReasonSuccess},
+		{name: "导出变量", skipIf: "BOOK_ID > 2", want: true, reason: model.ReasonSkipConditionMet},
+		{name: "模板", skipIf: "{% if ENV != 'prod' %}yes{% endif %}", want: true, reason: model.ReasonSkipConditionMet},
+		{name: "Lua", luaSkipIf: "function skip() return ENV == 'dev' and BOOK_ID == 3 end",
+			want: true, reason: model.ReasonSkipConditionMet},
+		{name: "Lua不成立", luaSkipIf: "function skip() return false end", want: false, reason: model.ReasonSuccess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skip, reason, err := shouldSkip(tt.skip, tt.skipIf, tt.luaSkipIf, vars, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, skip)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+func TestStateGroupMembers(t *testing.T) {
+	g := model.NewStateGroup()
+	for _, id := range []uint64{3001, 3002} {
+		g.SetState(id, model.StateNotExecuted)
+		g.AddMember(3, id)
+	}
+	assert.Equal(t, model.StateNotExecuted, g.GetState(3))
+
+	g.SetState(3001, model.StateSkipped)
+	g.SetState(3002, model.StateSuccessFul)
+	assert.Equal(t, model.StateSuccessFul, g.GetState(3))
+
+	g.SetState(3002, model.StateFailed)
+	assert.Equal(t, model.StateFailed, g.GetState(3))
+
+	g.SetState(3001, model.StateCancelled)
+	assert.Equal(t, model.StateCancelled, g.GetState(3))
+
+	g.SetState(3001, model.StateFlaky)
+	assert.Equal(t, model.StateFailed, g.GetState(3))
+	g.SetState(3002, model.StateSuccessFul)
+	assert.Equal(t, model.StateFlaky, g.GetState(3))
+}
@@ -0,0 +1,293 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/util"
+)
+
+// Output formats of autotest diff
+const (
+	DiffFormatConsole  = "console"
+	DiffFormatMarkdown = "markdown"
+	DiffFormatJSON     = "json"
+)
+
+// DiffEntry is a testcase which differs between the two runs
+type DiffEntry struct {
+	Protocol    string        `json:"protocol"`
+	File        string        `json:"file"`
+	ID          uint64        `json:"id"`
+	Description string        `json:"description"`
+	StatusA     string        `json:"status_a,omitempty"`
+	StatusB     string        `json:"status_b,omitempty"`
+	DurationA   time.Duration `json:"duration_a,omitempty"`
+	DurationB   time.Duration `json:"duration_b,omitempty"`
+	ErrorMsg    string        `json:"error_message,omitempty"`
+}
+
+func (e DiffEntry) key() string {
+	return util.CaseKey(e.Protocol, e.File, e.ID)
+}
+
+// RunDiff is the result of autotest diff, run A is the baseline
+type RunDiff struct {
+	RunA string `json:"run_a"`
+	RunB string `json:"run_b"`
+	// testcases found in both runs
+	Matched            int         `json:"matched"`
+	NewlyFailing       []DiffEntry `json:"newly_failing"`
+	NewlyPassing       []DiffEntry `json:"newly_passing"`
+	Removed            []DiffEntry `json:"removed"`
+	Added              []DiffEntry `json:"added"`
+	LatencyRegressions []DiffEntry `json:"latency_regressions"`
+}
+
+// Unmatched reports whether no testcase is found in both runs, e.g. the runs of different rule files,
+// every testcase is then removed and added, which is not a comparison
+func (d *RunDiff) Unmatched() bool {
+	return d.Matched == 0 && len(d.Removed) > 0 && len(d.Added) > 0
+}
+
+// Regressed reports whether run B is worse than run A
+func (d *RunDiff) Regressed() bool {
+	return len(d.NewlyFailing) > 0 || len(d.LatencyRegressions) > 0
+}
+
+// DiffRuns compares the JSON reports of two runs
+func DiffRuns(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return cli.Exit("usage: autotest diff <runA> <runB>", model.ExitCodeConfigError)
+	}
+	format := cmd.String("format")
+	if format != DiffFormatConsole && format != DiffFormatMarkdown && format != DiffFormatJSON {
+		return cli.Exit(fmt.Sprintf("unknown format:%v, console | markdown | json", format),
+			model.ExitCodeConfigError)
+	}
+
+	runA, runB := cmd.Args().Get(0), cmd.Args().Get(1)
+	reportA, err := loadRunReport(runA)
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
+	}
+	reportB, err := loadRunReport(runB)
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
+	}
+
+	diff := diffReports(reportA, reportB, cmd.Float64("latency-threshold"), cmd.Duration("min-latency-delta"))
+	diff.RunA, diff.RunB = runA, runB
+
+	var w io.Writer = os.Stdout
+	output := cmd.String("output")
+	if len(output) > 0 {
+		f, err := os.Create(output)
+		if err != nil {
+			return cli.Exit(err.Error(), model.ExitCodeInfraError)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case DiffFormatMarkdown:
+		printDiffMarkdown(w, diff)
+	case DiffFormatJSON:
+		b, _ := json.MarshalIndent(diff, "", "  ")
+		fmt.Fprintf(w, "%s\n", b)
+	default:
+		printDiffConsole(w, diff)
+	}
+
+	if diff.Unmatched() {
+		return cli.Exit(fmt.Sprintf("no testcase of %v matches a testcase of %v", runB, runA),
+			model.ExitCodeConfigError)
+	}
+	if diff.Regressed() {
+		return cli.Exit(fmt.Sprintf("%d testcases newly failing, %d latency regressions",
+			len(diff.NewlyFailing), len(diff.LatencyRegressions)), model.ExitCodeTestFailed)
+	}
+	return nil
+}
+
+// loadRunReport reads report.json of a run, the run is either the report dir or the report file
+func loadRunReport(run string) (*util.ReportData, error) {
+	path := run
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, "report.json")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read report of %v, the run must have the json report format: %w", run, err)
+	}
+	var data util.ReportData
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		return nil, fmt.Errorf("parse report %v: %w", path, err)
+	}
+	return &data, nil
+}
+
+// diffReports compares run B with the baseline run A. A testcase has a latency regression if it passed
+// in both runs and its duration grew by more than threshold (0.2 for 20%) and by at least minDelta.
+func diffReports(a, b *util.ReportData, threshold float64, minDelta time.Duration) *RunDiff {
+	newEntry := func(tc util.TestCaseResult) DiffEntry {
+		return DiffEntry{Protocol: tc.Protocol, File: tc.File, ID: tc.ID, Description: tc.Description}
+	}
+	casesA := make(map[string]util.TestCaseResult, len(a.TestCases))
+	for _, tc := range a.TestCases {
+		casesA[newEntry(tc).key()] = tc
+	}
+
+	diff := &RunDiff{}
+	seen := make(map[string]struct{}, len(b.TestCases))
+	for _, tcB := range b.TestCases {
+		entry := newEntry(tcB)
+		entry.StatusB, entry.DurationB = tcB.Status, tcB.Duration
+		seen[entry.key()] = struct{}{}
+
+		tcA, ok := casesA[entry.key()]
+		if !ok {
+			diff.Added = append(diff.Added, entry)
+			continue
+		}
+		diff.Matched++
+		entry.StatusA, entry.DurationA = tcA.Status, tcA.Duration
+		switch {
+		case tcA.Status == util.StatusPassed && isFailing(tcB.Status):
+			entry.ErrorMsg = tcB.ErrorMsg
+			diff.NewlyFailing = append(diff.NewlyFailing, entry)
+		case isFailing(tcA.Status) && tcB.Status == util.StatusPassed:
+			diff.NewlyPassing = append(diff.NewlyPassing, entry)
+		case tcA.Status == util.StatusPassed && tcB.Status == util.StatusPassed:
+			delta := tcB.Duration - tcA.Duration
+			if delta >= minDelta && float64(tcB.Duration) > float64(tcA.Duration)*(1+threshold) {
+				diff.LatencyRegressions = append(diff.LatencyRegressions, entry)
+			}
+		}
+	}
+	for _, tcA := range a.TestCases {
+		entry := newEntry(tcA)
+		if _, ok := seen[entry.key()]; ok {
+			continue
+		}
+		entry.StatusA, entry.DurationA = tcA.Status, tcA.Duration
+		diff.Removed = append(diff.Removed, entry)
+	}
+
+	for _, list := range [][]DiffEntry{diff.NewlyFailing, diff.NewlyPassing, diff.Removed, diff.Added} {
+		sortDiffEntries(list)
+	}
+	// the biggest regression first
+	sort.SliceStable(diff.LatencyRegressions, func(i, j int) bool {
+		return latencyChange(diff.LatencyRegressions[i]) > latencyChange(diff.LatencyRegressions[j])
+	})
+	return diff
+}
+
+func isFailing(status string) bool {
+	return status == util.StatusFailed || status == util.StatusFlaky
+}
+
+func sortDiffEntries(list []DiffEntry) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].key() < list[j].key()
+	})
+}
+
+// latencyChange is the relative change of the duration, 0.5 for 50% slower
+func latencyChange(e DiffEntry) float64 {
+	if e.DurationA <= 0 {
+		return 0
+	}
+	return float64(e.DurationB-e.DurationA) / float64(e.DurationA)
+}
+
+type diffSection struct {
+	title   string
+	entries []DiffEntry
+	latency bool
+}
+
+func diffSections(diff *RunDiff) []diffSection {
+	return []diffSection{
+		{title: "Newly failing", entries: diff.NewlyFailing},
+		{title: "Newly passing", entries: diff.NewlyPassing},
+		{title: "Latency regressions", entries: diff.LatencyRegressions, latency: true},
+		{title: "Removed", entries: diff.Removed},
+		{title: "Added", entries: diff.Added},
+	}
+}
+
+func (s diffSection) row(e DiffEntry) []string {
+	if s.latency {
+		return []string{e.key(), e.Description, e.DurationA.Round(time.Millisecond).String(),
+			e.DurationB.Round(time.Millisecond).String(), fmt.Sprintf("%+.1f%%", latencyChange(e)*100)}
+	}
+	return []string{e.key(), e.Description, statusOrNone(e.StatusA), statusOrNone(e.StatusB), e.ErrorMsg}
+}
+
+func (s diffSection) header() []string {
+	if s.latency {
+		return []string{"CASE", "DESCRIPTION", "A", "B", "CHANGE"}
+	}
+	return []string{"CASE", "DESCRIPTION", "A", "B", "ERROR"}
+}
+
+func statusOrNone(status string) string {
+	if len(status) <= 0 {
+		return "-"
+	}
+	return status
+}
+
+func printDiffConsole(w io.Writer, diff *RunDiff) {
+	fmt.Fprintf(w, "A: %v\nB: %v\n", diff.RunA, diff.RunB)
+	for _, section := range diffSections(diff) {
+		fmt.Fprintf(w, "\n%v (%d)\n", section.title, len(section.entries))
+		if len(section.entries) == 0 {
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(section.header(), "\t"))
+		for _, e := range section.entries {
+			fmt.Fprintln(tw, strings.Join(section.row(e), "\t"))
+		}
+		tw.Flush()
+	}
+}
+
+func printDiffMarkdown(w io.Writer, diff *RunDiff) {
+	fmt.Fprintf(w, "# autotest diff\n\n- A: `%v`\n- B: `%v`\n", diff.RunA, diff.RunB)
+	for _, section := range diffSections(diff) {
+		fmt.Fprintf(w, "\n## %v (%d)\n\n", section.title, len(section.entries))
+		if len(section.entries) == 0 {
+			fmt.Fprintln(w, "None")
+			continue
+		}
+		header := section.header()
+		fmt.Fprintf(w, "| %v |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "|%v\n", strings.Repeat(" --- |", len(header)))
+		for _, e := range section.entries {
+			cells := section.row(e)
+			for i, cell := range cells {
+				cells[i] = util.EscapeMarkdownCell(cell)
+			}
+			fmt.Fprintf(w, "| %v |\n", strings.Join(cells, " | "))
+		}
+	}
+}
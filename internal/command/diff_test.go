@@ -0,0 +1,124 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestDiffReports(t *testing.T) {
+	tc := func(id uint64, status string, duration time.Duration) util.TestCaseResult {
+		return util.TestCaseResult{ID: id, Protocol: "http", File: "/rules/a.yml", Status: status,
+			Duration: duration, ErrorMsg: strings.ReplaceAll(status, "passed", "")}
+	}
+	a := &util.ReportData{TestCases: []util.TestCaseResult{
+		tc(1, util.StatusPassed, 100*time.Millisecond),
+		tc(2, util.StatusFailed, 100*time.Millisecond),
+		tc(3, util.StatusPassed, 100*time.Millisecond),
+		tc(4, util.StatusPassed, 100*time.Millisecond),
+		tc(5, util.StatusPassed, 10*time.Millisecond),
+		tc(6, util.StatusPassed, 100*time.Millisecond),
+	}}
+	b := &util.ReportData{TestCases: []util.TestCaseResult{
+		tc(1, util.StatusFlaky, 100*time.Millisecond),
+		tc(2, util.StatusPassed, 100*time.Millisecond),
+		tc(3, util.StatusPassed, 150*time.Millisecond),
+		tc(4, util.StatusPassed, 110*time.Millisecond),
+		// slower by 50%, but only by 5ms
+		tc(5, util.StatusPassed, 15*time.Millisecond),
+		tc(7, util.StatusSkipped, 0),
+	}}
+
+	diff := diffReports(a, b, 0.2, 10*time.Millisecond)
+	assert.Len(t, diff.NewlyFailing, 1)
+	assert.Equal(t, uint64(1), diff.NewlyFailing[0].ID)
+	assert.Equal(t, "flaky", diff.NewlyFailing[0].ErrorMsg)
+	assert.Len(t, diff.NewlyPassing, 1)
+	assert.Equal(t, uint64(2), diff.NewlyPassing[0].ID)
+	assert.Len(t, diff.LatencyRegressions, 1)
+	assert.Equal(t, uint64(3), diff.LatencyRegressions[0].ID)
+	assert.InDelta(t, 0.5, latencyChange(diff.LatencyRegressions[0]), 0.001)
+	assert.Len(t, diff.Removed, 1)
+	assert.Equal(t, uint64(6), diff.Removed[0].ID)
+	assert.Len(t, diff.Added, 1)
+	assert.Equal(t, uint64(7), diff.Added[0].ID)
+	assert.True(t, diff.Regressed())
+
+	// no difference
+	assert.False(t, diffReports(a, a, 0.2, 0).Regressed())
+
+	// the rule files are recorded relative to the config file, the rule files with the same name
+	// in different directories are not mixed up
+	a = &util.ReportData{TestCases: []util.TestCaseResult{
+		{ID: 1, Protocol: "http", File: "rules/svc-a/books.yml", Status: util.StatusPassed},
+		{ID: 1, Protocol: "http", File: "rules/svc-b/books.yml", Status: util.StatusFailed},
+	}}
+	b = &util.ReportData{TestCases: []util.TestCaseResult{
+		{ID: 1, Protocol: "http", File: "rules/svc-b/books.yml", Status: util.StatusFailed},
+		{ID: 1, Protocol: "http", File: "rules/svc-a/books.yml", Status: util.StatusPassed},
+	}}
+	sameFiles := diffReports(a, b, 0.2, 0)
+	assert.Equal(t, 2, sameFiles.Matched)
+	assert.False(t, sameFiles.Regressed())
+	assert.False(t, sameFiles.Unmatched())
+	assert.Empty(t, sameFiles.NewlyPassing)
+	assert.Empty(t, sameFiles.Added)
+	assert.Empty(t, sameFiles.Removed)
+
+	// nothing to compare
+	b.TestCases[0].File, b.TestCases[1].File = "/ci/rules/svc-b/books.yml", "/ci/rules/svc-a/books.yml"
+	assert.True(t, diffReports(a, b, 0.2, 0).Unmatched())
+	assert.False(t, diffReports(a, &util.ReportData{}, 0.2, 0).Unmatched())
+
+	var buf bytes.Buffer
+	printDiffConsole(&buf, diff)
+	assert.Contains(t, buf.String(), "Newly failing (1)\nCASE")
+	assert.Contains(t, buf.String(), "+50.0%")
+
+	buf.Reset()
+	printDiffMarkdown(&buf, diff)
+	assert.Contains(t, buf.String(), "## Latency regressions (1)\n\n| CASE | DESCRIPTION | A | B | CHANGE |\n| --- | --- | --- | --- | --- |\n")
+	assert.Contains(t, buf.String(), "| http:/rules/a.yml:6 |  | passed | - |  |")
+}
+
+func TestLoadRunReport(t *testing.T) {
+	dir := t.TempDir()
+	var data util.ReportData
+	data.TestCases = []util.TestCaseResult{{ID: 1, Status: util.StatusPassed}}
+	b, _ := json.Marshal(data)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "report.json"), b, 0644))
+
+	// the run dir or the report file
+	for _, run := range []string{dir, filepath.Join(dir, "report.json")} {
+		report, err := loadRunReport(run)
+		assert.NoError(t, err)
+		assert.Len(t, report.TestCases, 1)
+	}
+
+	_, err := loadRunReport(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestRelRulePath(t *testing.T) {
+	restoreResource(t)
+	resource.ConfigDir = ""
+	assert.Equal(t, "/ci/rules/a.yml", resource.RelRulePath("/ci/rules/a.yml"))
+	resource.ConfigDir = "/ci/config_files"
+	assert.Equal(t, "../rules/a.yml", resource.RelRulePath("/ci/rules/a.yml"))
+	assert.Equal(t, "a.yml", resource.RelRulePath("/ci/config_files/a.yml"))
+	assert.Equal(t, "/ci/rules/a.yml", resource.AbsRulePath("../rules/a.yml"))
+	assert.Equal(t, "/tmp/a.yml", resource.AbsRulePath("/tmp/a.yml"))
+	// the reports and the history record the relative path
+	result := newTestCaseResult("http", "/ci/rules/a.yml", 0, 1, "", model.StateSuccessFul, model.ReasonSuccess,
+		nil, time.Time{}, time.Time{}, RequestTrace{})
+	assert.Equal(t, "http:../rules/a.yml:1", util.CaseKey(result.Protocol, result.File, result.ID))
+}
@@ -0,0 +1,199 @@
+package command
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/util"
+)
+
+// smtpStandIn is a minimal SMTP server which records the received mails
+type smtpStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	auth     []string
+	rcpts    [][]string
+	mails    []string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &smtpStandIn{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n")) //nolint: errcheck
+	}
+	reply("220 localhost ESMTP")
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.mu.Lock()
+			s.auth = append(s.auth, line)
+			s.mu.Unlock()
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			rcpts = append(rcpts, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, rcpts)
+			s.mails = append(s.mails, data.String())
+			s.mu.Unlock()
+			rcpts = nil
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func newEmailChannel(port int) config.NotifierChannel {
+	return config.NotifierChannel{
+		Name: "qa",
+		Type: util.NotifierEmail,
+		SMTP: &config.SMTP{Host: "127.0.0.1", Port: port, Username: "bot", Password: "secret",
+			From: "autotest@example.com", TLS: util.SMTPNone},
+		To:          []string{"qa@example.com"},
+		ToOnFailure: []string{"dev@example.com"},
+	}
+}
+
+func TestSendTestResultEmail(t *testing.T) {
+	server := newSMTPStandIn(t)
+	defer server.listener.Close()
+
+	cfg := newNotificationConfig(newEmailChannel(server.port()))
+	cfg.Global.Notifications.OnSuccess = true
+	cfg.Global.Report.DirPath = t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(cfg.Global.Report.DirPath, "report.html"), []byte("<html>report</html>"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(cfg.Global.Report.DirPath, "junit.xml"), []byte("<testsuite/>"), 0644))
+
+	result := util.TestResult{TotalTests: 2, PassedTests: 1, FailedTests: 1, FailedCases: []string{"HTTP_1: <get book>"}}
+	assert.NoError(t, util.NewNotificationService(cfg).SendTestResult(result))
+
+	assert.Len(t, server.mails, 1)
+	b, _ := base64.StdEncoding.DecodeString(strings.Fields(server.auth[0])[2])
+	assert.Equal(t, "\x00bot\x00secret", string(b))
+	// the recipients of the failed runs are added
+	assert.Equal(t, []string{"qa@example.com", "dev@example.com"}, server.rcpts[0])
+
+	msg, err := mail.ReadMessage(strings.NewReader(server.mails[0]))
+	assert.NoError(t, err)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Equal(t, "AutoTest 执行完成 - ❌ 失败", subject)
+	assert.Equal(t, "qa@example.com, dev@example.com", msg.Header.Get("To"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	var filenames []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		parts = append(parts, string(content))
+		filenames = append(filenames, part.FileName())
+	}
+	assert.Len(t, parts, 3)
+	assert.Contains(t, parts[0], "<td style=\"border: 1px solid #ddd; padding: 6px;\">1</td>")
+	assert.Contains(t, parts[0], "HTTP_1: &lt;get book&gt;")
+	assert.Equal(t, []string{"", "report.html", "junit.xml"}, filenames)
+	assert.Equal(t, "<html>report</html>", parts[1])
+
+	// only the recipients of every run on success
+	assert.NoError(t, util.NewNotificationService(cfg).SendTestResult(util.TestResult{TotalTests: 1, PassedTests: 1}))
+	assert.Equal(t, []string{"qa@example.com"}, server.rcpts[1])
+}
+
+func TestSendTestResultEmailStartTLS(t *testing.T) {
+	server := newSMTPStandIn(t)
+	defer server.listener.Close()
+
+	// STARTTLS is required by default
+	ch := newEmailChannel(server.port())
+	ch.SMTP.TLS = ""
+	err := util.NewNotificationService(newNotificationConfig(ch)).SendTestResult(util.TestResult{FailedTests: 1})
+	assert.ErrorContains(t, err, "does not support STARTTLS")
+	assert.Empty(t, server.mails)
+}
+
+func TestValidateSMTP(t *testing.T) {
+	ch := newEmailChannel(25)
+	assert.NoError(t, ValidateNotifierChannels([]config.NotifierChannel{ch}))
+
+	invalid := []func(ch *config.NotifierChannel){
+		func(ch *config.NotifierChannel) { ch.SMTP = nil },
+		func(ch *config.NotifierChannel) { ch.SMTP.From = "" },
+		func(ch *config.NotifierChannel) { ch.SMTP.TLS = "ssl" },
+		func(ch *config.NotifierChannel) { ch.To, ch.ToOnFailure = nil, nil },
+	}
+	for idx, modify := range invalid {
+		ch := newEmailChannel(25)
+		modify(&ch)
+		assert.Error(t, ValidateNotifierChannels([]config.NotifierChannel{ch}), strconv.Itoa(idx))
+	}
+}
@@ -0,0 +1,69 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+	slog "github.com/vearne/simplelog"
+)
+
+// ShowEnv prints the variables resolved from the environment, the secrets and --var,
+// with the source of each one. The values of the secrets are masked.
+func ShowEnv(ctx context.Context, cmd *cli.Command) error {
+	confFilePath := cmd.String("config-file")
+	environment := cmd.String("environment")
+	slog.Info("config-file:%v, environment:%v", confFilePath, environment)
+
+	err := resource.ParseConfigFile(confFilePath)
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeConfigError)
+	}
+	err = ValidateSecrets(resource.GlobalConfig.Secrets)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("secrets error, %v", err), model.ExitCodeConfigError)
+	}
+	err = ValidateEnvironments(resource.GlobalConfig.Environments)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("environments error, %v", err), model.ExitCodeConfigError)
+	}
+
+	resource.InitEnvironmentManager()
+	err = loadVars(environment, cmd.StringSlice("var"))
+	if err != nil {
+		return err
+	}
+	writeEnv(os.Stdout, resource.EnvVars)
+	return nil
+}
+
+// writeEnv writes the variables sorted by name, the values of the secrets are masked
+func writeEnv(w io.Writer, vars map[string]string) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, name := range names {
+		value := resource.SecretMasker.Mask(vars[name])
+		if resource.SecretMasker.IsSecret(name) {
+			value = util.SecretMask
+		}
+		source := resource.VarSource(name)
+		if len(source) <= 0 {
+			source = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", name, value, source)
+	}
+	tw.Flush()
+}
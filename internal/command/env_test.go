@@ -0,0 +1,90 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/resource"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnvironmentUnmarshal(t *testing.T) {
+	var cfg config.AutoTestConfig
+	err := yaml.Unmarshal([]byte(`
+environments:
+  base:
+    HOST: "localhost:8080"
+    PORT: 8080
+  staging:
+    extends: base
+    env_file: .env.staging
+    HOST: "staging:8080"
+`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config.Environment{Vars: map[string]string{"HOST": "localhost:8080", "PORT": "8080"}},
+		cfg.Environments["base"])
+	assert.Equal(t, config.Environment{Extends: "base", EnvFile: ".env.staging",
+		Vars: map[string]string{"HOST": "staging:8080"}}, cfg.Environments["staging"])
+}
+
+func TestValidateEnvironments(t *testing.T) {
+	assert.NoError(t, ValidateEnvironments(map[string]config.Environment{
+		"base": {}, "staging": {Extends: "base"}, "prod": {Extends: "staging"}}))
+	assert.ErrorContains(t, ValidateEnvironments(map[string]config.Environment{"staging": {Extends: "base"}}),
+		"environment 'staging' extends 'base', which is not found")
+	assert.ErrorContains(t, ValidateEnvironments(map[string]config.Environment{
+		"a": {Extends: "b"}, "b": {Extends: "a"}}), "environment 'a' extends itself, a -> b -> a")
+}
+
+func TestLoadVarsPrecedence(t *testing.T) {
+	restoreResource(t)
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env.staging")
+	assert.NoError(t, os.WriteFile(envFile, []byte("# staging\nDB=\"db-${AUTOTEST_TEST_REGION}\"\nRAW='${NOT_EXPANDED}'\n"), 0600))
+	// every variable set to the process environment is restored
+	for _, key := range []string{"HOST", "USER", "DB", "RAW", "TIMEOUT", "TOKEN"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("AUTOTEST_TEST_REGION", "eu")
+	t.Setenv("AUTOTEST_TEST_TOKEN", "token-from-env")
+
+	resource.GlobalConfig.Environments = map[string]config.Environment{
+		"base":    {Vars: map[string]string{"HOST": "localhost", "USER": "admin", "DB": "db-local", "TIMEOUT": "1s"}},
+		"staging": {Extends: "base", EnvFile: envFile, Vars: map[string]string{"HOST": "staging-${AUTOTEST_TEST_REGION}", "DB": "db-staging"}},
+	}
+	resource.GlobalConfig.Secrets = []config.Secret{{Name: "TOKEN", Env: "AUTOTEST_TEST_TOKEN"}}
+
+	resource.InitEnvironmentManager()
+	assert.NoError(t, loadVars("staging", []string{"TIMEOUT=5s", "USER=a,b"}))
+	assert.Equal(t, "staging-eu", resource.EnvVars["HOST"])
+	assert.Equal(t, "db-eu", resource.EnvVars["DB"])
+	assert.Equal(t, "${NOT_EXPANDED}", resource.EnvVars["RAW"])
+	assert.Equal(t, "a,b", resource.EnvVars["USER"])
+	assert.Equal(t, "5s", resource.EnvVars["TIMEOUT"])
+	assert.Equal(t, "token-from-env", resource.EnvVars["TOKEN"])
+	// the secrets are not copied to the process environment
+	assert.Empty(t, os.Getenv("TOKEN"))
+
+	var b strings.Builder
+	writeEnv(&b, resource.EnvVars)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 7)
+	assert.Regexp(t, `^NAME +VALUE +SOURCE$`, lines[0])
+	assert.Regexp(t, `^DB +db-eu +env_file .*\.env\.staging$`, lines[1])
+	assert.Regexp(t, `^HOST +staging-eu +environment staging$`, lines[2])
+	assert.Regexp(t, `^TIMEOUT +5s +--var$`, lines[4])
+	assert.Regexp(t, `^TOKEN +\*\*\*\*\*\* +secret env AUTOTEST_TEST_TOKEN$`, lines[5])
+	assert.Regexp(t, `^USER +a,b +--var$`, lines[6])
+
+	assert.ErrorContains(t, loadVars("staging", []string{"TIMEOUT"}), `invalid --var "TIMEOUT"`)
+	assert.ErrorContains(t, loadVars("staging", []string{"URL=${AUTOTEST_TEST_NOT_SET}"}),
+		"--var URL, environment variable AUTOTEST_TEST_NOT_SET is not set")
+	resource.GlobalConfig.Environments["staging"].Vars["URL"] = "${AUTOTEST_TEST_NOT_SET}"
+	resource.InitEnvironmentManager()
+	assert.ErrorContains(t, loadVars("staging", nil),
+		"environment 'staging', variable URL, environment variable AUTOTEST_TEST_NOT_SET is not set")
+}
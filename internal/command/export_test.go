@@ -0,0 +1,167 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestExportTypes(t *testing.T) {
+	body := `{"ok": true, "total": 2.5, "books": [{"id": 1, "title": "Go"}, {"id": 2, "title": "Rust"}],
+		"meta": "{\"page\": 1}", "tags": "[\"a\", \"b\"]", "count": 1000000, "code": "0123", "price": "3.7"}`
+	tests := []struct {
+		name   string
+		export config.Export
+		format string
+		want   any
+	}{
+		{"bool", config.Export{Xpath: "/ok", Type: config.ExportTypeBool}, rule.FormatJSON, true},
+		{"integer", config.Export{Xpath: "/count", Type: config.ExportTypeInteger}, rule.FormatJSON, 1000000},
+		{"integer of a string in base 10", config.Export{Xpath: "/code", Type: config.ExportTypeInteger}, rule.FormatJSON, 123},
+		{"float", config.Export{Xpath: "/total", Type: config.ExportTypeFloat}, rule.FormatJSON, 2.5},
+		{"float of a string", config.Export{Xpath: "/price", Type: config.ExportTypeFloat}, rule.FormatJSON, 3.7},
+		{"string by default", config.Export{Xpath: "/total"}, rule.FormatJSON, "2.5"},
+		{"json keeps the structure", config.Export{JSONPath: "$.books[0]", Type: config.ExportTypeJSON}, rule.FormatJSON,
+			map[string]any{"id": 1, "title": "Go"}},
+		{"json parses a string holding JSON", config.Export{Xpath: "/meta", Type: config.ExportTypeJSON}, rule.FormatJSON,
+			map[string]any{"page": 1}},
+		{"json keeps a plain string", config.Export{Xpath: "/books/*[1]/title", Type: config.ExportTypeJSON}, rule.FormatJSON,
+			"Go"},
+		{"object", config.Export{JMESPath: "books[1]", Type: config.ExportTypeObject}, rule.FormatJSON,
+			map[string]any{"id": 2, "title": "Rust"}},
+		{"array of the matched values", config.Export{JSONPath: "$.books[*].id", Type: config.ExportTypeArray}, rule.FormatJSON,
+			[]any{1, 2}},
+		{"array of a matched array", config.Export{Xpath: "/books", Type: config.ExportTypeArray}, rule.FormatJSON,
+			[]any{map[string]any{"id": 1, "title": "Go"}, map[string]any{"id": 2, "title": "Rust"}}},
+		{"array of a string holding an array", config.Export{Xpath: "/tags", Type: config.ExportTypeArray}, rule.FormatJSON,
+			[]any{"a", "b"}},
+		{"array of a JMESPath result", config.Export{JMESPath: "books[].title", Type: config.ExportTypeArray}, rule.FormatJSON,
+			[]any{"Go", "Rust"}},
+		{"array of nothing", config.Export{JSONPath: "$.authors[*]", Type: config.ExportTypeArray}, rule.FormatJSON,
+			[]any{}},
+		{"array of xml nodes", config.Export{Xpath: "//id", Type: config.ExportTypeArray, Format: rule.FormatXML}, "",
+			[]any{"1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := body
+			if tt.export.Format == rule.FormatXML {
+				b = "<books><book><id>1</id></book><book><id>2</id></book></books>"
+			}
+			value, err := exportTo(b, tt.format, &tt.export)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+
+	_, err := exportTo(body, rule.FormatJSON, &config.Export{Xpath: "/books", Type: config.ExportTypeObject})
+	assert.ErrorContains(t, err, "exported value is not an object")
+	_, err = exportTo(body, rule.FormatJSON, &config.Export{Xpath: "/books/*[1]/title", Type: config.ExportTypeBool})
+	assert.Error(t, err)
+	_, err = exportTo(`{"id": "abc"}`, rule.FormatJSON, &config.Export{Xpath: "/id", Type: config.ExportTypeInteger})
+	assert.ErrorContains(t, err, "exported value is not an integer, abc")
+	_, err = exportTo(`{"id": "3.7"}`, rule.FormatJSON, &config.Export{Xpath: "/id", Type: config.ExportTypeInteger})
+	assert.ErrorContains(t, err, "exported value is not an integer, 3.7")
+	_, err = exportTo(`{"id": 3.7}`, rule.FormatJSON, &config.Export{Xpath: "/id", Type: config.ExportTypeInteger})
+	assert.ErrorContains(t, err, "exported value is not an integer, 3.7")
+	_, err = exportTo(`{"id": "abc"}`, rule.FormatJSON, &config.Export{Xpath: "/id", Type: config.ExportTypeFloat})
+	assert.ErrorContains(t, err, "exported value is not a float, abc")
+	_, err = exportTo(body, rule.FormatJSON, &config.Export{JSONPath: "$.author", Type: config.ExportTypeInteger})
+	assert.ErrorContains(t, err, "exported value is not found, jsonpath: $.author")
+	_, err = exportTo(body, rule.FormatJSON, &config.Export{Xpath: "/author"})
+	assert.ErrorContains(t, err, "exported value is not found, xpath: /author")
+
+	assert.NoError(t, ValidateExportType(1, ""))
+	assert.NoError(t, ValidateExportType(1, config.ExportTypeArray))
+	assert.ErrorContains(t, ValidateExportType(1, "list"), "unknown export type:list, testCaseId:1")
+}
+
+func TestStructuredVarsInTemplates(t *testing.T) {
+	vars := &sync.Map{}
+	vars.Store("BOOK_IDS", []any{1, 2})
+	vars.Store("BOOK", map[string]any{"title": `"Go" & <Rust>`, "tags": []any{"a"}})
+
+	body, err := templateRenderWithVars(`{"ids": {{ BOOK_IDS|json }}, "book": {{ BOOK|json }}}`, vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"ids": [1,2], "book": {"tags":["a"],"title":"\"Go\" & <Rust>"}}`, body)
+
+	list, err := templateRenderWithVars(`{% for id in BOOK_IDS %}/books/{{ id }};{% endfor %}{{ BOOK.tags.0 }}`, vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/books/1;/books/2;a", list)
+
+	// the objects and arrays are Lua tables
+	skip, reason, err := shouldSkip(false, "", `function skip() return #BOOK_IDS == 2 and BOOK.tags[1] == "a" end`, vars, nil)
+	assert.NoError(t, err)
+	assert.True(t, skip)
+	assert.Equal(t, model.ReasonSkipConditionMet, reason)
+}
+
+func TestRunLuaHookTables(t *testing.T) {
+	vars := &sync.Map{}
+	err := runLuaHook(`
+		function run()
+			return {IDS = {3, 4}, USER = {name = "tom", roles = {"admin"}}}
+		end`, vars)
+	assert.NoError(t, err)
+	ids, _ := vars.Load("IDS")
+	user, _ := vars.Load("USER")
+	assert.Equal(t, []any{3, 4}, ids)
+	assert.Equal(t, map[string]any{"name": "tom", "roles": []any{"admin"}}, user)
+	// the same as the exported IDs in templates
+	list, err := templateRenderWithVars(`{% for id in IDS %}{{ id }};{% endfor %}`, vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "3;4;", list)
+
+	masker := util.NewSecretMasker([]string{"USER"})
+	masker.Track("USER", user)
+	assert.Equal(t, "****** ****** guest", masker.Mask("tom admin guest"))
+	masker.Track("USER", nil)
+	assert.Equal(t, "<nil>", masker.Mask("<nil>"))
+}
+
+func initExportTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestHttpTestCallableExportFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"books": [1, 2]}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	initExportTestResource(t)
+
+	testcase := &config.TestCaseHttp{
+		ID:          1,
+		Request:     config.RequestHttp{Method: "get", URL: server.URL + "/books"},
+		Export:      &config.Export{Xpath: "/books", ExportTo: "BOOKS", Type: config.ExportTypeObject},
+		VerifyRules: []rule.VerifyRule{&rule.HttpStatusEqualRule{Expected: http.StatusOK}},
+	}
+	callable := &HttpTestCallable{testcase: testcase, stateGroup: model.NewStateGroup(), vars: &sync.Map{}}
+	r := callable.Call(context.Background())
+	tcResult := r.Value.(HttpTestCaseResult)
+	assert.Equal(t, model.StateFailed, tcResult.State)
+	assert.Equal(t, model.ReasonExportFailed, tcResult.Reason)
+	assert.ErrorContains(t, tcResult.Error, "export BOOKS, exported value is not an object")
+	assert.Error(t, r.Err)
+	// the value is not stored, the steps stop at the export
+	assert.NotContains(t, tcResult.KeyValues, "BOOKS")
+	last := tcResult.Steps[len(tcResult.Steps)-1]
+	assert.Equal(t, util.StepExport, last.Name)
+	assert.Equal(t, util.StatusFailed, last.Status)
+}
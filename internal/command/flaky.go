@@ -0,0 +1,112 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vearne/autotest/internal/resource"
+	slog "github.com/vearne/simplelog"
+)
+
+// quarantineKey identifies a testcase in the quarantine file
+type quarantineKey struct {
+	file string
+	id   uint64
+}
+
+// parseQuarantineFile reads the known flaky testcases, one "<rule file>:<id>" per line.
+// The rule file is either the path in the config file or its base name,
+// empty lines and lines starting with '#' are ignored.
+func parseQuarantineFile(filePath string) ([]quarantineKey, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []quarantineKey
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndex(line, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("%v:%v, expected <rule file>:<id>, got %q", filePath, lineNo, line)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(line[idx+1:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v, invalid testcase id %q", filePath, lineNo, line[idx+1:])
+		}
+		keys = append(keys, quarantineKey{file: strings.TrimSpace(line[:idx]), id: id})
+	}
+	return keys, scanner.Err()
+}
+
+func (k quarantineKey) match(filePath string, id uint64) bool {
+	if k.id != id {
+		return false
+	}
+	return k.file == filePath || k.file == filepath.Base(filePath)
+}
+
+func quarantined(keys []quarantineKey, filePath string, id uint64) bool {
+	for _, k := range keys {
+		if k.match(filePath, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRunOptions sets the repeat count of the testcases which don't declare one,
+// and marks the testcases listed in the quarantine file
+func applyRunOptions(repeat int, quarantineFile string) error {
+	if repeat < 0 {
+		return fmt.Errorf("repeat must be >= 0, got %v", repeat)
+	}
+
+	var keys []quarantineKey
+	if len(quarantineFile) > 0 {
+		var err error
+		keys, err = parseQuarantineFile(quarantineFile)
+		if err != nil {
+			return fmt.Errorf("quarantine file:%w", err)
+		}
+	}
+
+	count := 0
+	for filePath, testcases := range resource.HttpTestCases {
+		for _, tc := range testcases {
+			if tc.Repeat == 0 {
+				tc.Repeat = repeat
+			}
+			if quarantined(keys, filePath, tc.GetDeclaredID()) {
+				tc.Quarantine = true
+				count++
+			}
+		}
+	}
+	for filePath, testcases := range resource.GrpcTestCases {
+		for _, tc := range testcases {
+			if tc.Repeat == 0 {
+				tc.Repeat = repeat
+			}
+			if quarantined(keys, filePath, tc.GetDeclaredID()) {
+				tc.Quarantine = true
+				count++
+			}
+		}
+	}
+	if len(keys) > 0 {
+		slog.Info("quarantine file:%v, quarantined testcases:%v", quarantineFile, count)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestParseQuarantineFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.txt")
+	content := "# known flaky testcases\n\n/rules/a.yml:1\n b.yml : 2 \n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	keys, err := parseQuarantineFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []quarantineKey{{file: "/rules/a.yml", id: 1}, {file: "b.yml", id: 2}}, keys)
+
+	assert.NoError(t, os.WriteFile(path, []byte("a.yml\n"), 0644))
+	_, err = parseQuarantineFile(path)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte("a.yml:x\n"), 0644))
+	_, err = parseQuarantineFile(path)
+	assert.Error(t, err)
+}
+
+func TestApplyRunOptions(t *testing.T) {
+	restoreResource(t)
+	path := filepath.Join(t.TempDir(), "quarantine.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("a.yml:1\n/rules/b.yml:2\n"), 0644))
+
+	resource.HttpTestCases = map[string][]*config.TestCaseHttp{
+		"/rules/a.yml": {{ID: 1}, {ID: 2, Repeat: 5}},
+	}
+	resource.GrpcTestCases = map[string][]*config.TestCaseGrpc{
+		"/rules/b.yml": {{ID: 2001, ParentID: 2}, {ID: 3}},
+	}
+
+	assert.NoError(t, applyRunOptions(3, path))
+	httpCases := resource.HttpTestCases["/rules/a.yml"]
+	assert.True(t, httpCases[0].Quarantine)
+	assert.Equal(t, 3, httpCases[0].Repeat)
+	assert.False(t, httpCases[1].Quarantine)
+	// the repeat of the testcase is kept
+	assert.Equal(t, 5, httpCases[1].Repeat)
+	// the rows of a data-driven testcase are quarantined by its ID
+	grpcCases := resource.GrpcTestCases["/rules/b.yml"]
+	assert.True(t, grpcCases[0].Quarantine)
+	assert.False(t, grpcCases[1].Quarantine)
+
+	assert.Error(t, applyRunOptions(-1, ""))
+	assert.Error(t, applyRunOptions(0, filepath.Join(t.TempDir(), "missing.txt")))
+}
+
+func initFlakyTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestHttpTestCallableRepeat(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every other request to /flaky fails
+		if r.URL.Path == "/fail" || count.Add(1)%2 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	initFlakyTestResource(t)
+
+	newCallable := func(path string) *HttpTestCallable {
+		return &HttpTestCallable{
+			testcase: &config.TestCaseHttp{
+				ID:          1,
+				Repeat:      4,
+				Request:     config.RequestHttp{Method: "get", URL: server.URL + path},
+				VerifyRules: []rule.VerifyRule{&rule.HttpStatusEqualRule{Expected: http.StatusOK}},
+			},
+			stateGroup: model.NewStateGroup(),
+			vars:       &sync.Map{},
+		}
+	}
+
+	tcResult := newCallable("/flaky").Call(context.Background()).Value.(HttpTestCaseResult)
+	assert.Equal(t, model.StateFlaky, tcResult.State)
+	assert.Equal(t, model.ReasonFlaky, tcResult.Reason)
+	assert.Equal(t, 4, tcResult.Runs)
+	assert.Equal(t, 2, tcResult.PassedRuns)
+	assert.ErrorContains(t, tcResult.Error, "passed 2 of 4 runs")
+
+	result := newTestCaseResult("http", "/rules/a.yml", 1, 1, "", tcResult.State, tcResult.Reason,
+		tcResult.Error, tcResult.StartTime, tcResult.EndTime, tcResult.Trace)
+	assert.Equal(t, "flaky", result.Status)
+
+	// a testcase which always fails is not flaky
+	tcResult = newCallable("/fail").Call(context.Background()).Value.(HttpTestCaseResult)
+	assert.Equal(t, model.StateFailed, tcResult.State)
+	assert.Equal(t, 4, tcResult.Runs)
+	assert.Equal(t, 0, tcResult.PassedRuns)
+}
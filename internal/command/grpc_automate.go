@@ -3,14 +3,13 @@ package command
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/lianggaoqiang/progress"
 	"github.com/vearne/autotest/internal/config"
 	"github.com/vearne/autotest/internal/model"
 	"github.com/vearne/autotest/internal/resource"
@@ -21,7 +20,7 @@ import (
 	"go.uber.org/zap"
 )
 
-func GrpcAutomateTest(grpcTestCases map[string][]*config.TestCaseGrpc) *UnifiedTestResults {
+func GrpcAutomateTest(ctx context.Context, grpcTestCases map[string][]*config.TestCaseGrpc) *UnifiedTestResults {
 	total := 0
 	for _, testcases := range grpcTestCases {
 		total += len(testcases)
@@ -37,51 +36,63 @@ func GrpcAutomateTest(grpcTestCases map[string][]*config.TestCaseGrpc) *UnifiedT
 	parallelFiles := resource.GlobalConfig.Global.ParallelFiles
 
 	if parallelFiles {
-		return grpcParallelFiles(workerNum, grpcTestCases, total, begin)
+		return grpcParallelFiles(ctx, workerNum, grpcTestCases, total, begin)
 	}
-	return grpcSerialFiles(workerNum, grpcTestCases, total, begin)
+	return grpcSerialFiles(ctx, workerNum, grpcTestCases, total, begin)
 }
 
-func grpcSerialFiles(workerNum int, grpcTestCases map[string][]*config.TestCaseGrpc, total int, begin time.Time) *UnifiedTestResults {
+func grpcSerialFiles(ctx context.Context, workerNum int, grpcTestCases map[string][]*config.TestCaseGrpc, total int, begin time.Time) *UnifiedTestResults {
 	finishCount := 0
 	successCount := 0
 	failedCount := 0
+	skippedCount := 0
+	cancelledCount := 0
+	flakyCount := 0
 	var failedCases []string
+	var testCases []util.TestCaseResult
 
-	for filePath := range grpcTestCases {
+	for _, filePath := range ruleFileOrder(grpcTestCases, resource.GlobalConfig.GrpcRuleFiles) {
 		// if ignore_testcase_fail is false and some testcases have failed.
 		if resource.TerminationFlag.Load() {
 			break
 		}
 
-		info, tcResultList := HandleSingleFileGrpc(workerNum, filePath, &resource.CustomerVars, true)
+		info, tcResultList := HandleSingleFileGrpc(ctx, workerNum, filePath, &resource.CustomerVars, true)
 		finishCount += info.Total
 		successCount += info.SuccessCount
 		failedCount += info.FailedCount
+		skippedCount += info.SkippedCount
+		cancelledCount += info.CancelledCount
+		flakyCount += info.FlakyCount
 
 		// 收集失败用例信息
 		for _, tcResult := range tcResultList {
-			if tcResult.State != model.StateSuccessFul {
+			if tcResult.State == model.StateFailed {
 				failedCases = append(failedCases, fmt.Sprintf("GRPC_%d: %s", tcResult.ID, tcResult.Desc))
 			}
+			testCases = append(testCases, newGrpcCaseResult(filePath, tcResult))
 		}
 
-		slog.Info("GrpcTestCases, total:%v, finishCount:%v, successCount:%v, failedCount:%v",
-			total, finishCount, successCount, failedCount)
+		slog.Info("GrpcTestCases, total:%v, finishCount:%v, successCount:%v, failedCount:%v, skippedCount:%v",
+			total, finishCount, successCount, failedCount, skippedCount)
 		// generate report file (保留旧的报告生成作为备份)
 		GenReportFileGrpc(filePath, tcResultList, info)
 	}
 	slog.Info("[end]GrpcTestCases, total:%v, cost:%v", total, time.Since(begin))
 
 	return &UnifiedTestResults{
-		TotalTests:  finishCount,
-		PassedTests: successCount,
-		FailedTests: failedCount,
-		FailedCases: failedCases,
+		TotalTests:     finishCount,
+		PassedTests:    successCount,
+		FailedTests:    failedCount,
+		SkippedTests:   skippedCount,
+		CancelledTests: cancelledCount,
+		FlakyTests:     flakyCount,
+		FailedCases:    failedCases,
+		TestCases:      testCases,
 	}
 }
 
-func grpcParallelFiles(workerNum int, grpcTestCases map[string][]*config.TestCaseGrpc, total int, begin time.Time) *UnifiedTestResults {
+func grpcParallelFiles(ctx context.Context, workerNum int, grpcTestCases map[string][]*config.TestCaseGrpc, total int, begin time.Time) *UnifiedTestResults {
 	type fileResult struct {
 		filePath     string
 		info         *ResultInfo
@@ -90,11 +101,11 @@ func grpcParallelFiles(workerNum int, grpcTestCases map[string][]*config.TestCas
 
 	resultChan := make(chan fileResult, len(grpcTestCases))
 
-	for filePath := range grpcTestCases {
+	for _, filePath := range ruleFileOrder(grpcTestCases, resource.GlobalConfig.GrpcRuleFiles) {
 		go func(fp string) {
 			// 每个文件使用独立的 vars，避免并行时变量冲突
-			fileVars := &sync.Map{}
-			info, tcResultList := HandleSingleFileGrpc(workerNum, fp, fileVars, false)
+			fileVars := copyVars(&resource.CustomerVars)
+			info, tcResultList := HandleSingleFileGrpc(ctx, workerNum, fp, fileVars, false)
 			resultChan <- fileResult{filePath: fp, info: info, tcResultList: tcResultList}
 		}(filePath)
 	}
@@ -102,113 +113,139 @@ func grpcParallelFiles(workerNum int, grpcTestCases map[string][]*config.TestCas
 	finishCount := 0
 	successCount := 0
 	failedCount := 0
+	skippedCount := 0
+	cancelledCount := 0
+	flakyCount := 0
 	var failedCases []string
+	var testCases []util.TestCaseResult
 
 	for i := 0; i < len(grpcTestCases); i++ {
 		result := <-resultChan
 		finishCount += result.info.Total
 		successCount += result.info.SuccessCount
 		failedCount += result.info.FailedCount
+		skippedCount += result.info.SkippedCount
+		cancelledCount += result.info.CancelledCount
+		flakyCount += result.info.FlakyCount
 
 		// 收集失败用例信息
 		for _, tcResult := range result.tcResultList {
-			if tcResult.State != model.StateSuccessFul {
+			if tcResult.State == model.StateFailed {
 				failedCases = append(failedCases, fmt.Sprintf("GRPC_%d: %s", tcResult.ID, tcResult.Desc))
 			}
+			testCases = append(testCases, newGrpcCaseResult(result.filePath, tcResult))
 		}
 
-		slog.Info("GrpcTestCases[parallel], total:%v, finishCount:%v, successCount:%v, failedCount:%v",
-			total, finishCount, successCount, failedCount)
+		slog.Info("GrpcTestCases[parallel], total:%v, finishCount:%v, successCount:%v, failedCount:%v, skippedCount:%v",
+			total, finishCount, successCount, failedCount, skippedCount)
 		GenReportFileGrpc(result.filePath, result.tcResultList, result.info)
 	}
 	slog.Info("[end]GrpcTestCases[parallel], total:%v, cost:%v", total, time.Since(begin))
 
 	return &UnifiedTestResults{
-		TotalTests:  finishCount,
-		PassedTests: successCount,
-		FailedTests: failedCount,
-		FailedCases: failedCases,
+		TotalTests:     finishCount,
+		PassedTests:    successCount,
+		FailedTests:    failedCount,
+		SkippedTests:   skippedCount,
+		CancelledTests: cancelledCount,
+		FlakyTests:     flakyCount,
+		FailedCases:    failedCases,
+		TestCases:      testCases,
 	}
 }
 
-func HandleSingleFileGrpc(workerNum int, filePath string, vars *sync.Map, showProgress bool) (*ResultInfo, []GrpcTestCaseResult) {
+func HandleSingleFileGrpc(ctx context.Context, workerNum int, filePath string, vars *sync.Map, showProgress bool) (*ResultInfo, []GrpcTestCaseResult) {
 	workerNum = min(workerNum, 10)
 	testcases := resource.GrpcTestCases[filePath]
 	slog.Info("[start]HandleSingleFileGrpc, filePath:%v, len(testcase):%v", filePath, len(testcases))
+	// the run was cancelled, the rule file is not executed
+	if ctx.Err() != nil {
+		return cancelledGrpc(testcases)
+	}
 
-	futureChan := make(chan executor.Future, len(testcases))
-	pool := executor.NewFixedGPool(context.Background(), workerNum)
+	// teardown always runs, even if the setup or some testcases failed or the run was cancelled
+	hooks := resource.FileHooks[filePath]
+	defer func() {
+		//nolint: errcheck
+		runHooks(context.WithoutCancel(ctx), StageTeardown, hooks.Teardown, vars)
+	}()
+	err := runHooks(ctx, StageSetup, hooks.Setup, vars)
+	if err != nil {
+		if ctx.Err() != nil {
+			return cancelledGrpc(testcases)
+		}
+		return setupFailedGrpc(testcases, err)
+	}
+
+	futureChan := make(chan grpcPending, len(testcases))
+	pool := executor.NewFixedGPool(ctx, workerNum)
 	defer pool.WaitTerminate()
 
 	stateGroup := model.NewStateGroup()
 	for _, testcase := range testcases {
 		stateGroup.SetState(testcase.GetID(), model.StateNotExecuted)
+		if testcase.ParentID > 0 {
+			stateGroup.AddMember(testcase.ParentID, testcase.GetID())
+		}
 	}
 
 	// producer
 	go func() {
 		for i := 0; i < len(testcases); i++ {
-			tc := testcases[i]
-			f, err := pool.Submit(&GrpcTestCallable{testcase: tc, stateGroup: stateGroup, vars: vars})
-			if err != nil {
-				zaplog.Error("pool.Submit", zap.Any("testcase", tc), zap.Error(err))
-			}
-			futureChan <- f
+			futureChan <- submitGrpc(ctx, pool, testcases[i], stateGroup, vars)
 		}
 	}()
 
-	var bar *progress.DefaultBar
-	var p *progress.Progress
+	var bar *util.ProgressBar
 	if showProgress {
-		p = progress.Start()
-		bar = progress.NewBar().Custom(
-			progress.BarSetting{
-				StartText:       "[",
-				EndText:         "]",
-				PassedText:      "-",
-				FirstPassedText: ">",
-				NotPassedText:   "=",
-			},
-		)
-		p.AddBar(bar)
+		bar = util.NewProgressBar(os.Stdout)
 	}
 
 	finishCount := 0
 	successCount := 0
 	failedCount := 0
+	skippedCount := 0
+	cancelledCount := 0
+	flakyCount := 0
 
 	var tcResultList []GrpcTestCaseResult
-	for future := range futureChan {
-		gResult := future.Get()
-		tcResult := gResult.Value.(GrpcTestCaseResult)
-		zaplog.Debug("future.Get", zap.Any("tcResult", tcResult))
+	for pending := range futureChan {
+		tcResult := pending.result()
+		zaplog.Debug("future.Get", maskedField("tcResult", tcResult))
 
 		if tcResult.State == model.StateNotExecuted {
 			time.Sleep(200 * time.Millisecond)
 			// wait for a while
-			f, err := pool.Submit(&GrpcTestCallable{testcase: tcResult.TestCase, stateGroup: stateGroup, vars: vars})
-			if err != nil {
-				zaplog.Error("pool.Submit", zap.Any("testcase", tcResult.TestCase), zap.Error(err))
-			} else {
-				futureChan <- f
-			}
+			futureChan <- submitGrpc(ctx, pool, tcResult.TestCase, stateGroup, vars)
 			continue
 		}
 
-		if tcResult.State == model.StateSuccessFul {
+		terminate := false
+		switch tcResult.State {
+		case model.StateSuccessFul:
 			successCount++
-		} else {
+		case model.StateSkipped:
+			skippedCount++
+		case model.StateCancelled:
+			cancelledCount++
+		case model.StateFlaky:
+			flakyCount++
+		default:
 			failedCount++
-			// terminate subsequent testcases
-			if !resource.GlobalConfig.Global.IgnoreTestCaseFail {
+			// terminate subsequent testcases, unless the testcase is quarantined
+			if !resource.GlobalConfig.Global.IgnoreTestCaseFail && !tcResult.TestCase.Quarantine {
 				resource.TerminationFlag.Store(true)
-				break
+				terminate = true
 			}
 		}
 
 		stateGroup.SetState(tcResult.ID, tcResult.State)
 		// prepare to write report
 		tcResultList = append(tcResultList, tcResult)
+		if terminate {
+			finishCount++
+			break
+		}
 
 		// process the variables generated when testcase is run
 		for key, value := range tcResult.KeyValues {
@@ -217,9 +254,6 @@ func HandleSingleFileGrpc(workerNum int, filePath string, vars *sync.Map, showPr
 
 		finishCount++
 		if showProgress {
-			// process bar will override this line.
-			fmt.Println()
-			//nolint: errcheck
 			bar.Percent(float64(finishCount) / float64(len(testcases)) * 100)
 		}
 		if finishCount >= len(testcases) {
@@ -229,13 +263,65 @@ func HandleSingleFileGrpc(workerNum int, filePath string, vars *sync.Map, showPr
 	}
 	slog.Info("[end]HandleSingleFile, filePath:%v", filePath)
 	return &ResultInfo{Total: finishCount, SuccessCount: successCount,
-		FailedCount: failedCount}, tcResultList
+		FailedCount: failedCount, SkippedCount: skippedCount, CancelledCount: cancelledCount, FlakyCount: flakyCount}, tcResultList
+}
+
+// grpcPending is a testcase submitted to the pool
+type grpcPending struct {
+	future   executor.Future
+	testcase *config.TestCaseGrpc
+}
+
+// result waits for the testcase, a testcase that was not submitted or was interrupted is cancelled
+func (p grpcPending) result() GrpcTestCaseResult {
+	if p.future != nil {
+		if tcResult, ok := p.future.Get().Value.(GrpcTestCaseResult); ok {
+			return tcResult
+		}
+	}
+	return cancelledGrpcResult(p.testcase)
+}
+
+func submitGrpc(ctx context.Context, pool executor.ExecutorService, tc *config.TestCaseGrpc,
+	stateGroup *model.StateGroup, vars *sync.Map) grpcPending {
+	// stop submitting testcases once the run was cancelled
+	if ctx.Err() != nil {
+		return grpcPending{testcase: tc}
+	}
+	f, err := pool.Submit(&GrpcTestCallable{testcase: tc, stateGroup: stateGroup, vars: vars})
+	if err != nil {
+		zaplog.Error("pool.Submit", zap.Any("testcase", tc), zap.Error(err))
+		return grpcPending{testcase: tc}
+	}
+	return grpcPending{future: f, testcase: tc}
+}
+
+func cancelledGrpcResult(tc *config.TestCaseGrpc) GrpcTestCaseResult {
+	now := time.Now()
+	return GrpcTestCaseResult{
+		ID:        tc.ID,
+		Desc:      tc.Desc,
+		State:     model.StateCancelled,
+		Reason:    model.ReasonCancelled,
+		TestCase:  tc,
+		KeyValues: map[string]any{},
+		StartTime: now,
+		EndTime:   now,
+	}
+}
+
+// cancelledGrpc marks all the testcases of the file as cancelled
+func cancelledGrpc(testcases []*config.TestCaseGrpc) (*ResultInfo, []GrpcTestCaseResult) {
+	tcResultList := make([]GrpcTestCaseResult, 0, len(testcases))
+	for _, tc := range testcases {
+		tcResultList = append(tcResultList, cancelledGrpcResult(tc))
+	}
+	return &ResultInfo{Total: len(testcases), CancelledCount: len(testcases)}, tcResultList
 }
 
 func GenReportFileGrpc(testCasefilePath string, tcResultList []GrpcTestCaseResult, info *ResultInfo) {
-	filename := filepath.Base(testCasefilePath)
-	name := strings.TrimSuffix(filename, filepath.Ext(filename))
-	filename = name + ".csv"
+	name := util.FileReportName(testCasefilePath)
+	filename := name + ".csv"
 
 	reportDirPath := resource.GlobalConfig.Global.Report.DirPath
 	reportPath := filepath.Join(reportDirPath, filename)
@@ -251,17 +337,17 @@ func GenReportFileGrpc(testCasefilePath string, tcResultList []GrpcTestCaseResul
 			reasonStr = ""
 		}
 		records = append(records, []string{strconv.Itoa(int(item.ID)),
-			item.Desc, item.State.String(), reasonStr})
+			resource.SecretMasker.Mask(item.Desc), item.State.String(), reasonStr})
 	}
 	util.WriterCSV(reportPath, records)
 	// 2. html file
-	dirName := util.MD5(reportDirPath + name)
+	dirName := util.CaseDetailDir(reportDirPath, testCasefilePath)
 
 	var caseResults []CaseShow
 	for _, item := range tcResultList {
-		caseResults = append(caseResults, CaseShow{ID: item.ID, Description: item.Desc,
+		caseResults = append(caseResults, CaseShow{ID: item.ID, Description: resource.SecretMasker.Mask(item.Desc),
 			State: item.State.String(), Reason: item.Reason.String(),
-			Link: fmt.Sprintf("./%v/%v.html", dirName, item.ID)})
+			Link: util.CaseDetailLink(reportDirPath, testCasefilePath, item.ID)})
 	}
 	obj := map[string]any{
 		"info":         info,
@@ -277,9 +363,13 @@ func GenReportFileGrpc(testCasefilePath string, tcResultList []GrpcTestCaseResul
 	// case file
 	for _, item := range tcResultList {
 		data := map[string]any{
-			"Error":      item.Error,
-			"reqDetail":  item.ReqDetail(),
-			"respDetail": item.RespDetail(),
+			"title":      fmt.Sprintf("GRPC_%d: %s", item.ID, resource.SecretMasker.Mask(item.Desc)),
+			"fileLink":   "../" + name + ".html",
+			"reportLink": unifiedHTMLReportLink(),
+			"Error":      maskedError(item.Error),
+			"reqDetail":  resource.SecretMasker.Mask(item.ReqDetail()),
+			"respDetail": resource.SecretMasker.Mask(item.RespDetail()),
+			"repro":      resource.SecretMasker.Mask(item.ReproCommand()),
 		}
 		err := RenderTpl(mytpl, "template/case.tpl", data,
 			filepath.Join(reportDirPath, dirName, strconv.Itoa(int(item.ID))+".html"))
@@ -290,3 +380,47 @@ func GenReportFileGrpc(testCasefilePath string, tcResultList []GrpcTestCaseResul
 	}
 	slog.Info("write report:%v", reportDirPath)
 }
+
+// setupFailedGrpc marks all the testcases of the file as failed
+func setupFailedGrpc(testcases []*config.TestCaseGrpc, err error) (*ResultInfo, []GrpcTestCaseResult) {
+	now := time.Now()
+	tcResultList := make([]GrpcTestCaseResult, 0, len(testcases))
+	for _, tc := range testcases {
+		tcResultList = append(tcResultList, GrpcTestCaseResult{
+			ID:        tc.ID,
+			Desc:      tc.Desc,
+			State:     model.StateFailed,
+			Reason:    model.ReasonSetupFailed,
+			TestCase:  tc,
+			KeyValues: map[string]any{},
+			Error:     err,
+			StartTime: now,
+			EndTime:   now,
+		})
+	}
+	if !resource.GlobalConfig.Global.IgnoreTestCaseFail {
+		resource.TerminationFlag.Store(true)
+	}
+	return &ResultInfo{Total: len(testcases), FailedCount: len(testcases)}, tcResultList
+}
+
+// newGrpcCaseResult converts the result of a grpc testcase for the unified reports
+func newGrpcCaseResult(filePath string, tcResult GrpcTestCaseResult) util.TestCaseResult {
+	result := newTestCaseResult("grpc", filePath, tcResult.TestCase.Line,
+		tcResult.ID, tcResult.Desc, tcResult.State, tcResult.Reason, tcResult.Error,
+		tcResult.StartTime, tcResult.EndTime, tcResult.Trace)
+	result.Quarantined = tcResult.TestCase.Quarantine
+	result.Tags = tcResult.TestCase.Tags
+	if len(tcResult.Steps) > 0 {
+		result.Steps = tcResult.Steps
+		result.RequestDetail = tcResult.ReqDetail()
+		result.ResponseDetail = tcResult.RespDetail()
+		result.Repro = tcResult.ReproCommand()
+	}
+	result.Mismatch = tcResult.Mismatch
+	if tcResult.Runs > 1 {
+		result.Runs = tcResult.Runs
+		result.PassedRuns = tcResult.PassedRuns
+	}
+	return result
+}
@@ -11,6 +11,7 @@ import (
 
 	// ignore SA1019 we have to import this because it appears in exported API
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -21,12 +22,14 @@ import (
 	"github.com/vearne/autotest/internal/config"
 	"github.com/vearne/autotest/internal/model"
 	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
 	"github.com/vearne/autotest/internal/util"
 	"github.com/vearne/executor"
 	slog "github.com/vearne/simplelog"
 	"github.com/vearne/zaplog"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
@@ -41,7 +44,17 @@ type GrpcTestCaseResult struct {
 	TestCase  *config.TestCaseGrpc
 	KeyValues map[string]any
 	Error     error
+	StartTime time.Time
+	EndTime   time.Time
 	Response  *model.GrpcResp
+	Trace     RequestTrace
+	// runs of a repeated testcase, and how many of them passed
+	Runs       int
+	PassedRuns int
+	// steps of the last run
+	Steps []util.CaseStep
+	// the verify rule which failed in the last run
+	Mismatch *rule.Mismatch
 }
 
 func (t *GrpcTestCaseResult) ReqDetail() string {
@@ -53,7 +66,7 @@ func (t *GrpcTestCaseResult) ReqDetail() string {
 		fmt.Fprintf(&builder, "%v\n", item)
 	}
 	builder.WriteString("BODY:\n")
-	fmt.Fprintf(&builder, "%v\n", t.Request.Body)
+	fmt.Fprintf(&builder, "%v\n", util.PrettyJSON(t.Request.Body))
 	return builder.String()
 }
 
@@ -70,7 +83,7 @@ func (t *GrpcTestCaseResult) RespDetail() string {
 		fmt.Fprintf(&builder, "%v\n", item)
 	}
 	builder.WriteString("BODY:\n")
-	fmt.Fprintf(&builder, "%v\n", t.Response.Body)
+	fmt.Fprintf(&builder, "%v\n", util.PrettyJSON(t.Response.Body))
 	return builder.String()
 }
 
@@ -82,15 +95,6 @@ type GrpcTestCallable struct {
 
 func (m *GrpcTestCallable) Call(ctx context.Context) *executor.GPResult {
 	r := executor.GPResult{}
-	var cc *grpc.ClientConn
-	var rf grpcurl.RequestParser
-	var formatter grpcurl.Formatter
-	var in *strings.Reader
-	var req config.RequestGrpc
-	var timeout time.Duration
-	var rCtx context.Context
-	var cancel context.CancelFunc
-	var handler *EventHandler
 	var err error
 
 	tcResult := GrpcTestCaseResult{
@@ -102,6 +106,25 @@ func (m *GrpcTestCallable) Call(ctx context.Context) *executor.GPResult {
 		KeyValues: map[string]any{},
 	}
 
+	tcResult.StartTime = time.Now()
+	defer func() {
+		// r.Value holds a copy of tcResult
+		if result, ok := r.Value.(GrpcTestCaseResult); ok {
+			result.EndTime = time.Now()
+			r.Value = result
+		}
+	}()
+
+	// 0. the run was cancelled
+	if ctx.Err() != nil {
+		tcResult.State = model.StateCancelled
+		tcResult.Reason = model.ReasonCancelled
+		tcResult.Error = ctx.Err()
+		r.Value = tcResult
+		r.Err = nil
+		return &r
+	}
+
 	// 1. Check other test cases of dependencies
 	for _, id := range m.testcase.DependOnIDs {
 		if m.stateGroup.GetState(id) == model.StateNotExecuted { // a certain dependency is not yet completed
@@ -111,114 +134,158 @@ func (m *GrpcTestCallable) Call(ctx context.Context) *executor.GPResult {
 			r.Err = nil
 			return &r
 		} else if m.stateGroup.GetState(id) == model.StateFailed {
-			tcResult.State = model.StateFailed
+			tcResult.State = model.StateSkipped
 			tcResult.Reason = model.ReasonDependentItemFailed
 			r.Value = tcResult
 			r.Err = nil
 			return &r
+		} else if m.stateGroup.GetState(id) == model.StateSkipped {
+			tcResult.State = model.StateSkipped
+			tcResult.Reason = model.ReasonDependentItemSkipped
+			r.Value = tcResult
+			r.Err = nil
+			return &r
+		} else if m.stateGroup.GetState(id) == model.StateCancelled {
+			tcResult.State = model.StateCancelled
+			tcResult.Reason = model.ReasonCancelled
+			r.Value = tcResult
+			r.Err = nil
+			return &r
 		}
 	}
 
-	// 2. deal delay
-	if m.testcase.Delay > 0 {
-		zaplog.Debug("sleep", zap.Any("delay", m.testcase.Delay))
-		time.Sleep(m.testcase.Delay)
-	}
-
-	// 3. render
-	zaplog.Info("before render()", zap.Uint64("testCaseId", m.testcase.ID),
-		zap.Any("request", m.testcase.Request))
-	req, err = renderRequestGrpcWithVars(m.testcase.Request, m.vars)
-	tcResult.Request = req
-	zaplog.Info("after render()", zap.Uint64("testCaseId", m.testcase.ID),
-		zap.Any("request", tcResult.Request))
+	// 1.5 skip, evaluated against the environment and exported variables
+	skip, reason, err := shouldSkip(m.testcase.Skip, m.testcase.SkipIf, m.testcase.LuaSkipIf,
+		m.vars, m.testcase.RowVars)
 	if err != nil {
 		tcResult.State = model.StateFailed
-		tcResult.Reason = model.ReasonTemplateRenderError
+		tcResult.Reason = reason
 		tcResult.Error = err
 		r.Value = tcResult
 		r.Err = err
 		return &r
 	}
-
-	// 4. get description source
-	options := grpcurl.FormatOptions{
-		EmitJSONDefaultFields: true,
-		IncludeTextSeparator:  true,
-		AllowUnknownFields:    true,
+	if skip {
+		tcResult.State = model.StateSkipped
+		tcResult.Reason = reason
+		r.Value = tcResult
+		r.Err = nil
+		return &r
 	}
 
-	reqInfo := tcResult.Request
-	descSource, err := getDescSourceWitchCache(ctx, reqInfo.Address)
-	if err != nil {
-		zaplog.Error("GrpcTestCallable-get desc source",
-			zap.Uint64("testCaseId", m.testcase.ID),
-			zap.String("address", reqInfo.Address),
-			zap.Error(err),
-		)
-		goto ERROR
+	// 2-6. run the testcase, a repeated testcase is flaky if only some of the runs passed
+	var failure GrpcTestCaseResult
+	for i := 0; i < max(m.testcase.Repeat, 1); i++ {
+		r.Err = m.runOnce(ctx, &tcResult)
+		if tcResult.State == model.StateCancelled {
+			break
+		}
+		tcResult.Runs++
+		if tcResult.State == model.StateSuccessFul {
+			tcResult.PassedRuns++
+			continue
+		}
+		failure = tcResult
+		// rendering the request fails the same way every time
+		if tcResult.Reason == model.ReasonTemplateRenderError {
+			break
+		}
 	}
-
-	cc, err = dial(reqInfo.Address)
-	if err != nil {
-		zaplog.Error("GrpcTestCallable-dial",
-			zap.Uint64("testCaseId", m.testcase.ID),
-			zap.String("address", reqInfo.Address),
-			zap.Error(err),
-		)
-		goto ERROR
+	if tcResult.State != model.StateCancelled && tcResult.PassedRuns > 0 && tcResult.PassedRuns < tcResult.Runs {
+		tcResult.State = model.StateFlaky
+		tcResult.Reason = model.ReasonFlaky
+		tcResult.Error = flakyError(tcResult.PassedRuns, tcResult.Runs, failure.Reason, failure.Error)
 	}
+	r.Value = tcResult
+	return &r
+}
 
-	// 5. timeout
-	timeout = resource.GlobalConfig.Global.RequestTimeout
-	rCtx, cancel = context.WithTimeout(ctx, timeout)
-	defer cancel()
+// runOnce sends the request of the testcase and verifies the response,
+// the state and the details of the run are written to tcResult
+func (m *GrpcTestCallable) runOnce(ctx context.Context, tcResult *GrpcTestCaseResult) error {
+	var req config.RequestGrpc
+	var resp *model.GrpcResp
+	var err, verifyErr error
+	var start time.Time
+	var failedRule rule.VerifyRuleGrpc
+
+	tcResult.State = model.StateSuccessFul
+	tcResult.Reason = model.ReasonSuccess
+	tcResult.Error = nil
+	tcResult.Response = nil
+	tcResult.Steps = nil
+	tcResult.Mismatch = nil
+
+	// 2. deal delay
+	if m.testcase.Delay > 0 {
+		zaplog.Debug("sleep", zap.Any("delay", m.testcase.Delay))
+		select {
+		case <-time.After(m.testcase.Delay):
+		case <-ctx.Done():
+			tcResult.State = model.StateCancelled
+			tcResult.Reason = model.ReasonCancelled
+			tcResult.Error = ctx.Err()
+			return nil
+		}
+	}
 
-	// 6. trigger remote request with rate limiting
-	in = strings.NewReader(reqInfo.Body)
-	rf, formatter, err = grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, descSource, in, options)
+	// 3. render
+	zaplog.Info("before render()", zap.Uint64("testCaseId", m.testcase.ID),
+		zap.Any("request", m.testcase.Request))
+	start = time.Now()
+	req, err = renderRequestGrpcWithVars(m.testcase.Request, m.vars, m.testcase.RowVars)
+	tcResult.Request = req
+	tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepRender, start, err))
+	zaplog.Info("after render()", zap.Uint64("testCaseId", m.testcase.ID),
+		maskedField("request", tcResult.Request))
 	if err != nil {
-		zaplog.Error("GrpcTestCallable-RequestParserAndFormatter",
-			zap.Uint64("testCaseId", m.testcase.ID),
-			zap.String("address", reqInfo.Address),
-			zap.Error(err),
-		)
-		goto ERROR
+		tcResult.State = model.StateFailed
+		tcResult.Reason = model.ReasonTemplateRenderError
+		tcResult.Error = err
+		return err
 	}
-	handler = NewEventHandler(formatter)
 
-	// 使用限流器和重试机制控制gRPC请求的并发、速率和稳定性
-	err = resource.RateLimiter.ExecuteWithLimit(rCtx, func() error {
-		return util.ExecuteGrpcWithRetry(rCtx, resource.GlobalConfig, func() error {
-			return grpcurl.InvokeRPC(rCtx, descSource, cc, reqInfo.Symbol, reqInfo.Headers, handler, rf.Next)
-		})
-	})
+	// 4. trigger remote request with timeout and rate limiting
+	start = time.Now()
+	resp, tcResult.Trace, err = invokeGrpc(ctx, tcResult.Request, newRequestOptions(m.testcase.RequestOptions))
+	tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepRequest, start, err))
 	if err != nil {
-		zaplog.Error("GrpcTestCallable-invokeRPC",
+		zaplog.Error("GrpcTestCallable-invokeGrpc",
 			zap.Uint64("testCaseId", m.testcase.ID),
-			zap.String("address", reqInfo.Address),
-			zap.Error(err),
+			zap.String("address", resource.SecretMasker.Mask(tcResult.Request.Address)),
+			zap.String("error", maskedError(err)),
 		)
 		goto ERROR
 	}
 
-	tcResult.Response = &handler.resp
-
-	if resource.GlobalConfig.Global.Debug {
-		debugPrint(reqInfo, handler.resp)
-	}
+	tcResult.Response = resp
 
-	// 8. export
+	// 5. export
 	if m.testcase.Export != nil {
 		exportConfig := m.testcase.Export
-		// TODO handle error
-		value, _ := exportTo(handler.resp.Body, exportConfig)
+		start = time.Now()
+		value, err := exportTo(resp.Body, rule.FormatJSON, exportConfig)
+		tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepExport, start, err))
+		if err != nil {
+			// the testcases driven by the variable would run with a wrong value
+			zaplog.Error("GrpcTestCallable export failed",
+				zap.Uint64("testCaseId", m.testcase.ID),
+				zap.String("exportTo", exportConfig.ExportTo),
+				zap.String("error", maskedError(err)))
+			delete(tcResult.KeyValues, exportConfig.ExportTo)
+			tcResult.State = model.StateFailed
+			tcResult.Reason = model.ReasonExportFailed
+			tcResult.Error = fmt.Errorf("export %v, %w", exportConfig.ExportTo, err)
+			return tcResult.Error
+		}
 		tcResult.KeyValues[exportConfig.ExportTo] = value
+		resource.SecretMasker.Track(exportConfig.ExportTo, value)
 	}
 
-	// 9. verify
+	// 6. verify
+	start = time.Now()
 	for idx, rule := range m.testcase.VerifyRules {
-		VerifyResult := rule.Verify(&handler.resp)
+		VerifyResult := rule.Verify(resp)
 		if !VerifyResult {
 			zaplog.Error("GrpcTestCallable rules validate failed",
 				zap.Uint64("testCaseId", m.testcase.ID),
@@ -227,33 +294,106 @@ func (m *GrpcTestCallable) Call(ctx context.Context) *executor.GPResult {
 
 			tcResult.State = model.StateFailed
 			tcResult.Reason = model.ReasonRuleVerifyFailed
+			verifyErr = fmt.Errorf("verify rule #%d failed", idx+1)
+			failedRule = rule
 			break
 		}
 	}
-	r.Value = tcResult
-	r.Err = nil
-	return &r
+	if failedRule != nil {
+		mismatch := rule.ExplainGrpc(failedRule, resp)
+		tcResult.Mismatch = &mismatch
+		verifyErr = fmt.Errorf("%w, %v expected:%v, actual:%v", verifyErr, mismatch.Rule, mismatch.Expected, mismatch.Actual)
+	}
+	tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepVerify, start, verifyErr))
+	return nil
 
 ERROR:
 	tcResult.State = model.StateFailed
 	tcResult.Reason = model.ReasonRequestFailed
+	// the in-flight request was interrupted
+	if ctx.Err() != nil {
+		tcResult.State = model.StateCancelled
+		tcResult.Reason = model.ReasonCancelled
+	}
 	tcResult.Error = err
-	r.Value = tcResult
-	r.Err = err
-	return &r
+	return err
 }
 
-func renderRequestGrpcWithVars(req config.RequestGrpc, vars *sync.Map) (config.RequestGrpc, error) {
+// invokeGrpc sends the rendered request with timeout, rate limiting and retry
+func invokeGrpc(ctx context.Context, reqInfo config.RequestGrpc,
+	opts requestOptions) (*model.GrpcResp, RequestTrace, error) {
+	options := grpcurl.FormatOptions{
+		EmitJSONDefaultFields: true,
+		IncludeTextSeparator:  true,
+		AllowUnknownFields:    true,
+	}
+
+	// the timeout covers the connection setup as well
+	rCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+
+	var handler *EventHandler
+	var trace RequestTrace
+	// 使用限流器和重试机制控制gRPC请求的并发、速率和稳定性
+	begin := time.Now()
+	err := opts.limiterFor(reqInfo.Address).ExecuteWithLimit(rCtx, func() error {
+		trace.LimiterWait = time.Since(begin)
+		var err error
+		trace.Attempts, err = util.ExecuteGrpcWithRetry(rCtx, opts.retry, func() error {
+			// an unreachable server is retried like an Unavailable response
+			descSource, err := getDescSourceWitchCache(rCtx, reqInfo.Address)
+			if err != nil {
+				return err
+			}
+			cc, err := dial(rCtx, reqInfo.Address)
+			if err != nil {
+				return err
+			}
+			defer cc.Close()
+
+			// the request parser consumes the body, every attempt needs a new one
+			in := strings.NewReader(reqInfo.Body)
+			rf, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, descSource, in, options)
+			if err != nil {
+				// an invalid request is not retried
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+			handler = NewEventHandler(formatter)
+			err = grpcurl.InvokeRPC(rCtx, descSource, cc, reqInfo.Symbol, reqInfo.Headers, handler, rf.Next)
+			if err == nil && opts.retry.RetryOnGrpcCode(handler.code) {
+				return &util.RetryableStatusError{Status: handler.resp.Code, RetryAfter: handler.retryAfter}
+			}
+			return err
+		})
+		return err
+	})
+	if err != nil {
+		if trace.Attempts == nil {
+			// the request never got through the rate limiter
+			trace.LimiterWait = time.Since(begin)
+		}
+		return nil, trace, err
+	}
+
+	if resource.GlobalConfig.Global.Debug {
+		debugPrint(reqInfo, handler.resp)
+	}
+	return &handler.resp, trace, nil
+}
+
+func renderRequestGrpcWithVars(req config.RequestGrpc, vars *sync.Map,
+	rowVars map[string]any) (config.RequestGrpc, error) {
 	var err error
 	// address
-	req.Address, err = templateRenderWithVars(req.Address, vars)
+	req.Address, err = templateRenderWithVars(req.Address, vars, rowVars)
 	if err != nil {
 		return req, err
 	}
 
-	// headers
+	// headers, the slice is shared with the testcase
+	req.Headers = slices.Clone(req.Headers)
 	for i := 0; i < len(req.Headers); i++ {
-		req.Headers[i], err = templateRenderWithVars(req.Headers[i], vars)
+		req.Headers[i], err = templateRenderWithVars(req.Headers[i], vars, rowVars)
 		if err != nil {
 			return req, err
 		}
@@ -272,12 +412,12 @@ func renderRequestGrpcWithVars(req config.RequestGrpc, vars *sync.Map) (config.R
 		if err != nil {
 			zaplog.Error("renderRequestGrpc-luaBody",
 				zap.String("LuaStr", req.LuaBody),
-				zap.Error(err))
+				zap.String("error", maskedError(err)))
 			return req, err
 		}
 		req.Body = value.String()
 	} else {
-		req.Body, err = templateRenderWithVars(req.Body, vars)
+		req.Body, err = templateRenderWithVars(req.Body, vars, rowVars)
 		if err != nil {
 			return req, err
 		}
@@ -298,19 +438,20 @@ func getDescSourceWitchCache(ctx context.Context, address string) (grpcurl.Descr
 
 	// 缓存未命中，获取新的描述符
 	v, err, _ := resource.SingleFlightGroup.Do(address, func() (interface{}, error) {
-		md := grpcurl.MetadataFromHeaders([]string{})
-		refCtx := metadata.NewOutgoingContext(ctx, md)
-		cc, dialErr := dial(address)
+		cc, dialErr := dial(ctx, address)
 		if dialErr != nil {
 			return nil, dialErr
 		}
-		refClient := grpcreflect.NewClientAuto(refCtx, cc)
+		// the descriptor source is cached, its reflection stream outlives the request
+		refCtx := context.WithoutCancel(ctx)
+		md := grpcurl.MetadataFromHeaders([]string{})
+		refClient := grpcreflect.NewClientAuto(metadata.NewOutgoingContext(refCtx, md), cc)
 		refClient.AllowMissingFileDescriptors()
-		descSource := grpcurl.DescriptorSourceFromServer(ctx, refClient)
+		descSource := grpcurl.DescriptorSourceFromServer(refCtx, refClient)
 		return descSource, nil
 	})
 	if err != nil {
-		zaplog.Error("getDescSourceWitchCache", zap.Error(err))
+		zaplog.Error("getDescSourceWitchCache", zap.String("error", maskedError(err)))
 		return nil, err
 	}
 
@@ -320,11 +461,16 @@ func getDescSourceWitchCache(ctx context.Context, address string) (grpcurl.Descr
 	return s, err
 }
 
-func dial(target string) (*grpc.ClientConn, error) {
+// dial connects to the target until ctx is done,
+// a connection error is reported as Unavailable so that it can be retried
+func dial(ctx context.Context, target string) (*grpc.ClientConn, error) {
 	var opts []grpc.DialOption
 	network := "tcp"
-	cc, err := grpcurl.BlockingDial(context.Background(), network, target, nil, opts...)
+	cc, err := grpcurl.BlockingDial(ctx, network, target, nil, opts...)
 	if err != nil {
+		if ctx.Err() == nil {
+			err = status.Error(codes.Unavailable, err.Error())
+		}
 		return nil, err
 	}
 	return cc, nil
@@ -353,12 +499,15 @@ func debugPrint(reqInfo config.RequestGrpc, resp model.GrpcResp) {
 	fmt.Fprintln(&b, "BODY\t:")
 	fmt.Fprintln(&b, resp.Body)
 
-	os.Stderr.WriteString(b.String())
+	os.Stderr.WriteString(resource.SecretMasker.Mask(b.String()))
 }
 
 type EventHandler struct {
 	resp      model.GrpcResp
+	code      codes.Code
 	formatter grpcurl.Formatter
+	// retry delay given by google.rpc.RetryInfo in the status details
+	retryAfter time.Duration
 }
 
 func NewEventHandler(formatter grpcurl.Formatter) *EventHandler {
@@ -395,6 +544,8 @@ func (m *EventHandler) OnReceiveTrailers(status *status.Status, md metadata.MD)
 			m.resp.Headers = append(m.resp.Headers, fmt.Sprintf("%v:%v", key, value))
 		}
 	}
+	m.code = status.Code()
+	m.retryAfter = util.GrpcRetryDelay(status)
 	m.resp.Code = status.Code().String()
 	m.resp.Message = status.Message()
 }
@@ -0,0 +1,64 @@
+package command
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+// initGrpcCallTestResource sets the resources used by invokeGrpc
+func initGrpcCallTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.CacheManager = util.NewCacheManager(config.AutoTestConfig{})
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+}
+
+func TestInvokeGrpcDialTimeout(t *testing.T) {
+	initGrpcCallTestResource(t)
+	// accepts the connection, but never answers the HTTP/2 handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	opts := requestOptions{timeout: 200 * time.Millisecond, limiter: resource.RateLimiter,
+		retry: util.RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond}}
+	begin := time.Now()
+	_, trace, err := invokeGrpc(context.Background(),
+		config.RequestGrpc{Address: ln.Addr().String(), Symbol: "Greeter/SayHello"}, opts)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(begin), 2*time.Second)
+	// the timeout is not retried
+	assert.Len(t, trace.Attempts, 1)
+}
+
+func TestInvokeGrpcDialRetry(t *testing.T) {
+	initGrpcCallTestResource(t)
+	// nothing listens on the address
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := ln.Addr().String()
+	ln.Close()
+
+	opts := requestOptions{timeout: 5 * time.Second, limiter: resource.RateLimiter,
+		retry: util.RetryPolicy{MaxAttempts: 2, Delay: time.Millisecond}}
+	_, trace, err := invokeGrpc(context.Background(),
+		config.RequestGrpc{Address: address, Symbol: "Greeter/SayHello"}, opts)
+	assert.ErrorContains(t, err, "gRPC request failed after 2 attempts")
+	assert.Len(t, trace.Attempts, 2)
+	assert.Contains(t, trace.Attempts[0].Error, "Unavailable")
+}
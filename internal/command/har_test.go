@@ -0,0 +1,97 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func initHarTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestHttpTestCallableHar(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "application/json")
+		if count.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte(`{"id": 1}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	initHarTestResource(t)
+
+	var cfg config.AutoTestConfig
+	cfg.Global.Report.DirPath = t.TempDir()
+	cfg.Global.Report.Formats = []string{"har"}
+	cfg.Global.Report.HarRedactHeaders = []string{"X-Api-Key"}
+	generator := util.NewReportGenerator(cfg)
+	resource.HarRecorder = generator.HarRecorder()
+
+	callable := &HttpTestCallable{
+		filePath: "/rules/book.yml",
+		testcase: &config.TestCaseHttp{
+			ID:   1,
+			Desc: "add book",
+			Request: config.RequestHttp{Method: "post", URL: server.URL + "/books?lang=go", Body: `{"title": "Go"}`,
+				Headers: []string{"Authorization: Bearer t", "X-Api-Key: k", "Content-Type: application/json"}},
+			RequestOptions: config.RequestOptions{
+				Retry: &config.Retry{MaxAttempts: 2, Delay: time.Millisecond, StatusCodes: []int{503}}},
+		},
+		stateGroup: model.NewStateGroup(),
+		vars:       &sync.Map{},
+	}
+	tcResult := callable.Call(context.Background()).Value.(HttpTestCaseResult)
+	assert.Equal(t, model.StateSuccessFul, tcResult.State)
+	assert.NoError(t, generator.GenerateReports(util.ReportData{}))
+
+	b, err := os.ReadFile(filepath.Join(cfg.Global.Report.DirPath, util.HarFile))
+	assert.NoError(t, err)
+	var har struct {
+		Log util.HarLog `json:"log"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &har))
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Len(t, har.Log.Pages, 1)
+	assert.Equal(t, "http:/rules/book.yml:1", har.Log.Pages[0].ID)
+	assert.Equal(t, "HTTP_1: add book", har.Log.Pages[0].Title)
+
+	// every attempt is an entry
+	entries := har.Log.Entries
+	assert.Len(t, entries, 2)
+	assert.Equal(t, []int{1, 2}, []int{entries[0].Attempt, entries[1].Attempt})
+	assert.Equal(t, []int{503, 200}, []int{entries[0].Response.Status, entries[1].Response.Status})
+	for _, entry := range entries {
+		assert.Equal(t, "http:/rules/book.yml:1", entry.PageRef)
+		assert.Equal(t, "POST", entry.Request.Method)
+		assert.Equal(t, []util.HarNameValue{{Name: "lang", Value: "go"}}, entry.Request.QueryString)
+		assert.Equal(t, `{"title": "Go"}`, entry.Request.PostData.Text)
+		assert.Contains(t, entry.Request.Headers, util.HarNameValue{Name: "Authorization", Value: util.HarRedacted})
+		assert.Contains(t, entry.Request.Headers, util.HarNameValue{Name: "X-Api-Key", Value: util.HarRedacted})
+		assert.Contains(t, entry.Response.Headers, util.HarNameValue{Name: "Set-Cookie", Value: util.HarRedacted})
+		assert.Equal(t, `{"id": 1}`, entry.Response.Content.Text)
+		assert.Greater(t, entry.Time, float64(0))
+	}
+	assert.NotContains(t, string(b), "Bearer t")
+	assert.NotContains(t, string(b), "session=secret")
+}
@@ -0,0 +1,137 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+	slog "github.com/vearne/simplelog"
+	"gopkg.in/yaml.v3"
+)
+
+// HistoryTrendRuns is the number of runs shown on the trend page written after each run
+const HistoryTrendRuns = 30
+
+// recordHistory appends the results of the run to the history file shared by all the runs,
+// and regenerates the trend page next to it
+func recordHistory(reportData util.ReportData) error {
+	if resource.GlobalConfig.Global.Report.DisableHistory {
+		return nil
+	}
+	// the report dir of the run is created under report.dir_path
+	runDir := resource.GlobalConfig.Global.Report.DirPath
+	historyDir := filepath.Dir(runDir)
+
+	historyPath := filepath.Join(historyDir, util.HistoryFile)
+	err := util.AppendHistory(historyPath, filepath.Base(runDir), reportData)
+	if err != nil {
+		return err
+	}
+	records, err := util.LoadHistory(historyPath)
+	if err != nil {
+		return err
+	}
+	trendPath := filepath.Join(historyDir, util.TrendFile)
+	err = util.GenerateTrendHTML(trendPath, util.BuildTrends(records, HistoryTrendRuns))
+	if err != nil {
+		return err
+	}
+	slog.Info("history:%v, trend:%v", historyPath, trendPath)
+	return nil
+}
+
+// ShowHistory prints the pass rate, latency and first failure of the testcases across the recorded runs
+func ShowHistory(ctx context.Context, cmd *cli.Command) error {
+	dir := cmd.String("dir")
+	if len(dir) <= 0 {
+		confFilePath := cmd.String("config-file")
+		if len(confFilePath) <= 0 {
+			return cli.Exit("either --config-file or --dir is required", model.ExitCodeConfigError)
+		}
+		var err error
+		dir, err = historyDirOf(confFilePath)
+		if err != nil {
+			return cli.Exit(err.Error(), model.ExitCodeConfigError)
+		}
+	}
+
+	historyPath := filepath.Join(dir, util.HistoryFile)
+	records, err := util.LoadHistory(historyPath)
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeInfraError)
+	}
+	if len(records) == 0 {
+		return cli.Exit(fmt.Sprintf("no history in %v", historyPath), model.ExitCodeInfraError)
+	}
+
+	trends := filterTrends(util.BuildTrends(records, cmd.Int("last")), cmd.IntSlice("id"), cmd.Bool("failing"))
+	printHistory(os.Stdout, trends)
+
+	output := cmd.String("output")
+	if len(output) > 0 {
+		err = util.GenerateTrendHTML(output, trends)
+		if err != nil {
+			return cli.Exit(err.Error(), model.ExitCodeInfraError)
+		}
+		slog.Info("trend:%v", output)
+	}
+	return nil
+}
+
+// historyDirOf reads report.dir_path of the config file,
+// unlike resource.ParseConfigFile it does not create the report dir of a run
+func historyDirOf(confFilePath string) (string, error) {
+	b, err := os.ReadFile(confFilePath)
+	if err != nil {
+		return "", err
+	}
+	var cfg config.AutoTestConfig
+	err = yaml.Unmarshal(b, &cfg)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Global.Report.DirPath, nil
+}
+
+func filterTrends(trends []util.CaseTrend, ids []int, failing bool) []util.CaseTrend {
+	result := make([]util.CaseTrend, 0, len(trends))
+	for _, trend := range trends {
+		if len(ids) > 0 && !slices.Contains(ids, int(trend.ID)) {
+			continue
+		}
+		if failing && trend.FirstFailure.IsZero() {
+			continue
+		}
+		result = append(result, trend)
+	}
+	return result
+}
+
+func printHistory(w io.Writer, trends []util.CaseTrend) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CASE\tRUNS\tPASS RATE\tAVG\tLAST\tLAST STATUS\tFIRST FAILURE")
+	for _, trend := range trends {
+		var last time.Duration
+		if len(trend.Points) > 0 {
+			last = trend.Points[len(trend.Points)-1].Duration
+		}
+		firstFailure := "-"
+		if !trend.FirstFailure.IsZero() {
+			firstFailure = trend.FirstFailure.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%.2f%%\t%v\t%v\t%v\t%v\n", trend.Key, len(trend.Points), trend.PassRate(),
+			trend.AvgDuration().Round(time.Millisecond), last.Round(time.Millisecond),
+			trend.LastStatus(), firstFailure)
+	}
+	tw.Flush()
+}
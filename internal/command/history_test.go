@@ -0,0 +1,101 @@
+package command
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestBuildTrends(t *testing.T) {
+	begin := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	record := func(run int, id uint64, status string, duration time.Duration) util.HistoryRecord {
+		return util.HistoryRecord{RunID: "autotest_" + strconv.Itoa(run), RunTime: begin.Add(time.Duration(run) * time.Hour),
+			Protocol: "http", File: "rules/a.yml", ID: id, Status: status, Duration: duration, ErrorMsg: status}
+	}
+	records := []util.HistoryRecord{
+		record(1, 1, util.StatusPassed, 10*time.Millisecond),
+		record(1, 2, util.StatusFailed, 10*time.Millisecond),
+		record(2, 1, util.StatusFailed, 20*time.Millisecond),
+		record(2, 2, util.StatusPassed, 20*time.Millisecond),
+		record(3, 1, util.StatusFlaky, 30*time.Millisecond),
+		record(3, 2, util.StatusSkipped, 0),
+	}
+
+	trends := util.BuildTrends(records, 0)
+	assert.Len(t, trends, 2)
+	assert.Equal(t, "http:rules/a.yml:1", trends[0].Key)
+	assert.Len(t, trends[0].Points, 3)
+	assert.InDelta(t, 33.33, trends[0].PassRate(), 0.01)
+	assert.Equal(t, 20*time.Millisecond, trends[0].AvgDuration())
+	// failing since the second run
+	assert.Equal(t, begin.Add(2*time.Hour), trends[0].FirstFailure)
+	assert.Equal(t, util.StatusFlaky, trends[0].LastStatus())
+	assert.Equal(t, "0.0,16.0 60.0,8.0 120.0,0.0", trends[0].Sparkline(120, 24))
+
+	// a skipped run doesn't change the pass rate or the failing streak
+	assert.InDelta(t, 50, trends[1].PassRate(), 0.01)
+	assert.True(t, trends[1].FirstFailure.IsZero())
+	assert.Equal(t, 15*time.Millisecond, trends[1].AvgDuration())
+
+	// only the last runs
+	trends = util.BuildTrends(records, 1)
+	assert.Len(t, trends[0].Points, 1)
+	assert.Equal(t, begin.Add(3*time.Hour), trends[0].FirstFailure)
+
+	assert.Len(t, filterTrends(util.BuildTrends(records, 0), []int{2}, false), 1)
+	assert.Len(t, filterTrends(util.BuildTrends(records, 0), nil, true), 1)
+
+	var buf bytes.Buffer
+	printHistory(&buf, util.BuildTrends(records, 0))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "http:rules/a.yml:1 "))
+	assert.Contains(t, lines[1], "33.33%")
+}
+
+func TestRecordHistory(t *testing.T) {
+	restoreResource(t)
+	dir := t.TempDir()
+
+	begin := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i, status := range []string{util.StatusPassed, util.StatusFailed} {
+		resource.GlobalConfig.Global.Report.DirPath = filepath.Join(dir, "autotest_"+strconv.Itoa(i+1))
+		var data util.ReportData
+		data.Summary.StartTime = begin.Add(time.Duration(i) * time.Hour)
+		data.TestCases = []util.TestCaseResult{
+			{ID: 1, Protocol: "http", File: "/rules/a.yml", Status: status, Duration: time.Millisecond},
+			// cancelled testcases are not recorded
+			{ID: 2, Protocol: "http", File: "/rules/a.yml", Status: util.StatusCancelled},
+		}
+		assert.NoError(t, recordHistory(data))
+	}
+
+	records, err := util.LoadHistory(filepath.Join(dir, util.HistoryFile))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "autotest_1", records[0].RunID)
+	assert.Equal(t, util.StatusFailed, records[1].Status)
+
+	b, err := os.ReadFile(filepath.Join(dir, util.TrendFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "50.00%")
+	assert.Contains(t, string(b), "2024-06-01 11:00:00")
+
+	// the history can be turned off
+	resource.GlobalConfig.Global.Report.DisableHistory = true
+	assert.NoError(t, recordHistory(util.ReportData{TestCases: []util.TestCaseResult{{ID: 3}}}))
+	records, _ = util.LoadHistory(filepath.Join(dir, util.HistoryFile))
+	assert.Len(t, records, 2)
+
+	records, err = util.LoadHistory(filepath.Join(dir, "missing.jsonl"))
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
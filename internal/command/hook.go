@@ -0,0 +1,126 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/luavm"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	slog "github.com/vearne/simplelog"
+	"github.com/vearne/zaplog"
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
+)
+
+const (
+	StageSetup    = "setup"
+	StageTeardown = "teardown"
+)
+
+// runHooks executes the hooks in order and stores the exported variables in vars.
+// Setup stops at the first failed hook, teardown always executes all of them.
+func runHooks(ctx context.Context, stage string, hooks []config.Hook, vars *sync.Map) error {
+	var firstErr error
+	for i := range hooks {
+		hook := &hooks[i]
+		name := hook.Name
+		if len(name) <= 0 {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		slog.Info("[%v] run hook:%v", stage, name)
+		err := runHook(ctx, hook, vars)
+		if err != nil {
+			slog.Error("[%v] hook:%v failed, %v", stage, name, maskedError(err))
+			zaplog.Error("runHooks", zap.String("stage", stage),
+				zap.String("hook", name), zap.String("error", maskedError(err)))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%v hook %v failed: %w", stage, name, err)
+			}
+			if stage == StageSetup {
+				return firstErr
+			}
+		}
+	}
+	return firstErr
+}
+
+func runHook(ctx context.Context, hook *config.Hook, vars *sync.Map) error {
+	var body, format string
+	switch {
+	case hook.Http != nil:
+		req, err := renderRequestHttpWithVars(*hook.Http, vars, nil)
+		if err != nil {
+			return err
+		}
+		out, _, err := doHttpRequest(ctx, req, newRequestOptions(config.RequestOptions{}))
+		if err != nil {
+			return err
+		}
+		if out.IsError() {
+			return fmt.Errorf("unexpected status:%v", out.Status())
+		}
+		body = out.String()
+		format = rule.DetectFormat(out.Header().Get("Content-Type"))
+	case hook.Grpc != nil:
+		req, err := renderRequestGrpcWithVars(*hook.Grpc, vars, nil)
+		if err != nil {
+			return err
+		}
+		resp, _, err := invokeGrpc(ctx, req, newRequestOptions(config.RequestOptions{}))
+		if err != nil {
+			return err
+		}
+		if resp.Code != "OK" {
+			return fmt.Errorf("unexpected code:%v, message:%v", resp.Code, resp.Message)
+		}
+		body = resp.Body
+		format = rule.FormatJSON
+	case len(hook.Lua) > 0:
+		return runLuaHook(hook.Lua, vars)
+	default:
+		return errors.New("one of http, grpc and lua is required")
+	}
+
+	if hook.Export != nil {
+		value, err := exportTo(body, format, hook.Export)
+		if err != nil {
+			return err
+		}
+		vars.Store(hook.Export.ExportTo, value)
+		resource.SecretMasker.Track(hook.Export.ExportTo, value)
+	}
+	return nil
+}
+
+// runLuaHook executes function run(), returning false means the hook failed,
+// the fields of a returned table are stored in vars.
+func runLuaHook(script string, vars *sync.Map) error {
+	source := script +
+		`
+
+		return run();
+	`
+	value, err := luavm.ExecuteLuaWithGlobalsPool(nil, nil, source)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case lua.LBool:
+		if !bool(v) {
+			return errors.New("run() returned false")
+		}
+	case *lua.LTable:
+		v.ForEach(func(key, val lua.LValue) {
+			value := fromLuaValue(val)
+			resource.SecretMasker.Track(key.String(), value)
+			vars.Store(key.String(), value)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func initHookTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestRunHooksHttpExport(t *testing.T) {
+	initHookTestResource(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login" {
+			w.Write([]byte(`{"token": "abc"}`)) //nolint: errcheck
+			return
+		}
+		// the exported token is used by the next hook
+		if r.Header.Get("Authorization") != "abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	hooks := []config.Hook{
+		{Name: "login", Http: &config.RequestHttp{Method: "post", URL: server.URL + "/login"},
+			Export: &config.Export{JSONPath: "$.token", ExportTo: "TOKEN", Type: "string"}},
+		{Name: "seed", Http: &config.RequestHttp{Method: "post", URL: server.URL + "/seed",
+			Headers: []string{"Authorization: {{ TOKEN }}"}}},
+	}
+	vars := &sync.Map{}
+	err := runHooks(context.Background(), StageSetup, hooks, vars)
+	assert.NoError(t, err)
+	token, _ := vars.Load("TOKEN")
+	assert.Equal(t, "abc", token)
+	// the template in the hook is not modified
+	assert.Equal(t, "Authorization: {{ TOKEN }}", hooks[1].Http.Headers[0])
+}
+
+func TestRunHooksStage(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+	}))
+	defer server.Close()
+	initHookTestResource(t)
+
+	hooks := []config.Hook{
+		{Name: "fail", Lua: "function run() return false end"},
+		{Name: "cleanup", Http: &config.RequestHttp{Method: "delete", URL: server.URL}},
+	}
+
+	// setup stops at the first failed hook
+	err := runHooks(context.Background(), StageSetup, hooks, &sync.Map{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(0), count.Load())
+
+	// teardown executes all the hooks
+	err = runHooks(context.Background(), StageTeardown, hooks, &sync.Map{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestRunLuaHook(t *testing.T) {
+	vars := &sync.Map{}
+	err := runLuaHook(`
+		function run()
+			return {USER_ID = 42, USER_NAME = "tom", SCORE = 1.5}
+		end`, vars)
+	assert.NoError(t, err)
+	id, _ := vars.Load("USER_ID")
+	name, _ := vars.Load("USER_NAME")
+	score, _ := vars.Load("SCORE")
+	assert.Equal(t, 42, id)
+	assert.Equal(t, "tom", name)
+	assert.Equal(t, 1.5, score)
+}
@@ -9,11 +9,9 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/lianggaoqiang/progress"
 	"github.com/vearne/autotest/internal/config"
 	"github.com/vearne/autotest/internal/model"
 	"github.com/vearne/autotest/internal/resource"
@@ -24,7 +22,7 @@ import (
 	"go.uber.org/zap"
 )
 
-func HttpAutomateTest(httpTestCases map[string][]*config.TestCaseHttp) *UnifiedTestResults {
+func HttpAutomateTest(ctx context.Context, httpTestCases map[string][]*config.TestCaseHttp) *UnifiedTestResults {
 	total := 0
 	for _, testcases := range httpTestCases {
 		total += len(testcases)
@@ -40,51 +38,63 @@ func HttpAutomateTest(httpTestCases map[string][]*config.TestCaseHttp) *UnifiedT
 	parallelFiles := resource.GlobalConfig.Global.ParallelFiles
 
 	if parallelFiles {
-		return httpParallelFiles(workerNum, httpTestCases, total, begin)
+		return httpParallelFiles(ctx, workerNum, httpTestCases, total, begin)
 	}
-	return httpSerialFiles(workerNum, httpTestCases, total, begin)
+	return httpSerialFiles(ctx, workerNum, httpTestCases, total, begin)
 }
 
-func httpSerialFiles(workerNum int, httpTestCases map[string][]*config.TestCaseHttp, total int, begin time.Time) *UnifiedTestResults {
+func httpSerialFiles(ctx context.Context, workerNum int, httpTestCases map[string][]*config.TestCaseHttp, total int, begin time.Time) *UnifiedTestResults {
 	finishCount := 0
 	successCount := 0
 	failedCount := 0
+	skippedCount := 0
+	cancelledCount := 0
+	flakyCount := 0
 	var failedCases []string
+	var testCases []util.TestCaseResult
 
-	for filePath := range httpTestCases {
+	for _, filePath := range ruleFileOrder(httpTestCases, resource.GlobalConfig.HttpRuleFiles) {
 		// if ignore_testcase_fail is false and some testcases have failed.
 		if resource.TerminationFlag.Load() {
 			break
 		}
 
-		info, tcResultList := HandleSingleFileHttp(workerNum, filePath, &resource.CustomerVars, true)
+		info, tcResultList := HandleSingleFileHttp(ctx, workerNum, filePath, &resource.CustomerVars, true)
 		finishCount += info.Total
 		successCount += info.SuccessCount
 		failedCount += info.FailedCount
+		skippedCount += info.SkippedCount
+		cancelledCount += info.CancelledCount
+		flakyCount += info.FlakyCount
 
 		// 收集失败用例信息
 		for _, tcResult := range tcResultList {
-			if tcResult.State != model.StateSuccessFul {
+			if tcResult.State == model.StateFailed {
 				failedCases = append(failedCases, fmt.Sprintf("HTTP_%d: %s", tcResult.ID, tcResult.Desc))
 			}
+			testCases = append(testCases, newHttpCaseResult(filePath, tcResult))
 		}
 
-		slog.Info("HttpTestCases, total:%v, finishCount:%v, successCount:%v, failedCount:%v",
-			total, finishCount, successCount, failedCount)
+		slog.Info("HttpTestCases, total:%v, finishCount:%v, successCount:%v, failedCount:%v, skippedCount:%v",
+			total, finishCount, successCount, failedCount, skippedCount)
 		// generate report file (保留旧的报告生成作为备份)
 		GenReportFileHttp(filePath, tcResultList, info)
 	}
 	slog.Info("[end]HttpTestCases, total:%v, cost:%v", total, time.Since(begin))
 
 	return &UnifiedTestResults{
-		TotalTests:  finishCount,
-		PassedTests: successCount,
-		FailedTests: failedCount,
-		FailedCases: failedCases,
+		TotalTests:     finishCount,
+		PassedTests:    successCount,
+		FailedTests:    failedCount,
+		SkippedTests:   skippedCount,
+		CancelledTests: cancelledCount,
+		FlakyTests:     flakyCount,
+		FailedCases:    failedCases,
+		TestCases:      testCases,
 	}
 }
 
-func httpParallelFiles(workerNum int, httpTestCases map[string][]*config.TestCaseHttp, total int, begin time.Time) *UnifiedTestResults {
+func httpParallelFiles(ctx context.Context, workerNum int, httpTestCases map[string][]*config.TestCaseHttp, total int, begin time.Time) *UnifiedTestResults {
 	type fileResult struct {
 		filePath     string
 		info         *ResultInfo
@@ -93,11 +103,11 @@ func httpParallelFiles(workerNum int, httpTestCases map[string][]*config.TestCas
 
 	resultChan := make(chan fileResult, len(httpTestCases))
 
-	for filePath := range httpTestCases {
+	for _, filePath := range ruleFileOrder(httpTestCases, resource.GlobalConfig.HttpRuleFiles) {
 		go func(fp string) {
 			// 每个文件使用独立的 vars，避免并行时变量冲突
-			fileVars := &sync.Map{}
-			info, tcResultList := HandleSingleFileHttp(workerNum, fp, fileVars, false)
+			fileVars := copyVars(&resource.CustomerVars)
+			info, tcResultList := HandleSingleFileHttp(ctx, workerNum, fp, fileVars, false)
 			resultChan <- fileResult{filePath: fp, info: info, tcResultList: tcResultList}
 		}(filePath)
 	}
@@ -105,39 +115,50 @@ func httpParallelFiles(workerNum int, httpTestCases map[string][]*config.TestCas
 	finishCount := 0
 	successCount := 0
 	failedCount := 0
+	skippedCount := 0
+	cancelledCount := 0
+	flakyCount := 0
 	var failedCases []string
+	var testCases []util.TestCaseResult
 
 	for i := 0; i < len(httpTestCases); i++ {
 		result := <-resultChan
 		finishCount += result.info.Total
 		successCount += result.info.SuccessCount
 		failedCount += result.info.FailedCount
+		skippedCount += result.info.SkippedCount
+		cancelledCount += result.info.CancelledCount
+		flakyCount += result.info.FlakyCount
 
 		// 收集失败用例信息
 		for _, tcResult := range result.tcResultList {
-			if tcResult.State != model.StateSuccessFul {
+			if tcResult.State == model.StateFailed {
 				failedCases = append(failedCases, fmt.Sprintf("HTTP_%d: %s", tcResult.ID, tcResult.Desc))
 			}
+			testCases = append(testCases, newHttpCaseResult(result.filePath, tcResult))
 		}
 
-		slog.Info("HttpTestCases[parallel], total:%v, finishCount:%v, successCount:%v, failedCount:%v",
-			total, finishCount, successCount, failedCount)
+		slog.Info("HttpTestCases[parallel], total:%v, finishCount:%v, successCount:%v, failedCount:%v, skippedCount:%v",
+			total, finishCount, successCount, failedCount, skippedCount)
 		GenReportFileHttp(result.filePath, result.tcResultList, result.info)
 	}
 	slog.Info("[end]HttpTestCases[parallel], total:%v, cost:%v", total, time.Since(begin))
 
 	return &UnifiedTestResults{
-		TotalTests:  finishCount,
-		PassedTests: successCount,
-		FailedTests: failedCount,
-		FailedCases: failedCases,
+		TotalTests:     finishCount,
+		PassedTests:    successCount,
+		FailedTests:    failedCount,
+		SkippedTests:   skippedCount,
+		CancelledTests: cancelledCount,
+		FlakyTests:     flakyCount,
+		FailedCases:    failedCases,
+		TestCases:      testCases,
 	}
 }
 
 func GenReportFileHttp(testCasefilePath string, tcResultList []HttpTestCaseResult, info *ResultInfo) {
-	filename := filepath.Base(testCasefilePath)
-	name := strings.TrimSuffix(filename, filepath.Ext(filename))
-	filename = name + ".csv"
+	name := util.FileReportName(testCasefilePath)
+	filename := name + ".csv"
 
 	reportDirPath := resource.GlobalConfig.Global.Report.DirPath
 	reportPath := filepath.Join(reportDirPath, filename)
@@ -153,17 +174,17 @@ func GenReportFileHttp(testCasefilePath string, tcResultList []HttpTestCaseResul
 			reasonStr = ""
 		}
 		records = append(records, []string{strconv.Itoa(int(item.ID)),
-			item.Desc, item.State.String(), reasonStr})
+			resource.SecretMasker.Mask(item.Desc), item.State.String(), reasonStr})
 	}
 	util.WriterCSV(reportPath, records)
 	// 2. html file
-	dirName := util.MD5(reportDirPath + name)
+	dirName := util.CaseDetailDir(reportDirPath, testCasefilePath)
 
 	var caseResults []CaseShow
 	for _, item := range tcResultList {
-		caseResults = append(caseResults, CaseShow{ID: item.ID, Description: item.Desc,
+		caseResults = append(caseResults, CaseShow{ID: item.ID, Description: resource.SecretMasker.Mask(item.Desc),
 			State: item.State.String(), Reason: item.Reason.String(),
-			Link: fmt.Sprintf("./%v/%v.html", dirName, item.ID)})
+			Link: util.CaseDetailLink(reportDirPath, testCasefilePath, item.ID)})
 	}
 
 	obj := map[string]any{
@@ -180,9 +201,13 @@ func GenReportFileHttp(testCasefilePath string, tcResultList []HttpTestCaseResul
 	// case file
 	for _, item := range tcResultList {
 		data := map[string]any{
-			"Error":      item.Error,
-			"reqDetail":  item.ReqDetail(),
-			"respDetail": item.RespDetail(),
+			"title":      fmt.Sprintf("HTTP_%d: %s", item.ID, resource.SecretMasker.Mask(item.Desc)),
+			"fileLink":   "../" + name + ".html",
+			"reportLink": unifiedHTMLReportLink(),
+			"Error":      maskedError(item.Error),
+			"reqDetail":  resource.SecretMasker.Mask(item.ReqDetail()),
+			"respDetail": resource.SecretMasker.Mask(item.RespDetail()),
+			"repro":      resource.SecretMasker.Mask(item.ReproCommand()),
 		}
 		err := RenderTpl(mytpl, "template/case.tpl", data,
 			filepath.Join(reportDirPath, dirName, strconv.Itoa(int(item.ID))+".html"))
@@ -228,88 +253,102 @@ func pathExists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
-func HandleSingleFileHttp(workerNum int, filePath string, vars *sync.Map, showProgress bool) (*ResultInfo, []HttpTestCaseResult) {
+func HandleSingleFileHttp(ctx context.Context, workerNum int, filePath string, vars *sync.Map, showProgress bool) (*ResultInfo, []HttpTestCaseResult) {
 	workerNum = min(workerNum, 10)
 	testcases := resource.HttpTestCases[filePath]
 	slog.Info("[start]HandleSingleFileHttp, filePath:%v, len(testcase):%v", filePath, len(testcases))
+	// the run was cancelled, the rule file is not executed
+	if ctx.Err() != nil {
+		return cancelledHttp(testcases)
+	}
+
+	// teardown always runs, even if the setup or some testcases failed or the run was cancelled
+	hooks := resource.FileHooks[filePath]
+	defer func() {
+		//nolint: errcheck
+		runHooks(context.WithoutCancel(ctx), StageTeardown, hooks.Teardown, vars)
+	}()
+	err := runHooks(ctx, StageSetup, hooks.Setup, vars)
+	if err != nil {
+		if ctx.Err() != nil {
+			return cancelledHttp(testcases)
+		}
+		return setupFailedHttp(testcases, err)
+	}
 
-	futureChan := make(chan executor.Future, len(testcases))
-	pool := executor.NewFixedGPool(context.Background(), workerNum)
+	futureChan := make(chan httpPending, len(testcases))
+	pool := executor.NewFixedGPool(ctx, workerNum)
 	defer pool.WaitTerminate()
 
 	stateGroup := model.NewStateGroup()
 	for _, testcase := range testcases {
 		stateGroup.SetState(testcase.GetID(), model.StateNotExecuted)
+		if testcase.ParentID > 0 {
+			stateGroup.AddMember(testcase.ParentID, testcase.GetID())
+		}
 	}
 	// producer
 	go func() {
 		for i := 0; i < len(testcases); i++ {
-			tc := testcases[i]
-			f, err := pool.Submit(&HttpTestCallable{testcase: tc, stateGroup: stateGroup, vars: vars})
-			if err != nil {
-				zaplog.Error("pool.Submit", zap.Any("testcase", tc), zap.Error(err))
-			}
-			futureChan <- f
+			futureChan <- submitHttp(ctx, pool, filePath, testcases[i], stateGroup, vars)
 		}
 	}()
 
-	var bar *progress.DefaultBar
-	var p *progress.Progress
+	var bar *util.ProgressBar
 	if showProgress {
-		p = progress.Start()
-		bar = progress.NewBar().Custom(
-			progress.BarSetting{
-				StartText:       "[",
-				EndText:         "]",
-				PassedText:      "-",
-				FirstPassedText: ">",
-				NotPassedText:   "=",
-			},
-		)
-		p.AddBar(bar)
+		bar = util.NewProgressBar(os.Stdout)
 	}
 
 	finishCount := 0
 	successCount := 0
 	failedCount := 0
+	skippedCount := 0
+	cancelledCount := 0
+	flakyCount := 0
 
 	var tcResultList []HttpTestCaseResult
-	for future := range futureChan {
-		gResult := future.Get()
-		tcResult := gResult.Value.(HttpTestCaseResult)
+	for pending := range futureChan {
+		tcResult := pending.result()
 		zaplog.Debug("future.Get",
 			zap.Uint64("ID", tcResult.ID),
 			zap.String("Desc", tcResult.Desc),
-			zap.Any("request", tcResult.Request),
-			zap.Any("response", tcResult.Response),
+			maskedField("request", tcResult.Request),
+			maskedField("response", tcResult.Response),
 		)
 
 		if tcResult.State == model.StateNotExecuted {
 			time.Sleep(200 * time.Millisecond)
 			// wait for a while
-			f, err := pool.Submit(&HttpTestCallable{testcase: tcResult.TestCase, stateGroup: stateGroup, vars: vars})
-			if err != nil {
-				zaplog.Error("pool.Submit", zap.Any("testcase", tcResult.TestCase), zap.Error(err))
-			} else {
-				futureChan <- f
-			}
+			futureChan <- submitHttp(ctx, pool, filePath, tcResult.TestCase, stateGroup, vars)
 			continue
 		}
 
-		if tcResult.State == model.StateSuccessFul {
+		terminate := false
+		switch tcResult.State {
+		case model.StateSuccessFul:
 			successCount++
-		} else {
+		case model.StateSkipped:
+			skippedCount++
+		case model.StateCancelled:
+			cancelledCount++
+		case model.StateFlaky:
+			flakyCount++
+		default:
 			failedCount++
-			// terminate subsequent testcases
-			if !resource.GlobalConfig.Global.IgnoreTestCaseFail {
+			// terminate subsequent testcases, unless the testcase is quarantined
+			if !resource.GlobalConfig.Global.IgnoreTestCaseFail && !tcResult.TestCase.Quarantine {
 				resource.TerminationFlag.Store(true)
-				break
+				terminate = true
 			}
 		}
 
 		stateGroup.SetState(tcResult.ID, tcResult.State)
 		// prepare to write report
 		tcResultList = append(tcResultList, tcResult)
+		if terminate {
+			finishCount++
+			break
+		}
 
 		// process the variables generated when testcase is run
 		for key, value := range tcResult.KeyValues {
@@ -318,9 +357,6 @@ func HandleSingleFileHttp(workerNum int, filePath string, vars *sync.Map, showPr
 
 		finishCount++
 		if showProgress {
-			// process bar will override this line.
-			fmt.Println()
-			//nolint: errcheck
 			bar.Percent(float64(finishCount) / float64(len(testcases)) * 100)
 		}
 		if finishCount >= len(testcases) {
@@ -330,5 +366,102 @@ func HandleSingleFileHttp(workerNum int, filePath string, vars *sync.Map, showPr
 	}
 	slog.Info("[end]HandleSingleFile, filePath:%v", filePath)
 	return &ResultInfo{Total: finishCount, SuccessCount: successCount,
-		FailedCount: failedCount}, tcResultList
+		FailedCount: failedCount, SkippedCount: skippedCount, CancelledCount: cancelledCount, FlakyCount: flakyCount}, tcResultList
+}
+
+// httpPending is a testcase submitted to the pool
+type httpPending struct {
+	future   executor.Future
+	testcase *config.TestCaseHttp
+}
+
+// result waits for the testcase, a testcase that was not submitted or was interrupted is cancelled
+func (p httpPending) result() HttpTestCaseResult {
+	if p.future != nil {
+		if tcResult, ok := p.future.Get().Value.(HttpTestCaseResult); ok {
+			return tcResult
+		}
+	}
+	return cancelledHttpResult(p.testcase)
+}
+
+func submitHttp(ctx context.Context, pool executor.ExecutorService, filePath string, tc *config.TestCaseHttp,
+	stateGroup *model.StateGroup, vars *sync.Map) httpPending {
+	// stop submitting testcases once the run was cancelled
+	if ctx.Err() != nil {
+		return httpPending{testcase: tc}
+	}
+	f, err := pool.Submit(&HttpTestCallable{filePath: filePath, testcase: tc, stateGroup: stateGroup, vars: vars})
+	if err != nil {
+		zaplog.Error("pool.Submit", zap.Any("testcase", tc), zap.Error(err))
+		return httpPending{testcase: tc}
+	}
+	return httpPending{future: f, testcase: tc}
+}
+
+func cancelledHttpResult(tc *config.TestCaseHttp) HttpTestCaseResult {
+	now := time.Now()
+	return HttpTestCaseResult{
+		ID:        tc.ID,
+		Desc:      tc.Desc,
+		State:     model.StateCancelled,
+		Reason:    model.ReasonCancelled,
+		TestCase:  tc,
+		KeyValues: map[string]any{},
+		StartTime: now,
+		EndTime:   now,
+	}
+}
+
+// cancelledHttp marks all the testcases of the file as cancelled
+func cancelledHttp(testcases []*config.TestCaseHttp) (*ResultInfo, []HttpTestCaseResult) {
+	tcResultList := make([]HttpTestCaseResult, 0, len(testcases))
+	for _, tc := range testcases {
+		tcResultList = append(tcResultList, cancelledHttpResult(tc))
+	}
+	return &ResultInfo{Total: len(testcases), CancelledCount: len(testcases)}, tcResultList
+}
+
+// setupFailedHttp marks all the testcases of the file as failed
+func setupFailedHttp(testcases []*config.TestCaseHttp, err error) (*ResultInfo, []HttpTestCaseResult) {
+	now := time.Now()
+	tcResultList := make([]HttpTestCaseResult, 0, len(testcases))
+	for _, tc := range testcases {
+		tcResultList = append(tcResultList, HttpTestCaseResult{
+			ID:        tc.ID,
+			Desc:      tc.Desc,
+			State:     model.StateFailed,
+			Reason:    model.ReasonSetupFailed,
+			TestCase:  tc,
+			KeyValues: map[string]any{},
+			Error:     err,
+			StartTime: now,
+			EndTime:   now,
+		})
+	}
+	if !resource.GlobalConfig.Global.IgnoreTestCaseFail {
+		resource.TerminationFlag.Store(true)
+	}
+	return &ResultInfo{Total: len(testcases), FailedCount: len(testcases)}, tcResultList
+}
+
+// newHttpCaseResult converts the result of a http testcase for the unified reports
+func newHttpCaseResult(filePath string, tcResult HttpTestCaseResult) util.TestCaseResult {
+	result := newTestCaseResult("http", filePath, tcResult.TestCase.Line,
+		tcResult.ID, tcResult.Desc, tcResult.State, tcResult.Reason, tcResult.Error,
+		tcResult.StartTime, tcResult.EndTime, tcResult.Trace)
+	result.Quarantined = tcResult.TestCase.Quarantine
+	result.Tags = tcResult.TestCase.Tags
+	if len(tcResult.Steps) > 0 {
+		result.Steps = tcResult.Steps
+		result.RequestDetail = tcResult.ReqDetail()
+		result.ResponseDetail = tcResult.RespDetail()
+		result.Repro = tcResult.ReproCommand()
+	}
+	result.Mismatch = tcResult.Mismatch
+	if tcResult.Runs > 1 {
+		result.Runs = tcResult.Runs
+		result.PassedRuns = tcResult.PassedRuns
+	}
+	return result
 }
@@ -0,0 +1,71 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func initHttpAutomateTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = 10 * time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestHandleSingleFileHttpCancelled(t *testing.T) {
+	var teardownCount atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/teardown" {
+			teardownCount.Add(1)
+			return
+		}
+		// blocks until the request is cancelled
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	initHttpAutomateTestResource(t)
+
+	filePath := "/tmp/cancel_test.yml"
+	resource.HttpTestCases = map[string][]*config.TestCaseHttp{filePath: {
+		{ID: 1, Desc: "slow", Request: config.RequestHttp{Method: "get", URL: server.URL + "/slow"}},
+		{ID: 2, Desc: "depends on slow", DependOnIDs: []uint64{1},
+			Request: config.RequestHttp{Method: "get", URL: server.URL + "/slow"}},
+	}}
+	resource.FileHooks = map[string]config.Hooks{filePath: {
+		Teardown: []config.Hook{{Http: &config.RequestHttp{Method: "get", URL: server.URL + "/teardown"}}},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	begin := time.Now()
+	info, tcResultList := HandleSingleFileHttp(ctx, 2, filePath, &sync.Map{}, false)
+	assert.Less(t, time.Since(begin), 5*time.Second)
+	assert.Equal(t, 2, info.Total)
+	assert.Equal(t, 2, info.CancelledCount)
+	assert.Len(t, tcResultList, 2)
+	for _, tcResult := range tcResultList {
+		assert.Equal(t, model.StateCancelled, tcResult.State)
+		assert.Equal(t, model.ReasonCancelled, tcResult.Reason)
+	}
+	// teardown is not interrupted by the cancellation
+	assert.Equal(t, int32(1), teardownCount.Load())
+
+	// a cancelled run does not execute the rule file
+	info, _ = HandleSingleFileHttp(ctx, 2, filePath, &sync.Map{}, false)
+	assert.Equal(t, 2, info.CancelledCount)
+	assert.Equal(t, int32(1), teardownCount.Load())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/vearne/autotest/internal/luavm"
 	"github.com/vearne/autotest/internal/model"
 	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
 	"github.com/vearne/autotest/internal/util"
 	"github.com/vearne/executor"
 	"github.com/vearne/zaplog"
@@ -30,7 +32,17 @@ type HttpTestCaseResult struct {
 	TestCase  *config.TestCaseHttp
 	KeyValues map[string]any
 	Error     error
+	StartTime time.Time
+	EndTime   time.Time
 	Response  *resty.Response
+	Trace     RequestTrace
+	// runs of a repeated testcase, and how many of them passed
+	Runs       int
+	PassedRuns int
+	// steps of the last run
+	Steps []util.CaseStep
+	// the verify rule which failed in the last run
+	Mismatch *rule.Mismatch
 }
 
 /*
@@ -56,7 +68,7 @@ func (t *HttpTestCaseResult) ReqDetail() string {
 		fmt.Fprintf(&builder, "%v\n", item)
 	}
 	builder.WriteString("BODY:\n")
-	fmt.Fprintf(&builder, "%v\n", t.Request.Body)
+	fmt.Fprintf(&builder, "%v\n", util.PrettyJSON(t.Request.Body))
 	return builder.String()
 }
 
@@ -87,11 +99,13 @@ func (t *HttpTestCaseResult) RespDetail() string {
 		fmt.Fprintf(&builder, "%v: %v\n", key, strings.Join(values, ","))
 	}
 	builder.WriteString("BODY:\n")
-	fmt.Fprintf(&builder, "%v\n", t.Response.String())
+	fmt.Fprintf(&builder, "%v\n", util.PrettyJSON(t.Response.String()))
 	return builder.String()
 }
 
 type HttpTestCallable struct {
+	// the rule file of the testcase
+	filePath   string
 	testcase   *config.TestCaseHttp
 	stateGroup *model.StateGroup
 	vars       *sync.Map
@@ -112,6 +126,25 @@ func (m *HttpTestCallable) Call(ctx context.Context) *executor.GPResult {
 		Response:  nil,
 	}
 
+	tcResult.StartTime = time.Now()
+	defer func() {
+		// r.Value holds a copy of tcResult
+		if result, ok := r.Value.(HttpTestCaseResult); ok {
+			result.EndTime = time.Now()
+			r.Value = result
+		}
+	}()
+
+	// 0. the run was cancelled
+	if ctx.Err() != nil {
+		tcResult.State = model.StateCancelled
+		tcResult.Reason = model.ReasonCancelled
+		tcResult.Error = ctx.Err()
+		r.Value = tcResult
+		r.Err = nil
+		return &r
+	}
+
 	// 1. Check other test cases of dependencies
 	for _, id := range m.testcase.DependOnIDs {
 		if m.stateGroup.GetState(id) == model.StateNotExecuted { // a certain dependency is not yet completed
@@ -121,53 +154,218 @@ func (m *HttpTestCallable) Call(ctx context.Context) *executor.GPResult {
 			r.Err = nil
 			return &r
 		} else if m.stateGroup.GetState(id) == model.StateFailed {
-			tcResult.State = model.StateFailed
+			tcResult.State = model.StateSkipped
 			tcResult.Reason = model.ReasonDependentItemFailed
 			r.Value = tcResult
 			r.Err = nil
 			return &r
+		} else if m.stateGroup.GetState(id) == model.StateSkipped {
+			tcResult.State = model.StateSkipped
+			tcResult.Reason = model.ReasonDependentItemSkipped
+			r.Value = tcResult
+			r.Err = nil
+			return &r
+		} else if m.stateGroup.GetState(id) == model.StateCancelled {
+			tcResult.State = model.StateCancelled
+			tcResult.Reason = model.ReasonCancelled
+			r.Value = tcResult
+			r.Err = nil
+			return &r
+		}
+	}
+
+	// 1.5 skip, evaluated against the environment and exported variables
+	skip, reason, err := shouldSkip(m.testcase.Skip, m.testcase.SkipIf, m.testcase.LuaSkipIf,
+		m.vars, m.testcase.RowVars)
+	if err != nil {
+		tcResult.State = model.StateFailed
+		tcResult.Reason = reason
+		tcResult.Error = err
+		r.Value = tcResult
+		r.Err = err
+		return &r
+	}
+	if skip {
+		tcResult.State = model.StateSkipped
+		tcResult.Reason = reason
+		r.Value = tcResult
+		r.Err = nil
+		return &r
+	}
+
+	// 2-6. run the testcase, a repeated testcase is flaky if only some of the runs passed
+	var failure HttpTestCaseResult
+	for i := 0; i < max(m.testcase.Repeat, 1); i++ {
+		r.Err = m.runOnce(ctx, &tcResult)
+		if tcResult.State == model.StateCancelled {
+			break
+		}
+		tcResult.Runs++
+		if tcResult.State == model.StateSuccessFul {
+			tcResult.PassedRuns++
+			continue
+		}
+		failure = tcResult
+		// rendering the request fails the same way every time
+		if tcResult.Reason == model.ReasonTemplateRenderError {
+			break
 		}
 	}
+	if tcResult.State != model.StateCancelled && tcResult.PassedRuns > 0 && tcResult.PassedRuns < tcResult.Runs {
+		tcResult.State = model.StateFlaky
+		tcResult.Reason = model.ReasonFlaky
+		tcResult.Error = flakyError(tcResult.PassedRuns, tcResult.Runs, failure.Reason, failure.Error)
+	}
+	r.Value = tcResult
+	return &r
+}
+
+// runOnce sends the request of the testcase and verifies the response,
+// the state and the details of the run are written to tcResult
+func (m *HttpTestCallable) runOnce(ctx context.Context, tcResult *HttpTestCaseResult) error {
+	tcResult.State = model.StateSuccessFul
+	tcResult.Reason = model.ReasonSuccess
+	tcResult.Error = nil
+	tcResult.Response = nil
+	tcResult.Steps = nil
+	tcResult.Mismatch = nil
 
 	// 2. deal delay
 	if m.testcase.Delay > 0 {
 		zaplog.Debug("sleep", zap.Any("delay", m.testcase.Delay))
-		time.Sleep(m.testcase.Delay)
+		select {
+		case <-time.After(m.testcase.Delay):
+		case <-ctx.Done():
+			tcResult.State = model.StateCancelled
+			tcResult.Reason = model.ReasonCancelled
+			tcResult.Error = ctx.Err()
+			return nil
+		}
 	}
 
 	// 3. render
 	zaplog.Debug("before render()", zap.Uint64("testCaseId", m.testcase.ID),
 		zap.Any("request", m.testcase.Request))
-	req, err := renderRequestHttpWithVars(m.testcase.Request, m.vars)
+	start := time.Now()
+	req, err := renderRequestHttpWithVars(m.testcase.Request, m.vars, m.testcase.RowVars)
 	tcResult.Request = req
+	tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepRender, start, err))
 	zaplog.Debug("after render()", zap.Uint64("testCaseId", m.testcase.ID),
-		zap.Any("request", tcResult.Request))
+		maskedField("request", tcResult.Request))
 	if err != nil {
 		tcResult.State = model.StateFailed
 		tcResult.Reason = model.ReasonTemplateRenderError
 		tcResult.Error = err
-		r.Value = tcResult
-		r.Err = err
-		return &r
+		return err
 	}
 
-	// 4. timeout
-	timeout := resource.GlobalConfig.Global.RequestTimeout
-	rCtx, cancel := context.WithTimeout(ctx, timeout)
+	// 4. trigger remote request with timeout and rate limiting
+	start = time.Now()
+	opts := newRequestOptions(m.testcase.RequestOptions)
+	opts.har = resource.HarRecorder
+	opts.harCase = util.HarCase{File: resource.RelRulePath(m.filePath), ID: m.testcase.ID, Description: m.testcase.Desc}
+	out, trace, err := doHttpRequest(ctx, req, opts)
+	tcResult.Trace = trace
+	tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepRequest, start, err))
+	if err != nil {
+		zaplog.Error("HttpTestCallable rules verify failed",
+			zap.Uint64("testCaseId", m.testcase.ID),
+			zap.String("error", maskedError(err)),
+		)
+		tcResult.State = model.StateFailed
+		tcResult.Reason = model.ReasonRequestFailed
+		// the in-flight request was interrupted
+		if ctx.Err() != nil {
+			tcResult.State = model.StateCancelled
+			tcResult.Reason = model.ReasonCancelled
+		}
+		tcResult.Error = err
+		return err
+	}
+
+	tcResult.Response = out
+
+	// 5. export
+	if m.testcase.Export != nil {
+		exportConfig := m.testcase.Export
+		start = time.Now()
+		value, err := exportTo(out.String(), rule.DetectFormat(out.Header().Get("Content-Type")), exportConfig)
+		tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepExport, start, err))
+		if err != nil {
+			// the testcases driven by the variable would run with a wrong value
+			zaplog.Error("HttpTestCallable export failed",
+				zap.Uint64("testCaseId", m.testcase.ID),
+				zap.String("exportTo", exportConfig.ExportTo),
+				zap.String("error", maskedError(err)))
+			delete(tcResult.KeyValues, exportConfig.ExportTo)
+			tcResult.State = model.StateFailed
+			tcResult.Reason = model.ReasonExportFailed
+			tcResult.Error = fmt.Errorf("export %v, %w", exportConfig.ExportTo, err)
+			return tcResult.Error
+		}
+		tcResult.KeyValues[exportConfig.ExportTo] = value
+		resource.SecretMasker.Track(exportConfig.ExportTo, value)
+	}
+
+	// 6. verify
+	start = time.Now()
+	var verifyErr error
+	var failedRule rule.VerifyRule
+	for idx, rule := range m.testcase.VerifyRules {
+		VerifyResult := rule.Verify(out)
+		if !VerifyResult {
+			zaplog.Error("HttpTestCallable rules validate failed",
+				zap.Uint64("testCaseId", m.testcase.ID),
+				zap.Int("ruleIdx", idx+1),
+				zap.Any("rule", m.testcase.VerifyRules[idx]))
+
+			tcResult.State = model.StateFailed
+			tcResult.Reason = model.ReasonRuleVerifyFailed
+			verifyErr = fmt.Errorf("verify rule #%d failed", idx+1)
+			failedRule = rule
+			break
+		}
+	}
+	if failedRule != nil {
+		mismatch := rule.ExplainHttp(failedRule, out)
+		tcResult.Mismatch = &mismatch
+		verifyErr = fmt.Errorf("%w, %v expected:%v, actual:%v", verifyErr, mismatch.Rule, mismatch.Expected, mismatch.Actual)
+	}
+	tcResult.Steps = append(tcResult.Steps, newCaseStep(util.StepVerify, start, verifyErr))
+	return nil
+}
+
+// splitHeader splits a header of the rule file, "Name: value", at the first colon,
+// the value may contain colons, e.g. "Referer: http://localhost"
+func splitHeader(item string) (name string, value string) {
+	name, value, _ = strings.Cut(item, ":")
+	return strings.TrimSpace(name), strings.TrimSpace(value)
+}
+
+// doHttpRequest sends the rendered request with timeout, rate limiting and retry
+func doHttpRequest(ctx context.Context, req config.RequestHttp,
+	opts requestOptions) (*resty.Response, RequestTrace, error) {
+	rCtx, cancel := context.WithTimeout(ctx, opts.timeout)
 	defer cancel()
 
-	// 5. trigger remote request with rate limiting
 	var out *resty.Response
+	var trace RequestTrace
 	method := strings.ToUpper(req.Method)
 
 	// 使用限流器和重试机制控制并发、速率和稳定性
-	err = resource.RateLimiter.ExecuteWithLimit(rCtx, func() error {
-		return util.ExecuteHttpWithRetry(rCtx, resource.GlobalConfig, func() error {
+	begin := time.Now()
+	attempt := 0
+	err := opts.limiterFor(req.URL).ExecuteWithLimit(rCtx, func() error {
+		trace.LimiterWait = time.Since(begin)
+		var err error
+		trace.Attempts, err = util.ExecuteHttpWithRetry(rCtx, opts.retry, func() error {
 			// 创建HTTP请求
 			in := resource.RestyClient.R().SetContext(rCtx)
+			if opts.har != nil {
+				in.EnableTrace()
+			}
 			for _, item := range req.Headers {
-				strList := strings.Split(item, ":")
-				in.SetHeader(strings.TrimSpace(strList[0]), strings.TrimSpace(strList[1]))
+				in.SetHeader(splitHeader(item))
 			}
 
 			in.SetHeader("Accept", "*/*")
@@ -178,6 +376,8 @@ func (m *HttpTestCallable) Call(ctx context.Context) *executor.GPResult {
 
 			// 执行HTTP请求
 			var requestErr error
+			attempt++
+			started := time.Now()
 			if method == "GET" {
 				out, requestErr = in.Get(req.URL)
 			} else {
@@ -193,63 +393,38 @@ func (m *HttpTestCallable) Call(ctx context.Context) *executor.GPResult {
 					out, requestErr = in.Get(req.URL)
 				}
 			}
+			if opts.har != nil {
+				opts.har.Record(opts.harCase, attempt, started, in, out, requestErr)
+			}
+			if requestErr == nil && opts.retry.RetryOnStatus(out.StatusCode()) {
+				return &util.RetryableStatusError{Status: out.Status(),
+					RetryAfter: util.ParseRetryAfter(out.Header().Get("Retry-After"), time.Now())}
+			}
 			return requestErr
 		})
+		return err
 	})
 
-	if err != nil {
-		zaplog.Error("HttpTestCallable rules verify failed",
-			zap.Uint64("testCaseId", m.testcase.ID),
-			zap.Error(err),
-		)
-		tcResult.State = model.StateFailed
-		tcResult.Reason = model.ReasonRequestFailed
-		tcResult.Error = err
-		r.Value = tcResult
-		r.Err = err
-		return &r
-	}
-
-	tcResult.Response = out
-
-	// 6. export
-	if m.testcase.Export != nil {
-		exportConfig := m.testcase.Export
-		// TODO handle error
-		value, _ := exportTo(out.String(), exportConfig)
-		tcResult.KeyValues[exportConfig.ExportTo] = value
-	}
-
-	// 7. verify
-	for idx, rule := range m.testcase.VerifyRules {
-		VerifyResult := rule.Verify(out)
-		if !VerifyResult {
-			zaplog.Error("HttpTestCallable rules validate failed",
-				zap.Uint64("testCaseId", m.testcase.ID),
-				zap.Int("ruleIdx", idx+1),
-				zap.Any("rule", m.testcase.VerifyRules[idx]))
-
-			tcResult.State = model.StateFailed
-			tcResult.Reason = model.ReasonRuleVerifyFailed
-			break
-		}
+	if err != nil && trace.Attempts == nil {
+		// the request never got through the rate limiter
+		trace.LimiterWait = time.Since(begin)
 	}
-	r.Value = tcResult
-	r.Err = nil
-	return &r
+	return out, trace, err
 }
 
-func renderRequestHttpWithVars(req config.RequestHttp, vars *sync.Map) (config.RequestHttp, error) {
+func renderRequestHttpWithVars(req config.RequestHttp, vars *sync.Map,
+	rowVars map[string]any) (config.RequestHttp, error) {
 	var err error
 	// url
-	req.URL, err = templateRenderWithVars(req.URL, vars)
+	req.URL, err = templateRenderWithVars(req.URL, vars, rowVars)
 	if err != nil {
 		return req, err
 	}
 
-	// headers
+	// headers, the slice is shared with the testcase
+	req.Headers = slices.Clone(req.Headers)
 	for i := 0; i < len(req.Headers); i++ {
-		req.Headers[i], err = templateRenderWithVars(req.Headers[i], vars)
+		req.Headers[i], err = templateRenderWithVars(req.Headers[i], vars, rowVars)
 		if err != nil {
 			return req, err
 		}
@@ -268,12 +443,12 @@ func renderRequestHttpWithVars(req config.RequestHttp, vars *sync.Map) (config.R
 		if err != nil {
 			zaplog.Error("renderRequestHttp-luaBody",
 				zap.String("LuaStr", req.LuaBody),
-				zap.Error(err))
+				zap.String("error", maskedError(err)))
 			return req, err
 		}
 		req.Body = value.String()
 	} else {
-		req.Body, err = templateRenderWithVars(req.Body, vars)
+		req.Body, err = templateRenderWithVars(req.Body, vars, rowVars)
 		if err != nil {
 			return req, err
 		}
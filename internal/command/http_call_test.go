@@ -0,0 +1,212 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func initHttpCallTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.KeyedRateLimiters = nil
+	resource.TargetRateLimiters = nil
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+}
+
+func TestInitRetryClientStatusCodes(t *testing.T) {
+	initHttpCallTestResource(t)
+
+	// a response is not retried because of its status unless the status code is listed
+	resource.InitRetryClient()
+	assert.Empty(t, resource.GlobalConfig.Global.Retry.RetryOnStatusCodes)
+	assert.False(t, newRequestOptions(config.RequestOptions{}).retry.RetryOnStatus(500))
+	opts := newRequestOptions(config.RequestOptions{Retry: &config.Retry{StatusCodes: []int{502}}})
+	assert.True(t, opts.retry.RetryOnStatus(502))
+}
+
+func TestNewRequestOptions(t *testing.T) {
+	initHttpCallTestResource(t)
+	resource.GlobalConfig.Global.Retry.RetryDelay = time.Second
+	resource.KeyedRateLimiters = map[string]*util.RateLimiter{"export": util.NewRateLimiter(1, 1)}
+
+	// global settings
+	opts := newRequestOptions(config.RequestOptions{})
+	assert.Equal(t, time.Second, opts.timeout)
+	assert.Equal(t, 1, opts.retry.MaxAttempts)
+	assert.Same(t, resource.RateLimiter, opts.limiter)
+
+	// the testcase inherits the options of the rule file
+	tcOpts := config.RequestOptions{Retry: &config.Retry{MaxAttempts: 5}}
+	tcOpts.Inherit(config.RequestOptions{
+		Timeout:      40 * time.Second,
+		Retry:        &config.Retry{MaxAttempts: 2, StatusCodes: []int{503}},
+		RateLimitKey: "export",
+	})
+	opts = newRequestOptions(tcOpts)
+	assert.Equal(t, 40*time.Second, opts.timeout)
+	assert.Equal(t, 5, opts.retry.MaxAttempts)
+	assert.Equal(t, time.Second, opts.retry.Delay)
+	assert.True(t, opts.retry.RetryOnStatus(503))
+	assert.Same(t, resource.KeyedRateLimiters["export"], opts.limiter)
+}
+
+func TestDoHttpRequestRetryOnStatus(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	initHttpCallTestResource(t)
+	req := config.RequestHttp{Method: "get", URL: server.URL}
+
+	// no status codes configured, the response is returned as it is
+	out, _, err := doHttpRequest(context.Background(), req, newRequestOptions(config.RequestOptions{}))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, out.StatusCode())
+	assert.Equal(t, int32(1), count.Load())
+
+	// retried until it succeeds
+	count.Store(0)
+	retry := &config.Retry{MaxAttempts: 3, Delay: time.Millisecond, StatusCodes: []int{503}}
+	out, trace, err := doHttpRequest(context.Background(), req,
+		newRequestOptions(config.RequestOptions{Retry: retry}))
+	attempts := trace.Attempts
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, out.StatusCode())
+	assert.Equal(t, int32(3), count.Load())
+	// every attempt is recorded
+	assert.Len(t, attempts, 3)
+	assert.Contains(t, attempts[0].Error, "503")
+	assert.Equal(t, time.Millisecond, attempts[0].Delay)
+	assert.Empty(t, attempts[2].Error)
+
+	// the response of the last attempt is kept for the rules
+	count.Store(0)
+	retry.MaxAttempts = 2
+	out, _, err = doHttpRequest(context.Background(), req, newRequestOptions(config.RequestOptions{Retry: retry}))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, out.StatusCode())
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestDoHttpRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+	initHttpCallTestResource(t)
+	resource.GlobalConfig.Global.RequestTimeout = 50 * time.Millisecond
+	req := config.RequestHttp{Method: "get", URL: server.URL}
+
+	_, _, err := doHttpRequest(context.Background(), req, newRequestOptions(config.RequestOptions{}))
+	assert.Error(t, err)
+
+	// the timeout of the testcase overrides the global one
+	out, _, err := doHttpRequest(context.Background(), req,
+		newRequestOptions(config.RequestOptions{Timeout: time.Second}))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, out.StatusCode())
+}
+
+func TestDoHttpRequestHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Referer") + "|" + r.Header.Get("X-Empty") + "|")) //nolint: errcheck
+	}))
+	defer server.Close()
+	initHttpCallTestResource(t)
+	// the value is split at the first colon only
+	req := config.RequestHttp{Method: "get", URL: server.URL,
+		Headers: []string{"Referer: http://localhost:8080/books", "X-Empty"}}
+
+	out, _, err := doHttpRequest(context.Background(), req, newRequestOptions(config.RequestOptions{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/books||", out.String())
+	assert.Contains(t, curlCommand(req), "-H 'Referer: http://localhost:8080/books'")
+}
+
+func TestDoHttpRequestRetryAfter(t *testing.T) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1) < 2 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+	initHttpCallTestResource(t)
+	req := config.RequestHttp{Method: "get", URL: server.URL}
+
+	// the delay given by the server wins over the backoff and its cap
+	retry := &config.Retry{MaxAttempts: 2, Delay: time.Millisecond, MaxDelay: time.Millisecond,
+		StatusCodes: []int{429}}
+	out, trace, err := doHttpRequest(context.Background(), req,
+		newRequestOptions(config.RequestOptions{Timeout: 5 * time.Second, Retry: retry}))
+	attempts := trace.Attempts
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, out.StatusCode())
+	assert.Len(t, attempts, 2)
+	assert.Equal(t, time.Second, attempts[0].Delay)
+	assert.True(t, attempts[0].ServerHint)
+}
+
+func TestRequestOptionsLimiterFor(t *testing.T) {
+	initHttpCallTestResource(t)
+	export := util.NewRateLimiter(1, 1)
+	slow := util.NewRateLimiter(1, 1)
+	resource.KeyedRateLimiters = map[string]*util.RateLimiter{"export": export, "slow": slow}
+	resource.TargetRateLimiters = util.NewTargetRateLimiters(true, 2, 10)
+	resource.TargetRateLimiters.AddGroup(regexp.MustCompile(`^http://slow\.example\.com/`), slow)
+
+	opts := newRequestOptions(config.RequestOptions{})
+	// a key whose pattern matches the URL
+	assert.Same(t, slow, opts.limiterFor("http://slow.example.com/api/books"))
+	// every host has its own limiter, the gRPC address is the host
+	a := opts.limiterFor("http://a.example.com/api/books")
+	assert.Same(t, a, opts.limiterFor("http://a.example.com/api/authors"))
+	assert.NotSame(t, a, opts.limiterFor("http://b.example.com/api/books"))
+	assert.NotSame(t, resource.RateLimiter, a)
+	assert.Same(t, opts.limiterFor("127.0.0.1:50031"), opts.limiterFor("127.0.0.1:50031"))
+
+	// rateLimitKey of the testcase wins over the target
+	opts = newRequestOptions(config.RequestOptions{RateLimitKey: "export"})
+	assert.Same(t, export, opts.limiterFor("http://slow.example.com/api/books"))
+
+	// without per-host limiting, the other targets use the global limiter
+	resource.TargetRateLimiters = util.NewTargetRateLimiters(false, 0, 0)
+	opts = newRequestOptions(config.RequestOptions{})
+	assert.Same(t, resource.RateLimiter, opts.limiterFor("http://a.example.com/api/books"))
+}
+
+func TestDoHttpRequestLimiterWait(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	initHttpCallTestResource(t)
+	resource.GlobalConfig.Global.RequestTimeout = 5 * time.Second
+	// one request per second
+	resource.RateLimiter = util.NewRateLimiter(1, 1)
+	req := config.RequestHttp{Method: "get", URL: server.URL}
+
+	_, trace, err := doHttpRequest(context.Background(), req, newRequestOptions(config.RequestOptions{}))
+	assert.NoError(t, err)
+	assert.Less(t, trace.LimiterWait, 500*time.Millisecond)
+
+	_, trace, err = doHttpRequest(context.Background(), req, newRequestOptions(config.RequestOptions{}))
+	assert.NoError(t, err)
+	assert.Greater(t, trace.LimiterWait, 500*time.Millisecond)
+	assert.Len(t, trace.Attempts, 1)
+}
@@ -0,0 +1,149 @@
+package command
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/util"
+)
+
+// notifierServer records the requests of each path
+type notifierServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string][]*http.Request
+	bodies   map[string][]map[string]any
+}
+
+func newNotifierServer() *notifierServer {
+	s := &notifierServer{requests: map[string][]*http.Request{}, bodies: map[string][]map[string]any{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		json.Unmarshal(b, &body) //nolint: errcheck
+		s.mu.Lock()
+		s.requests[r.URL.Path] = append(s.requests[r.URL.Path], r)
+		s.bodies[r.URL.Path] = append(s.bodies[r.URL.Path], body)
+		s.mu.Unlock()
+		switch r.URL.Path {
+		case "/dingtalk-error":
+			w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`)) //nolint: errcheck
+		case "/feishu":
+			w.Write([]byte(`{"code":0,"msg":"success"}`)) //nolint: errcheck
+		default:
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`)) //nolint: errcheck
+		}
+	}))
+	return s
+}
+
+func newNotificationConfig(channels ...config.NotifierChannel) config.AutoTestConfig {
+	var cfg config.AutoTestConfig
+	cfg.Global.Notifications.Enabled = true
+	cfg.Global.Notifications.OnFailure = true
+	cfg.Global.Notifications.Channels = channels
+	return cfg
+}
+
+func TestSendTestResultChannels(t *testing.T) {
+	server := newNotifierServer()
+	defer server.Close()
+
+	yes, no := true, false
+	cfg := newNotificationConfig(
+		config.NotifierChannel{Type: util.NotifierDingTalk, WebhookURL: server.URL + "/dingtalk?access_token=x", Secret: "SEC1"},
+		config.NotifierChannel{Type: util.NotifierFeishu, WebhookURL: server.URL + "/feishu", Secret: "SEC2", Locale: "en"},
+		config.NotifierChannel{Type: util.NotifierWeCom, WebhookURL: server.URL + "/wecom"},
+		config.NotifierChannel{Type: util.NotifierTeams, WebhookURL: server.URL + "/teams", Locale: "en"},
+		config.NotifierChannel{Type: util.NotifierWebhook, WebhookURL: server.URL + "/webhook",
+			Headers:  map[string]string{"Authorization": "Bearer t"},
+			Template: `{"status": "{{ .Status }}", "failed": {{ .Result.FailedTests }}, "title": {{ json .Title }}}`},
+		// only notified on success
+		config.NotifierChannel{Type: util.NotifierSlack, WebhookURL: server.URL + "/slack", OnSuccess: &yes, OnFailure: &no},
+	)
+	cfg.Global.Notifications.WebhookURL = server.URL + "/legacy"
+
+	result := util.TestResult{TotalTests: 3, PassedTests: 1, FailedTests: 2,
+		FailedCases: []string{"HTTP_1: get book", "HTTP_2: add book"}}
+	assert.NoError(t, util.NewNotificationService(cfg).SendTestResult(result))
+
+	// the legacy webhook_url is a slack channel with the global filters
+	legacy := server.bodies["/legacy"][0]
+	assert.Equal(t, "AutoTest 执行完成 - ❌ 失败", legacy["text"])
+	assert.Equal(t, "danger", legacy["attachments"].([]any)[0].(map[string]any)["color"])
+	assert.Empty(t, server.requests["/slack"])
+
+	// dingtalk: HmacSHA256(timestamp+"\n"+secret) signed with the secret
+	query := server.requests["/dingtalk"][0].URL.Query()
+	assert.Equal(t, "x", query.Get("access_token"))
+	mac := hmac.New(sha256.New, []byte("SEC1"))
+	mac.Write([]byte(query.Get("timestamp") + "\nSEC1"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), query.Get("sign"))
+	dingtalk := server.bodies["/dingtalk"][0]["markdown"].(map[string]any)
+	assert.Contains(t, dingtalk["text"], "- **失败数**: 2")
+	assert.Contains(t, dingtalk["text"], "• HTTP_2: add book")
+
+	// feishu: HmacSHA256 of empty data with timestamp+"\n"+secret as the key
+	feishu := server.bodies["/feishu"][0]
+	timestamp, _ := strconv.ParseInt(feishu["timestamp"].(string), 10, 64)
+	_, sign := util.FeishuSign("SEC2", time.Unix(timestamp, 0))
+	assert.Equal(t, sign, feishu["sign"])
+	header := feishu["card"].(map[string]any)["header"].(map[string]any)
+	assert.Equal(t, "AutoTest finished - ❌ Failed", header["title"].(map[string]any)["content"])
+	assert.Equal(t, "red", header["template"])
+
+	wecom := server.bodies["/wecom"][0]["markdown"].(map[string]any)
+	assert.Contains(t, wecom["content"], "### AutoTest 执行完成 - ❌ 失败")
+
+	teams := server.bodies["/teams"][0]
+	assert.Equal(t, "MessageCard", teams["@type"])
+	facts := teams["sections"].([]any)[0].(map[string]any)["facts"].([]any)
+	assert.Equal(t, map[string]any{"name": "Failed", "value": "2"}, facts[2])
+
+	webhook := server.bodies["/webhook"][0]
+	assert.Equal(t, map[string]any{"status": "failed", "failed": float64(2),
+		"title": "AutoTest 执行完成 - ❌ 失败"}, webhook)
+	assert.Equal(t, "Bearer t", server.requests["/webhook"][0].Header.Get("Authorization"))
+
+	// on success only the channel which enables it is notified
+	assert.NoError(t, util.NewNotificationService(cfg).SendTestResult(util.TestResult{TotalTests: 1, PassedTests: 1}))
+	assert.Len(t, server.requests["/slack"], 1)
+	assert.Len(t, server.requests["/legacy"], 1)
+}
+
+func TestSendTestResultChannelError(t *testing.T) {
+	server := newNotifierServer()
+	defer server.Close()
+
+	cfg := newNotificationConfig(
+		config.NotifierChannel{Name: "ding", Type: util.NotifierDingTalk, WebhookURL: server.URL + "/dingtalk-error"},
+		config.NotifierChannel{Type: util.NotifierWeCom, WebhookURL: server.URL + "/wecom"},
+	)
+	err := util.NewNotificationService(cfg).SendTestResult(util.TestResult{TotalTests: 1, FailedTests: 1})
+	assert.ErrorContains(t, err, "channel ding: webhook returned errcode:310000")
+	// the other channels are still notified
+	assert.Len(t, server.requests["/wecom"], 1)
+
+	// too many failed cases are truncated
+	var failedCases []string
+	for i := 0; i < 12; i++ {
+		failedCases = append(failedCases, fmt.Sprintf("HTTP_%d", i))
+	}
+	cfg = newNotificationConfig(config.NotifierChannel{Type: util.NotifierWeCom, WebhookURL: server.URL + "/wecom", Locale: "en"})
+	assert.NoError(t, util.NewNotificationService(cfg).SendTestResult(util.TestResult{FailedTests: 12, FailedCases: failedCases}))
+	content := server.bodies["/wecom"][1]["markdown"].(map[string]any)["content"].(string)
+	assert.Contains(t, content, "• HTTP_9\n... and 2 more failed cases\n")
+	assert.NotContains(t, content, "HTTP_10")
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"math/rand"
+	"slices"
+
+	"github.com/vearne/autotest/internal/resource"
+)
+
+// ruleFileOrder returns the rule files in the order they are listed in the config file,
+// so that the variables shared between rule files in serial mode are always exported in the same order.
+// Each rule file appears only once, rule files that are not listed come last in lexical order.
+func ruleFileOrder[T any](testCases map[string][]T, ruleFiles []string) []string {
+	order := make([]string, 0, len(testCases))
+	for _, filePath := range ruleFiles {
+		if _, ok := testCases[filePath]; ok && !slices.Contains(order, filePath) {
+			order = append(order, filePath)
+		}
+	}
+
+	var rest []string
+	for filePath := range testCases {
+		if !slices.Contains(order, filePath) {
+			rest = append(rest, filePath)
+		}
+	}
+	slices.Sort(rest)
+	return append(order, rest...)
+}
+
+// shuffleTestCases randomises the order of the rule files and the order of the testcases in each of them,
+// to uncover hidden dependencies on the execution order.
+// The same seed and config files always produce the same order.
+func shuffleTestCases(seed int64) {
+	r := rand.New(rand.NewSource(seed))
+
+	httpFiles := ruleFileOrder(resource.HttpTestCases, resource.GlobalConfig.HttpRuleFiles)
+	shuffle(r, httpFiles)
+	resource.GlobalConfig.HttpRuleFiles = httpFiles
+	for _, filePath := range httpFiles {
+		shuffle(r, resource.HttpTestCases[filePath])
+	}
+
+	grpcFiles := ruleFileOrder(resource.GrpcTestCases, resource.GlobalConfig.GrpcRuleFiles)
+	shuffle(r, grpcFiles)
+	resource.GlobalConfig.GrpcRuleFiles = grpcFiles
+	for _, filePath := range grpcFiles {
+		shuffle(r, resource.GrpcTestCases[filePath])
+	}
+}
+
+func shuffle[T any](r *rand.Rand, list []T) {
+	r.Shuffle(len(list), func(i, j int) {
+		list[i], list[j] = list[j], list[i]
+	})
+}
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/resource"
+)
+
+func TestRuleFileOrder(t *testing.T) {
+	testCases := map[string][]int{
+		"/rules/c.yml": nil,
+		"/rules/a.yml": nil,
+		"/rules/b.yml": nil,
+		"/rules/z.yml": nil,
+		"/rules/y.yml": nil,
+	}
+	ruleFiles := []string{"/rules/c.yml", "/rules/a.yml", "/rules/c.yml", "/rules/b.yml", "/rules/missing.yml"}
+	expected := []string{"/rules/c.yml", "/rules/a.yml", "/rules/b.yml", "/rules/y.yml", "/rules/z.yml"}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expected, ruleFileOrder(testCases, ruleFiles))
+	}
+}
+
+func initShuffleTestResource() {
+	resource.GlobalConfig.HttpRuleFiles = []string{"/rules/a.yml", "/rules/b.yml", "/rules/c.yml"}
+	resource.GlobalConfig.GrpcRuleFiles = nil
+	resource.HttpTestCases = map[string][]*config.TestCaseHttp{}
+	for _, filePath := range resource.GlobalConfig.HttpRuleFiles {
+		for id := uint64(1); id <= 10; id++ {
+			resource.HttpTestCases[filePath] = append(resource.HttpTestCases[filePath], &config.TestCaseHttp{ID: id})
+		}
+	}
+	resource.GrpcTestCases = map[string][]*config.TestCaseGrpc{}
+}
+
+func httpCaseOrder() map[string][]uint64 {
+	order := make(map[string][]uint64)
+	for filePath, testcases := range resource.HttpTestCases {
+		for _, tc := range testcases {
+			order[filePath] = append(order[filePath], tc.ID)
+		}
+	}
+	return order
+}
+
+func TestShuffleTestCases(t *testing.T) {
+	restoreResource(t)
+
+	initShuffleTestResource()
+	shuffleTestCases(42)
+	files := resource.GlobalConfig.HttpRuleFiles
+	cases := httpCaseOrder()
+
+	// the same seed produces the same order
+	initShuffleTestResource()
+	shuffleTestCases(42)
+	assert.Equal(t, files, resource.GlobalConfig.HttpRuleFiles)
+	assert.Equal(t, cases, httpCaseOrder())
+
+	// all the rule files and testcases are kept
+	assert.ElementsMatch(t, []string{"/rules/a.yml", "/rules/b.yml", "/rules/c.yml"}, files)
+	for _, ids := range cases {
+		assert.ElementsMatch(t, []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, ids)
+	}
+
+	// a different seed produces a different order
+	initShuffleTestResource()
+	shuffleTestCases(7)
+	assert.NotEqual(t, cases, httpCaseOrder())
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestGenReportFileHttpCasePage(t *testing.T) {
+	restoreResource(t)
+	reportDir := t.TempDir()
+	resource.GlobalConfig.Global.Report.DirPath = reportDir
+	resource.GlobalConfig.Global.Report.Formats = []string{"json"}
+
+	filePath := "/rules/book.yml"
+	tcResultList := []HttpTestCaseResult{{ID: 3, Desc: "add book", State: model.StateSuccessFul, Reason: model.ReasonSuccess,
+		Request: config.RequestHttp{Method: "post", URL: "http://localhost:8080/api/books", Body: `{"title":"Go","tags":["a"]}`},
+		Steps:   []util.CaseStep{{Name: util.StepRender, Status: util.StatusPassed}}}}
+	GenReportFileHttp(filePath, tcResultList, &ResultInfo{Total: 1, SuccessCount: 1})
+
+	index, err := os.ReadFile(filepath.Join(reportDir, "book.html"))
+	assert.NoError(t, err)
+	link := util.CaseDetailLink(reportDir, filePath, 3)
+	assert.Contains(t, string(index), `<a href="`+link+`">View Details</a>`)
+
+	b, err := os.ReadFile(filepath.Join(reportDir, link))
+	assert.NoError(t, err)
+	page := string(b)
+	assert.Contains(t, page, "<title>HTTP_3: add book</title>")
+	assert.Contains(t, page, `<a href="../book.html">`)
+	// report.html is not generated
+	assert.NotContains(t, page, "../report.html")
+	// the JSON body is pretty printed
+	assert.Contains(t, page, "BODY:\n{\n  &#34;title&#34;: &#34;Go&#34;,\n  &#34;tags&#34;: [\n    &#34;a&#34;\n  ]\n}\n")
+
+	// the command to reproduce the request
+	assert.Contains(t, page, "<pre>curl \\\n  -X POST \\\n  http://localhost:8080/api/books \\\n")
+
+	assert.Equal(t, "not json", util.PrettyJSON("not json"))
+}
@@ -0,0 +1,171 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	slog "github.com/vearne/simplelog"
+)
+
+// shellSafe matches the arguments which need no quoting
+var shellSafe = regexp.MustCompile(`^[a-zA-Z0-9_\-./:=@%+,]+$`)
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// joinCommand joins the arguments of a command, one option per line
+func joinCommand(args [][]string) string {
+	lines := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted := make([]string, 0, len(arg))
+		for _, item := range arg {
+			quoted = append(quoted, shellQuote(item))
+		}
+		lines = append(lines, strings.Join(quoted, " "))
+	}
+	return strings.Join(lines, " \\\n  ")
+}
+
+// curlCommand returns the curl command sending the same request as doHttpRequest,
+// req must be rendered
+func curlCommand(req config.RequestHttp) string {
+	// doHttpRequest sends the other methods as GET
+	method := strings.ToUpper(req.Method)
+	if method != "POST" && method != "PUT" && method != "DELETE" {
+		method = "GET"
+	}
+
+	args := [][]string{{"curl"}}
+	if method != "GET" || len(req.Body) > 0 {
+		args = append(args, []string{"-X", method})
+	}
+	args = append(args, []string{req.URL})
+	var contentType bool
+	for _, item := range req.Headers {
+		name, value := splitHeader(item)
+		// Accept is always overridden
+		if strings.EqualFold(name, "Accept") {
+			continue
+		}
+		contentType = contentType || strings.EqualFold(name, "Content-Type")
+		args = append(args, []string{"-H", name + ": " + value})
+	}
+	args = append(args, []string{"-H", "Accept: */*"})
+	if len(req.Body) > 0 {
+		// the content type resty detects for a string body
+		if !contentType {
+			args = append(args, []string{"-H", "Content-Type: text/plain; charset=utf-8"})
+		}
+		args = append(args, []string{"--data-raw", req.Body})
+	}
+	return joinCommand(args)
+}
+
+// grpcurlCommand returns the grpcurl command sending the same request as invokeGrpc,
+// req must be rendered
+func grpcurlCommand(req config.RequestGrpc) string {
+	// dial connects without TLS
+	args := [][]string{{"grpcurl", "-plaintext"}}
+	for _, item := range req.Headers {
+		args = append(args, []string{"-H", item})
+	}
+	if len(req.Body) > 0 {
+		args = append(args, []string{"-d", req.Body})
+	}
+	args = append(args, []string{req.Address, req.Symbol})
+	return joinCommand(args)
+}
+
+// ReproCommand is the curl command of the actual request, empty if the request was not rendered
+func (t *HttpTestCaseResult) ReproCommand() string {
+	if len(t.Steps) <= 0 || t.Reason == model.ReasonTemplateRenderError {
+		return ""
+	}
+	return curlCommand(t.Request)
+}
+
+// ReproCommand is the grpcurl command of the actual request, empty if the request was not rendered
+func (t *GrpcTestCaseResult) ReproCommand() string {
+	if len(t.Steps) <= 0 || t.Reason == model.ReasonTemplateRenderError {
+		return ""
+	}
+	return grpcurlCommand(t.Request)
+}
+
+// PrintRepro prints the curl or grpcurl commands of the selected testcases,
+// the requests are rendered with the variables of the global setup and the setup of the rule file.
+// The values of the secrets are masked unless --show-secrets is set.
+func PrintRepro(ctx context.Context, cmd *cli.Command) error {
+	confFilePath := cmd.String("config-file")
+	environment := cmd.String("environment")
+	slog.Info("config-file:%v, environment:%v", confFilePath, environment)
+
+	err := initRun(confFilePath, environment, cmd.StringSlice("var"))
+	if err != nil {
+		return err
+	}
+
+	targets := selectBenchTargets([]string{cmd.String("file")}, []int{int(cmd.Int("id"))})
+	if len(targets) <= 0 {
+		return cli.Exit(fmt.Sprintf("testcase not found, file:%v, id:%v", cmd.String("file"), cmd.Int("id")),
+			model.ExitCodeConfigError)
+	}
+
+	teardown, err := setupTargets(ctx, targets)
+	defer teardown()
+	if err != nil {
+		return cli.Exit(err.Error(), model.ExitCodeInfraError)
+	}
+
+	var b strings.Builder
+	err = writeRepro(&b, targets)
+	if err != nil {
+		return cli.Exit(maskedError(err), model.ExitCodeConfigError)
+	}
+	output := b.String()
+	if !cmd.Bool("show-secrets") {
+		output = resource.SecretMasker.Mask(output)
+	}
+	fmt.Fprint(os.Stdout, output)
+	return nil
+}
+
+// writeRepro writes the commands of the targets, a data-driven testcase has a command per row
+func writeRepro(w io.Writer, targets []*benchTarget) error {
+	for i, target := range targets {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		var command string
+		if target.http != nil {
+			req, err := renderRequestHttpWithVars(target.http.Request, target.vars, target.http.RowVars)
+			if err != nil {
+				return fmt.Errorf("render http testcase, file:%v, id:%v, %w", target.filePath, target.id(), err)
+			}
+			fmt.Fprintf(w, "# HTTP_%d: %v\n", target.http.ID, target.http.Desc)
+			command = curlCommand(req)
+		} else {
+			req, err := renderRequestGrpcWithVars(target.grpc.Request, target.vars, target.grpc.RowVars)
+			if err != nil {
+				return fmt.Errorf("render grpc testcase, file:%v, id:%v, %w", target.filePath, target.id(), err)
+			}
+			fmt.Fprintf(w, "# GRPC_%d: %v\n", target.grpc.ID, target.grpc.Desc)
+			command = grpcurlCommand(req)
+		}
+		fmt.Fprintln(w, command)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/util"
+)
+
+func TestCurlCommand(t *testing.T) {
+	req := config.RequestHttp{Method: "post", URL: "http://localhost:8080/api/books?lang=go&page=1",
+		Headers: []string{"Content-Type: application/json", "Accept: text/html", "Authorization: Basic a:b"},
+		Body:    `{"title": "Let's Go"}`}
+	assert.Equal(t, `curl \
+  -X POST \
+  'http://localhost:8080/api/books?lang=go&page=1' \
+  -H 'Content-Type: application/json' \
+  -H 'Authorization: Basic a:b' \
+  -H 'Accept: */*' \
+  --data-raw '{"title": "Let'\''s Go"}'`, curlCommand(req))
+
+	// no -X for a GET without body
+	req = config.RequestHttp{Method: "get", URL: "http://localhost:8080/api/books/1"}
+	assert.Equal(t, "curl \\\n  http://localhost:8080/api/books/1 \\\n  -H 'Accept: */*'", curlCommand(req))
+
+	// the other methods are sent as GET, a string body is sent as text/plain
+	req = config.RequestHttp{Method: "patch", URL: "http://localhost:8080/", Body: "a"}
+	command := curlCommand(req)
+	assert.Contains(t, command, "-X GET")
+	assert.Contains(t, command, "-H 'Content-Type: text/plain; charset=utf-8'")
+}
+
+func TestGrpcurlCommand(t *testing.T) {
+	req := config.RequestGrpc{Address: "localhost:50031", Symbol: "Greeter/SayHello",
+		Headers: []string{"token: a b"}, Body: `{"name": "matt"}`}
+	assert.Equal(t, `grpcurl -plaintext \
+  -H 'token: a b' \
+  -d '{"name": "matt"}' \
+  localhost:50031 Greeter/SayHello`, grpcurlCommand(req))
+}
+
+func TestReproCommandNotRendered(t *testing.T) {
+	tcResult := HttpTestCaseResult{Request: config.RequestHttp{Method: "get", URL: "http://{{ HOST }}/"}}
+	assert.Equal(t, "", tcResult.ReproCommand())
+	tcResult.Steps = []util.CaseStep{{Name: util.StepRender, Status: util.StatusFailed}}
+	tcResult.Reason = model.ReasonTemplateRenderError
+	assert.Equal(t, "", tcResult.ReproCommand())
+	tcResult.Reason = model.ReasonSuccess
+	tcResult.Request.URL = "http://localhost/"
+	assert.Contains(t, tcResult.ReproCommand(), "http://localhost/")
+}
+
+func TestWriteRepro(t *testing.T) {
+	vars := &sync.Map{}
+	vars.Store("TOKEN", "t1")
+	targets := []*benchTarget{
+		{filePath: "/rules/book.yml", vars: vars, http: &config.TestCaseHttp{ID: 2001, ParentID: 2, Desc: "get book",
+			Request: config.RequestHttp{Method: "get", URL: "http://localhost/books/{{ BOOK_ID }}",
+				Headers: []string{"Authorization: Bearer {{ TOKEN }}"}},
+			RowVars: map[string]any{"BOOK_ID": 7}}},
+		{filePath: "/rules/hello.yml", vars: vars, grpc: &config.TestCaseGrpc{ID: 1, Desc: "say hello",
+			Request: config.RequestGrpc{Address: "localhost:50031", Symbol: "Greeter/SayHello",
+				Body: `{"token": "{{ TOKEN }}"}`}}},
+	}
+	var b strings.Builder
+	assert.NoError(t, writeRepro(&b, targets))
+	assert.Equal(t, `# HTTP_2001: get book
+curl \
+  http://localhost/books/7 \
+  -H 'Authorization: Bearer t1' \
+  -H 'Accept: */*'
+
+# GRPC_1: say hello
+grpcurl -plaintext \
+  -d '{"token": "t1"}' \
+  localhost:50031 Greeter/SayHello
+`, b.String())
+
+	targets[0].http.Request.URL = "http://{{ HOST"
+	assert.ErrorContains(t, writeRepro(&b, targets[:1]), "render http testcase, file:/rules/book.yml, id:2001")
+}
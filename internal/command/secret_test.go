@@ -0,0 +1,105 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/resource"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
+	"go.uber.org/zap"
+)
+
+func TestValidateSecrets(t *testing.T) {
+	assert.NoError(t, ValidateSecrets([]config.Secret{{Name: "TOKEN"}, {Name: "KEY", Env: "API_KEY"}}))
+	assert.ErrorContains(t, ValidateSecrets([]config.Secret{{Env: "API_KEY"}}), "name is required")
+	assert.ErrorContains(t, ValidateSecrets([]config.Secret{{Name: "A"}, {Name: "A"}}), "duplicate")
+	assert.ErrorContains(t, ValidateSecrets([]config.Secret{{Name: "A", Env: "A", File: "a"}}),
+		"only one of env and file")
+}
+
+func TestLoadSecrets(t *testing.T) {
+	restoreResource(t)
+	filePath := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(filePath, []byte("pass-from-file\n"), 0600))
+	t.Setenv("AUTOTEST_TEST_API_KEY", "key-from-env")
+	resource.GlobalConfig.Secrets = []config.Secret{{Name: "PASSWORD", File: filePath},
+		{Name: "API_KEY", Env: "AUTOTEST_TEST_API_KEY"}, {Name: "TOKEN"}}
+	resource.EnvVars["TOKEN"] = "token-from-environment"
+	resource.EnvVars["HOST"] = "localhost"
+
+	assert.NoError(t, resource.LoadSecrets())
+	assert.Equal(t, "pass-from-file", resource.EnvVars["PASSWORD"])
+	assert.Equal(t, "key-from-env", resource.EnvVars["API_KEY"])
+	assert.Equal(t, "****** ****** ****** localhost",
+		resource.SecretMasker.Mask("pass-from-file key-from-env token-from-environment localhost"))
+	// the rules mask their output too
+	assert.Equal(t, "body ******", rule.Mask("body pass-from-file"))
+
+	resource.GlobalConfig.Secrets = []config.Secret{{Name: "API_KEY", Env: "AUTOTEST_TEST_NOT_SET"}}
+	assert.ErrorContains(t, resource.LoadSecrets(), "environment variable AUTOTEST_TEST_NOT_SET is not set")
+}
+
+func initSecretTestResource(t *testing.T) {
+	restoreResource(t)
+	resource.RestyClient = resty.New()
+	resource.RateLimiter = util.NewRateLimiter(10, 100)
+	resource.GlobalConfig.Global.RequestTimeout = time.Second
+	resource.GlobalConfig.Global.Retry.MaxAttempts = 1
+	resource.SecretMasker = util.NewSecretMasker([]string{"API_KEY", "SESSION"})
+	resource.HarRecorder = util.NewHarRecorder(nil)
+	resource.HarRecorder.SetSecretMasker(resource.SecretMasker)
+}
+
+func TestSecretsMaskedInResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"session": "session-secret", "key": "` + r.URL.Query().Get("key") + `"}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	initSecretTestResource(t)
+	resource.SecretMasker.Add("key-secret")
+
+	vars := &sync.Map{}
+	vars.Store("API_KEY", "key-secret")
+	testcase := &config.TestCaseHttp{
+		ID:      1,
+		Desc:    "login",
+		Request: config.RequestHttp{Method: "get", URL: server.URL + "/login?key={{ API_KEY }}"},
+		Export:  &config.Export{ExportTo: "SESSION", JSONPath: "$.session"},
+	}
+	callable := &HttpTestCallable{filePath: "/rules/login.yml", testcase: testcase,
+		stateGroup: model.NewStateGroup(), vars: vars}
+	tcResult := callable.Call(context.Background()).Value.(HttpTestCaseResult)
+	assert.Equal(t, model.StateSuccessFul, tcResult.State)
+
+	// the exported value is a secret too
+	results := &UnifiedTestResults{TestCases: []util.TestCaseResult{newHttpCaseResult("/rules/login.yml", tcResult)}}
+	maskResults(results)
+	result := results.TestCases[0]
+	assert.Contains(t, result.RequestDetail, "/login?key=******")
+	assert.Contains(t, result.ResponseDetail, `"session": "******"`)
+	assert.Contains(t, result.Repro, "/login?key=******")
+
+	b, err := json.Marshal(resource.HarRecorder.Log())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "key-secret")
+	assert.NotContains(t, string(b), "session-secret")
+
+	// the zap fields are masked and stay JSON
+	field := maskedField("request", tcResult.Request)
+	assert.Equal(t, zap.Reflect("request", json.RawMessage{}).Type, field.Type)
+	assert.True(t, strings.Contains(string(field.Interface.(json.RawMessage)), "key=******"))
+}
@@ -3,30 +3,79 @@
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>HTTP Request and Response Display</title>
+    <title>{{ .title }}</title>
     <style>
         body { font-family: Arial, sans-serif; margin: 20px; }
         h2 { color: #333; }
+        a { color: #007BFF; text-decoration: none; }
+        a:hover { text-decoration: underline; }
+        .nav { margin-bottom: 10px; }
         .container { margin-bottom: 20px; }
         .section-title { font-weight: bold; margin-top: 20px; }
         pre { background-color: #f4f4f4; padding: 10px; border: 1px solid #ddd; overflow: auto; white-space: pre-wrap; }
+        .json-key { color: #a52a2a; }
+        .json-string { color: #22863a; }
+        .json-number { color: #005cc5; }
+        .json-literal { color: #d73a49; }
     </style>
 </head>
 <body>
-<h2>HTTP Request and Response Display</h2>
+<div class="nav">
+    {{ if .reportLink }}<a href="{{ .reportLink }}">&larr; Report</a> | {{ end }}<a href="{{ .fileLink }}">&larr; Testcases of the file</a>
+</div>
+<h2>{{ .title }}</h2>
 
 <div class="container">
     <div class="section-title">~~~ REQUEST ~~~</div>
-    <pre>{{ .reqDetail }}</pre>
+    <pre class="detail">{{ .reqDetail }}</pre>
 </div>
 
+{{ if .repro }}
+<div class="container">
+    <div class="section-title">~~~ REPRODUCE ~~~</div>
+    <pre>{{ .repro }}</pre>
+</div>
+{{ end }}
+
 <div class="container">
     <div class="section-title">~~~ RESPONSE ~~~</div>
     {{ if .Error }}
         {{ .Error }}
     {{else}}
-        <pre>{{ .respDetail }}</pre>
+        <pre class="detail">{{ .respDetail }}</pre>
     {{end}}
 </div>
+
+<script>
+    // highlight the JSON body after "BODY:"
+    function escapeHTML(s) {
+        return s.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+    }
+    function highlightJSON(s) {
+        return escapeHTML(s).replace(/("(\\u[a-fA-F0-9]{4}|\\[^u]|[^\\"])*"(\s*:)?|\b(true|false|null)\b|-?\d+(\.\d+)?([eE][+-]?\d+)?)/g, function (match) {
+            var cls = "json-number";
+            if (/^"/.test(match)) {
+                cls = /:$/.test(match) ? "json-key" : "json-string";
+            } else if (/true|false|null/.test(match)) {
+                cls = "json-literal";
+            }
+            return '<span class="' + cls + '">' + match + '</span>';
+        });
+    }
+    document.querySelectorAll("pre.detail").forEach(function (pre) {
+        var text = pre.textContent;
+        var idx = text.indexOf("BODY:\n");
+        if (idx < 0) {
+            return;
+        }
+        var body = text.substring(idx + 6);
+        try {
+            JSON.parse(body);
+        } catch (e) {
+            return;
+        }
+        pre.innerHTML = escapeHTML(text.substring(0, idx + 6)) + highlightJSON(body);
+    });
+</script>
 </body>
-</html>
\ No newline at end of file
+</html>
@@ -45,7 +45,7 @@
 <body>
 
 <table>
-    <caption>Total: {{.info.Total}}, SuccessCount: {{.info.SuccessCount}}, FailedCount: {{.info.FailedCount}}</caption>
+    <caption>Total: {{.info.Total}}, SuccessCount: {{.info.SuccessCount}}, FailedCount: {{.info.FailedCount}}, SkippedCount: {{.info.SkippedCount}}{{if .info.CancelledCount}}, CancelledCount: {{.info.CancelledCount}}{{end}}</caption>
     <thead>
     <tr>
         <th>id</th>
@@ -2,10 +2,20 @@ package command
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/antchfx/xpath"
+	"github.com/flosch/pongo2/v6"
+	"github.com/jmespath/go-jmespath"
+	"github.com/ohler55/ojg/jp"
+	"github.com/vearne/autotest/internal/config"
 	"github.com/vearne/autotest/internal/model"
+	"github.com/vearne/autotest/internal/rule"
+	"github.com/vearne/autotest/internal/util"
 	slog "github.com/vearne/simplelog"
+	"github.com/yuin/gopher-lua/parse"
 )
 
 // ValidateTestCaseIDs 验证测试用例ID是否重复
@@ -62,6 +72,69 @@ func ValidateXPath(testCaseId uint64, xpathStr string) error {
 	return nil
 }
 
+// ValidateJSONPath 验证JSONPath语法
+func ValidateJSONPath(testCaseId uint64, expr string) error {
+	_, err := jp.ParseString(expr)
+	if err != nil {
+		slog.Error("rule error, testCaseId:%v, jsonpath:%v", testCaseId, expr)
+		return err
+	}
+	return nil
+}
+
+// ValidateJMESPath 验证JMESPath语法
+func ValidateJMESPath(testCaseId uint64, expr string) error {
+	_, err := jmespath.Compile(expr)
+	if err != nil {
+		slog.Error("rule error, testCaseId:%v, jmespath:%v", testCaseId, expr)
+		return err
+	}
+	return nil
+}
+
+// ValidateQuery 验证响应体查询表达式，纯文本响应的xpath字段使用正则表达式，
+// 未指定format时格式由响应的Content-Type决定，xpath字段是合法的XPath或正则表达式即可
+func ValidateQuery(testCaseId uint64, q rule.Query) error {
+	if err := q.Check(); err != nil {
+		slog.Error("rule error, testCaseId:%v, %v", testCaseId, err)
+		return err
+	}
+
+	switch {
+	case len(q.JSONPath) > 0:
+		return ValidateJSONPath(testCaseId, q.JSONPath)
+	case len(q.JMESPath) > 0:
+		return ValidateJMESPath(testCaseId, q.JMESPath)
+	case q.Format == rule.FormatText:
+		_, err := regexp.Compile(q.Xpath)
+		if err != nil {
+			slog.Error("rule error, testCaseId:%v, regexp:%v", testCaseId, q.Xpath)
+			return err
+		}
+		return nil
+	case len(q.Format) <= 0:
+		if _, err := xpath.Compile(q.Xpath); err == nil {
+			return nil
+		}
+		if _, err := regexp.Compile(q.Xpath); err != nil {
+			slog.Error("rule error, testCaseId:%v, neither xpath nor regexp:%v", testCaseId, q.Xpath)
+			return fmt.Errorf("%v is neither a valid xpath nor a valid regexp, %w", q.Xpath, err)
+		}
+		return nil
+	}
+	return ValidateXPath(testCaseId, q.Xpath)
+}
+
+// ValidateExportType 验证导出变量的类型，为空时导出字符串
+func ValidateExportType(testCaseId uint64, exportType string) error {
+	if len(exportType) > 0 && !slices.Contains(config.ExportTypes, exportType) {
+		slog.Error("export error, testCaseId:%v, type:%v", testCaseId, exportType)
+		return fmt.Errorf("unknown export type:%v, testCaseId:%v, %v", exportType, testCaseId,
+			strings.Join(config.ExportTypes, " | "))
+	}
+	return nil
+}
+
 // ValidateBodyFields 验证body和luaBody字段
 func ValidateBodyFields(testCaseId uint64, body, luaBody string) error {
 	if len(body) > 0 && len(luaBody) > 0 {
@@ -70,3 +143,221 @@ func ValidateBodyFields(testCaseId uint64, body, luaBody string) error {
 	}
 	return nil
 }
+
+// ValidateHooks 验证setup/teardown，每个hook只能设置http、grpc、lua中的一个
+func ValidateHooks(stage string, hooks []config.Hook) error {
+	for i, hook := range hooks {
+		count := 0
+		if hook.Http != nil {
+			count++
+		}
+		if hook.Grpc != nil {
+			count++
+		}
+		if len(hook.Lua) > 0 {
+			count++
+		}
+		if count != 1 {
+			slog.Error("%v hook #%d(%v) is invalid", stage, i+1, hook.Name)
+			return fmt.Errorf("%v hook #%d(%v): exactly one of http, grpc and lua is required",
+				stage, i+1, hook.Name)
+		}
+
+		if hook.Http != nil && len(hook.Http.Body) > 0 && len(hook.Http.LuaBody) > 0 {
+			return fmt.Errorf("%v hook #%d(%v): body and luaBody cannot have values at the same time",
+				stage, i+1, hook.Name)
+		}
+		if hook.Grpc != nil && len(hook.Grpc.Body) > 0 && len(hook.Grpc.LuaBody) > 0 {
+			return fmt.Errorf("%v hook #%d(%v): body and luaBody cannot have values at the same time",
+				stage, i+1, hook.Name)
+		}
+
+		if hook.Export != nil {
+			if len(hook.Lua) > 0 {
+				return fmt.Errorf("%v hook #%d(%v): export is not supported by lua hooks, return a table instead",
+					stage, i+1, hook.Name)
+			}
+			q := hook.Export.Query()
+			if hook.Grpc != nil {
+				q.Format = rule.FormatJSON
+			}
+			err := ValidateQuery(0, q)
+			if err != nil {
+				return fmt.Errorf("%v hook #%d(%v): %w", stage, i+1, hook.Name, err)
+			}
+			err = ValidateExportType(0, hook.Export.Type)
+			if err != nil {
+				return fmt.Errorf("%v hook #%d(%v): %w", stage, i+1, hook.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateSkipIf 验证skipIf模板和luaSkipIf脚本的语法
+func ValidateSkipIf(testCaseId uint64, skipIf string, luaSkipIf string) error {
+	if len(skipIf) > 0 {
+		_, err := pongo2.FromString(skipCondition(skipIf))
+		if err != nil {
+			slog.Error("skipIf syntax error, testCaseId:%v, skipIf:%v", testCaseId, skipIf)
+			return fmt.Errorf("skipIf syntax error, testCaseId:%v, %w", testCaseId, err)
+		}
+	}
+	if len(luaSkipIf) > 0 {
+		_, err := parse.Parse(strings.NewReader(luaSkipIf), "luaSkipIf")
+		if err != nil {
+			slog.Error("luaSkipIf syntax error, testCaseId:%v", testCaseId)
+			return fmt.Errorf("luaSkipIf syntax error, testCaseId:%v, %w", testCaseId, err)
+		}
+	}
+	return nil
+}
+
+// ValidateRequestOptions 验证用例的超时、重试和限流配置
+func ValidateRequestOptions(testCaseId uint64, opts config.RequestOptions,
+	rateLimitKeys map[string]config.RateLimit) error {
+	if opts.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, testCaseId:%v", testCaseId)
+	}
+	if len(opts.RateLimitKey) > 0 {
+		if _, ok := rateLimitKeys[opts.RateLimitKey]; !ok {
+			slog.Error("rateLimitKey not found, testCaseId:%v, rateLimitKey:%v", testCaseId, opts.RateLimitKey)
+			return fmt.Errorf("rateLimitKey %v is not defined in global.concurrency.keys, testCaseId:%v",
+				opts.RateLimitKey, testCaseId)
+		}
+	}
+	if opts.Retry == nil {
+		return nil
+	}
+	if opts.Retry.MaxAttempts < 0 || opts.Retry.Delay < 0 || opts.Retry.MaxDelay < 0 {
+		return fmt.Errorf("retry attempts, delay and maxDelay must not be negative, testCaseId:%v", testCaseId)
+	}
+	err := ValidateRetry(opts.Retry.Backoff, opts.Retry.Jitter, opts.Retry.GrpcCodes)
+	if err != nil {
+		return fmt.Errorf("retry error, testCaseId:%v, %w", testCaseId, err)
+	}
+	return nil
+}
+
+// ValidateRateLimitKeys 验证命名限流器的 pattern 是否为合法的正则表达式
+func ValidateRateLimitKeys(keys map[string]config.RateLimit) error {
+	for key, limit := range keys {
+		if len(limit.Pattern) <= 0 {
+			continue
+		}
+		_, err := regexp.Compile(limit.Pattern)
+		if err != nil {
+			slog.Error("rate limit pattern error, key:%v, pattern:%v", key, limit.Pattern)
+			return fmt.Errorf("rate limit key %v, invalid pattern:%v, %w", key, limit.Pattern, err)
+		}
+	}
+	return nil
+}
+
+// ValidateSecrets 验证敏感变量，名称必须唯一，env 和 file 最多设置一个
+func ValidateSecrets(secrets []config.Secret) error {
+	names := make(map[string]bool)
+	for idx, secret := range secrets {
+		if len(secret.Name) <= 0 {
+			return fmt.Errorf("secret #%d, name is required", idx)
+		}
+		if names[secret.Name] {
+			return fmt.Errorf("secret %v is duplicate", secret.Name)
+		}
+		names[secret.Name] = true
+		if len(secret.Env) > 0 && len(secret.File) > 0 {
+			return fmt.Errorf("secret %v, only one of env and file can be set", secret.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateEnvironments 验证环境的 extends，基础环境必须存在且不能循环继承
+func ValidateEnvironments(envs map[string]config.Environment) error {
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := util.EnvironmentChain(envs, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateNotifierChannels 验证通知渠道的类型、地址、语言和 webhook 模板
+func ValidateNotifierChannels(channels []config.NotifierChannel) error {
+	for idx, ch := range channels {
+		name := ch.Name
+		if len(name) <= 0 {
+			name = fmt.Sprintf("#%d", idx)
+		}
+		if !slices.Contains(util.NotifierTypes, ch.Type) {
+			return fmt.Errorf("channel %v, unknown type:%v, %v", name, ch.Type,
+				strings.Join(util.NotifierTypes, " | "))
+		}
+		if !util.ValidLocale(ch.Locale) {
+			return fmt.Errorf("channel %v, unknown locale:%v, zh | en", name, ch.Locale)
+		}
+		if ch.Type == util.NotifierEmail {
+			err := ValidateSMTP(ch)
+			if err != nil {
+				return fmt.Errorf("channel %v, %w", name, err)
+			}
+			continue
+		}
+		if len(ch.WebhookURL) <= 0 {
+			return fmt.Errorf("channel %v, webhook_url is required", name)
+		}
+		if ch.Type != util.NotifierWebhook {
+			continue
+		}
+		if len(ch.Template) <= 0 {
+			return fmt.Errorf("channel %v, template is required by the webhook type", name)
+		}
+		_, err := util.ParseWebhookTemplate(ch.Template)
+		if err != nil {
+			slog.Error("webhook template error, channel:%v", name)
+			return fmt.Errorf("channel %v, invalid template, %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateSMTP 验证邮件渠道的 SMTP 服务器和收件人
+func ValidateSMTP(ch config.NotifierChannel) error {
+	if ch.SMTP == nil || len(ch.SMTP.Host) <= 0 || ch.SMTP.Port <= 0 {
+		return fmt.Errorf("smtp host and port are required by the email type")
+	}
+	if len(ch.SMTP.From) <= 0 {
+		return fmt.Errorf("smtp from is required")
+	}
+	if len(ch.SMTP.TLS) > 0 && !slices.Contains(util.SMTPTLSModes, ch.SMTP.TLS) {
+		return fmt.Errorf("unknown smtp tls:%v, %v", ch.SMTP.TLS, strings.Join(util.SMTPTLSModes, " | "))
+	}
+	if len(ch.To)+len(ch.ToOnFailure)+len(ch.ToOnSuccess) == 0 {
+		return fmt.Errorf("at least one recipient is required")
+	}
+	return nil
+}
+
+// ValidateRetry 验证退避策略、随机抖动和gRPC状态码
+func ValidateRetry(backoff string, jitter string, grpcCodes []string) error {
+	err := util.ValidateBackoff(backoff)
+	if err != nil {
+		return err
+	}
+	err = util.ValidateJitter(jitter)
+	if err != nil {
+		return err
+	}
+	for _, name := range grpcCodes {
+		_, err = util.ParseGrpcCode(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
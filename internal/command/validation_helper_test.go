@@ -2,8 +2,11 @@ package command
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/rule"
 )
 
 // MockTestCase 用于测试的模拟测试用例
@@ -59,6 +62,23 @@ func TestValidateTestCaseIDs(t *testing.T) {
 	}
 }
 
+func TestCheckDuplicateIDs(t *testing.T) {
+	driven := []*config.TestCaseHttp{{ID: 1001, ParentID: 1}, {ID: 1002, ParentID: 1}, {ID: 2}}
+	assert.NoError(t, checkDuplicateIDs("/rules/a.yml", driven))
+
+	// a declared testcase next to the rows of a data-driven testcase
+	err := checkDuplicateIDs("/rules/a.yml", append(driven, &config.TestCaseHttp{ID: 1002}))
+	assert.ErrorIs(t, err, ErrorIDduplicate)
+	assert.ErrorContains(t, err, "filePath:/rules/a.yml, ID [1002] is also the ID of row 2 of the data-driven testcase 1")
+	err = checkDuplicateIDs("/rules/a.yml", []*config.TestCaseGrpc{{ID: 1005}, {ID: 1005, ParentID: 1}})
+	assert.ErrorContains(t, err, "ID [1005] is also the ID of row 5 of the data-driven testcase 1")
+
+	err = checkDuplicateIDs("/rules/a.yml", append(driven, &config.TestCaseHttp{ID: 2}))
+	assert.ErrorContains(t, err, "filePath:/rules/a.yml, ID [2] is duplicate")
+	err = checkDuplicateIDs("/rules/a.yml", append(driven, &config.TestCaseHttp{ID: 1}))
+	assert.ErrorContains(t, err, "ID [1] is used by a data-driven testcase and another testcase")
+}
+
 func TestValidateDependencies(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -140,6 +160,86 @@ func TestValidateXPath(t *testing.T) {
 	}
 }
 
+func TestValidateQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     rule.Query
+		wantError bool
+	}{
+		{
+			name:      "XML使用XPath",
+			query:     rule.Query{Format: "xml", Xpath: "//book/@id"},
+			wantError: false,
+		},
+		{
+			name:      "纯文本使用正则",
+			query:     rule.Query{Format: "text", Xpath: `version=([0-9.]+)`},
+			wantError: false,
+		},
+		{
+			name:      "无效的正则",
+			query:     rule.Query{Format: "text", Xpath: `version=(`},
+			wantError: true,
+		},
+		{
+			name:      "未指定格式时可以使用正则",
+			query:     rule.Query{Xpath: `version=([0-9.]+)`},
+			wantError: false,
+		},
+		{
+			name:      "未指定格式时既不是XPath也不是正则",
+			query:     rule.Query{Xpath: `version=(`},
+			wantError: true,
+		},
+		{
+			name:      "XML不能使用正则",
+			query:     rule.Query{Format: "xml", Xpath: `version=([0-9.]+)`},
+			wantError: true,
+		},
+		{
+			name:      "有效的JSONPath",
+			query:     rule.Query{JSONPath: "$.items[*].id"},
+			wantError: false,
+		},
+		{
+			name:      "无效的JSONPath",
+			query:     rule.Query{JSONPath: "$.items[*"},
+			wantError: true,
+		},
+		{
+			name:      "有效的JMESPath",
+			query:     rule.Query{JMESPath: "items[?age > `30`].name"},
+			wantError: false,
+		},
+		{
+			name:      "无效的JMESPath",
+			query:     rule.Query{JMESPath: "items[?"},
+			wantError: true,
+		},
+		{
+			name:      "同时设置xpath和jsonpath",
+			query:     rule.Query{Xpath: "//id", JSONPath: "$.id"},
+			wantError: true,
+		},
+		{
+			name:      "XML不支持JMESPath",
+			query:     rule.Query{Format: "xml", JMESPath: "id"},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateQuery(1, tt.query)
+			if tt.wantError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestValidateBodyFields(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -184,3 +284,209 @@ func TestValidateBodyFields(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		hooks     []config.Hook
+		wantError bool
+	}{
+		{
+			name: "HTTP与Lua",
+			hooks: []config.Hook{
+				{Name: "login", Http: &config.RequestHttp{Method: "post", URL: "http://localhost/login"},
+					Export: &config.Export{JSONPath: "$.token", ExportTo: "TOKEN"}},
+				{Name: "seed", Lua: "function run() return true end"},
+			},
+			wantError: false,
+		},
+		{
+			name:      "没有动作",
+			hooks:     []config.Hook{{Name: "empty"}},
+			wantError: true,
+		},
+		{
+			name: "同时设置http和lua",
+			hooks: []config.Hook{
+				{Http: &config.RequestHttp{URL: "http://localhost"}, Lua: "function run() end"},
+			},
+			wantError: true,
+		},
+		{
+			name: "Lua不支持export",
+			hooks: []config.Hook{
+				{Lua: "function run() end", Export: &config.Export{Xpath: "//id", ExportTo: "ID"}},
+			},
+			wantError: true,
+		},
+		{
+			name: "无效的export",
+			hooks: []config.Hook{
+				{Grpc: &config.RequestGrpc{Address: "localhost:50031"},
+					Export: &config.Export{JMESPath: "items[?", ExportTo: "ID"}},
+			},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHooks(StageSetup, tt.hooks)
+			if tt.wantError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateSkipIf(t *testing.T) {
+	tests := []struct {
+		name      string
+		skipIf    string
+		luaSkipIf string
+		wantError bool
+	}{
+		{
+			name:      "表达式",
+			skipIf:    "ENV == 'dev'",
+			wantError: false,
+		},
+		{
+			name:      "模板",
+			skipIf:    "{{ ENV == 'dev' }}",
+			wantError: false,
+		},
+		{
+			name:      "无效的表达式",
+			skipIf:    "ENV ==",
+			wantError: true,
+		},
+		{
+			name:      "Lua脚本",
+			luaSkipIf: "function skip() return ENV == 'dev' end",
+			wantError: false,
+		},
+		{
+			name:      "无效的Lua脚本",
+			luaSkipIf: "function skip() return",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSkipIf(1, tt.skipIf, tt.luaSkipIf)
+			if tt.wantError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateRequestOptions(t *testing.T) {
+	keys := map[string]config.RateLimit{"export": {RateLimitPerSecond: 1}}
+	tests := []struct {
+		name      string
+		opts      config.RequestOptions
+		wantError bool
+	}{
+		{
+			name:      "超时",
+			opts:      config.RequestOptions{Timeout: 40 * time.Second},
+			wantError: false,
+		},
+		{
+			name:      "负数超时",
+			opts:      config.RequestOptions{Timeout: -time.Second},
+			wantError: true,
+		},
+		{
+			name: "重试",
+			opts: config.RequestOptions{Retry: &config.Retry{MaxAttempts: 3, Backoff: "exponential",
+				StatusCodes: []int{503}, GrpcCodes: []string{"Unavailable", "DEADLINE_EXCEEDED"}}},
+			wantError: false,
+		},
+		{
+			name:      "未知的退避策略",
+			opts:      config.RequestOptions{Retry: &config.Retry{Backoff: "random"}},
+			wantError: true,
+		},
+		{
+			name:      "未知的随机抖动",
+			opts:      config.RequestOptions{Retry: &config.Retry{Jitter: "half"}},
+			wantError: true,
+		},
+		{
+			name:      "负数的最大重试间隔",
+			opts:      config.RequestOptions{Retry: &config.Retry{MaxDelay: -time.Second}},
+			wantError: true,
+		},
+		{
+			name:      "未知的gRPC状态码",
+			opts:      config.RequestOptions{Retry: &config.Retry{GrpcCodes: []string{"Busy"}}},
+			wantError: true,
+		},
+		{
+			name:      "限流key",
+			opts:      config.RequestOptions{RateLimitKey: "export"},
+			wantError: false,
+		},
+		{
+			name:      "未定义的限流key",
+			opts:      config.RequestOptions{RateLimitKey: "report"},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequestOptions(1, tt.opts, keys)
+			if tt.wantError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateRateLimitKeys(t *testing.T) {
+	err := ValidateRateLimitKeys(map[string]config.RateLimit{
+		"export": {RateLimitPerSecond: 1},
+		"slow":   {RateLimitPerSecond: 1, Pattern: `^http://slow\.example\.com/`},
+	})
+	assert.NoError(t, err)
+
+	err = ValidateRateLimitKeys(map[string]config.RateLimit{"slow": {Pattern: `^http://(slow`}})
+	assert.Error(t, err)
+}
+
+func TestValidateNotifierChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel config.NotifierChannel
+		wantErr bool
+	}{
+		{"feishu", config.NotifierChannel{Type: "feishu", WebhookURL: "http://x", Secret: "s", Locale: "en-US"}, false},
+		{"webhook", config.NotifierChannel{Type: "webhook", WebhookURL: "http://x", Template: `{"s": "{{ .Status }}"}`}, false},
+		{"unknown type", config.NotifierChannel{Type: "email", WebhookURL: "http://x"}, true},
+		{"no url", config.NotifierChannel{Type: "slack"}, true},
+		{"unknown locale", config.NotifierChannel{Type: "slack", WebhookURL: "http://x", Locale: "fr"}, true},
+		{"no template", config.NotifierChannel{Type: "webhook", WebhookURL: "http://x"}, true},
+		{"invalid template", config.NotifierChannel{Type: "webhook", WebhookURL: "http://x", Template: "{{ .Status"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNotifierChannels([]config.NotifierChannel{tt.channel})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/vearne/autotest/internal/rule"
+	"gopkg.in/yaml.v3"
 )
 
 type AutoTestConfig struct {
@@ -19,12 +20,25 @@ type AutoTestConfig struct {
 			MaxAttempts        int           `yaml:"max_attempts"`
 			RetryDelay         time.Duration `yaml:"retry_delay"`
 			RetryOnStatusCodes []int         `yaml:"retry_on_status_codes"`
+			// gRPC codes to retry on, e.g. Unavailable
+			RetryOnGrpcCodes []string `yaml:"retry_on_grpc_codes"`
+			// fixed | linear | exponential
+			Backoff string `yaml:"backoff"`
+			// none | full | equal
+			Jitter string `yaml:"jitter"`
+			// upper bound of the backoff delay
+			MaxDelay time.Duration `yaml:"max_delay"`
 		} `yaml:"retry"`
 
 		// 并发控制
 		Concurrency struct {
 			MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
 			RateLimitPerSecond    int `yaml:"rate_limit_per_second"`
+			// named rate limiters, selected by the rateLimitKey of a rule file or testcase,
+			// or by matching the pattern against the URL or the gRPC address
+			Keys map[string]RateLimit `yaml:"keys"`
+			// every host gets its own rate limiter, unset values fall back to the global ones
+			PerHost *RateLimit `yaml:"per_host"`
 		} `yaml:"concurrency"`
 
 		// 缓存配置
@@ -43,6 +57,10 @@ type AutoTestConfig struct {
 			DirPath      string   `yaml:"dir_path"`
 			Formats      []string `yaml:"formats"`
 			TemplatePath string   `yaml:"template_path"`
+			// don't record the results in history.jsonl and don't write trend.html
+			DisableHistory bool `yaml:"disable_history"`
+			// headers hidden in report.har, besides Authorization, Proxy-Authorization, Cookie and Set-Cookie
+			HarRedactHeaders []string `yaml:"har_redact_headers"`
 		} `yaml:"report"`
 
 		// 通知配置
@@ -51,6 +69,8 @@ type AutoTestConfig struct {
 			WebhookURL string `yaml:"webhook_url"`
 			OnFailure  bool   `yaml:"on_failure"`
 			OnSuccess  bool   `yaml:"on_success"`
+			// every channel is notified, webhook_url is an additional slack channel
+			Channels []NotifierChannel `yaml:"channels"`
 		} `yaml:"notifications"`
 
 		Lua struct {
@@ -58,14 +78,184 @@ type AutoTestConfig struct {
 		} `yaml:"lua"`
 	} `yaml:"global"`
 
-	HttpRuleFiles []string                     `yaml:"http_rule_files"`
-	GrpcRuleFiles []string                     `yaml:"grpc_rule_files"`
-	Environments  map[string]map[string]string `yaml:"environments"`
+	HttpRuleFiles []string               `yaml:"http_rule_files"`
+	GrpcRuleFiles []string               `yaml:"grpc_rule_files"`
+	Environments  map[string]Environment `yaml:"environments"`
+	// variables whose values are masked in logs and reports
+	Secrets []Secret `yaml:"secrets"`
+
+	// run before all the rule files
+	Setup []Hook `yaml:"setup,omitempty"`
+	// run after all the rule files, even if some testcases failed
+	Teardown []Hook `yaml:"teardown,omitempty"`
+}
+
+// Secret is a variable whose value is masked in logs and reports.
+// Without Env and File, the value comes from an environment, a setup hook or an export.
+type Secret struct {
+	Name string `yaml:"name"`
+	// process environment variable holding the value
+	Env string `yaml:"env,omitempty"`
+	// file holding the value, the trailing newline is trimmed
+	File string `yaml:"file,omitempty"`
+}
+
+// Environment is a set of variables selected with --environment.
+// The keys extends and env_file are reserved, every other key is a variable.
+type Environment struct {
+	// name of the base environment, its variables are overridden by this one
+	Extends string
+	// .env file whose variables override the ones written in the config file
+	EnvFile string
+	Vars    map[string]string
+}
+
+// UnmarshalYAML keeps the flat format of the environments,
+// extends and env_file are read from the same mapping as the variables
+func (e *Environment) UnmarshalYAML(value *yaml.Node) error {
+	var m map[string]string
+	if err := value.Decode(&m); err != nil {
+		return err
+	}
+	e.Vars = make(map[string]string, len(m))
+	for key, v := range m {
+		switch key {
+		case "extends":
+			e.Extends = v
+		case "env_file":
+			e.EnvFile = v
+		default:
+			e.Vars[key] = v
+		}
+	}
+	return nil
+}
+
+type RateLimit struct {
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+	RateLimitPerSecond    int `yaml:"rate_limit_per_second"`
+	// regular expression, the requests whose URL or gRPC address matches it use this rate limiter
+	Pattern string `yaml:"pattern"`
+}
+
+// NotifierChannel is a destination of the notifications
+type NotifierChannel struct {
+	Name string `yaml:"name"`
+	// slack | dingtalk | feishu | wecom | teams | webhook | email
+	Type       string `yaml:"type"`
+	WebhookURL string `yaml:"webhook_url"`
+	// signing secret of dingtalk and feishu
+	Secret string `yaml:"secret"`
+	// zh | en, zh by default
+	Locale string `yaml:"locale"`
+	// inherited from global.notifications if not set
+	OnSuccess *bool `yaml:"on_success"`
+	OnFailure *bool `yaml:"on_failure"`
+	// Go template of the request body of the generic webhook
+	Template string            `yaml:"template"`
+	Headers  map[string]string `yaml:"headers"`
+
+	// SMTP server and recipients of the email type
+	SMTP *SMTP `yaml:"smtp"`
+	// recipients of every run, and the extra ones when the run failed or succeeded
+	To          []string `yaml:"to"`
+	ToOnFailure []string `yaml:"to_on_failure"`
+	ToOnSuccess []string `yaml:"to_on_success"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	// starttls | tls | none, starttls by default
+	TLS string `yaml:"tls"`
+}
+
+// Retry overrides the global retry settings, unset fields are inherited
+type Retry struct {
+	MaxAttempts int           `yaml:"attempts,omitempty"`
+	Delay       time.Duration `yaml:"delay,omitempty"`
+	// fixed | linear | exponential
+	Backoff string `yaml:"backoff,omitempty"`
+	// none | full | equal
+	Jitter      string        `yaml:"jitter,omitempty"`
+	MaxDelay    time.Duration `yaml:"maxDelay,omitempty"`
+	StatusCodes []int         `yaml:"statusCodes,omitempty"`
+	GrpcCodes   []string      `yaml:"grpcCodes,omitempty"`
+}
+
+// RequestOptions of a rule file or a testcase, they are merged over the global settings
+type RequestOptions struct {
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	Retry   *Retry        `yaml:"retry,omitempty"`
+	// use the rate limiter global.concurrency.keys.<rateLimitKey> instead of the global one
+	RateLimitKey string `yaml:"rateLimitKey,omitempty"`
+}
+
+// Inherit fills the unset options with the options of the rule file
+func (o *RequestOptions) Inherit(file RequestOptions) {
+	if o.Timeout <= 0 {
+		o.Timeout = file.Timeout
+	}
+	if len(o.RateLimitKey) <= 0 {
+		o.RateLimitKey = file.RateLimitKey
+	}
+	if file.Retry == nil {
+		return
+	}
+	if o.Retry == nil {
+		o.Retry = file.Retry
+		return
+	}
+
+	retry := *o.Retry
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = file.Retry.MaxAttempts
+	}
+	if retry.Delay <= 0 {
+		retry.Delay = file.Retry.Delay
+	}
+	if len(retry.Backoff) <= 0 {
+		retry.Backoff = file.Retry.Backoff
+	}
+	if len(retry.Jitter) <= 0 {
+		retry.Jitter = file.Retry.Jitter
+	}
+	if retry.MaxDelay <= 0 {
+		retry.MaxDelay = file.Retry.MaxDelay
+	}
+	if len(retry.StatusCodes) <= 0 {
+		retry.StatusCodes = file.Retry.StatusCodes
+	}
+	if len(retry.GrpcCodes) <= 0 {
+		retry.GrpcCodes = file.Retry.GrpcCodes
+	}
+	o.Retry = &retry
+}
+
+// Hook is a setup or teardown action, exactly one of Http, Grpc and Lua is set
+type Hook struct {
+	Name string       `yaml:"name"`
+	Http *RequestHttp `yaml:"http,omitempty"`
+	Grpc *RequestGrpc `yaml:"grpc,omitempty"`
+	// Lua script, the form of the function is fixed: function run()
+	Lua    string  `yaml:"lua,omitempty"`
+	Export *Export `yaml:"export,omitempty"`
+}
+
+// Hooks of a rule file
+type Hooks struct {
+	Setup    []Hook `yaml:"setup,omitempty"`
+	Teardown []Hook `yaml:"teardown,omitempty"`
 }
 
 type TestCaseHttp struct {
 	ID   uint64 `yaml:"id"`
 	Desc string `yaml:"desc"`
+	// labels to filter the testcases in the report
+	Tags []string `yaml:"tags,omitempty"`
 	// Delay for a while before executing
 	Delay       time.Duration    `yaml:"delay,omitempty"`
 	Request     RequestHttp      `yaml:"request"`
@@ -73,16 +263,83 @@ type TestCaseHttp struct {
 	DependOnIDs []uint64         `yaml:"dependOnIDs,omitempty"`
 	Export      *Export          `yaml:"export"`
 	VerifyRules []rule.VerifyRule
+	// Skip the testcase
+	Skip bool `yaml:"skip,omitempty"`
+	// Skip the testcase if the condition is true, e.g. "ENV == 'dev'",
+	// it is evaluated against the environment and exported variables
+	SkipIf string `yaml:"skipIf,omitempty"`
+	// Lua script, skip the testcase if function skip() returns true
+	LuaSkipIf string `yaml:"luaSkipIf,omitempty"`
+	// timeout, retry and rate limiter of the request
+	RequestOptions `yaml:",inline"`
+	// Run the testcase several times, a testcase that passes only sometimes is flaky
+	Repeat int `yaml:"repeat,omitempty"`
+	// Known flaky testcase, its failures do not fail the run
+	Quarantine bool `yaml:"quarantine,omitempty"`
+	// Data-driven testcase, it is expanded into one testcase per row
+	Parameters []map[string]any `yaml:"parameters,omitempty"`
+	// CSV or JSON file, its rows are appended to Parameters
+	DataFile string `yaml:"dataFile,omitempty"`
+	// ID of the data-driven testcase this one was expanded from
+	ParentID uint64 `yaml:"-"`
+	// line of the testcase in the rule file
+	Line int `yaml:"-"`
+	// variables of the row, only available to this testcase
+	RowVars map[string]any `yaml:"-"`
 }
 
 func (t *TestCaseHttp) GetID() uint64 {
 	return t.ID
 }
 
+func (t *TestCaseHttp) SetLine(line int) {
+	t.Line = line
+}
+
+func (t *TestCaseHttp) GetRequestOptions() *RequestOptions {
+	return &t.RequestOptions
+}
+
+// GetDeclaredID returns the ID written in the rule file,
+// for an expanded testcase it is the ID of the data-driven testcase.
+func (t *TestCaseHttp) GetDeclaredID() uint64 {
+	if t.ParentID > 0 {
+		return t.ParentID
+	}
+	return t.ID
+}
+
+// types of the exported value
+const (
+	ExportTypeString  = "string"
+	ExportTypeInteger = "integer"
+	ExportTypeFloat   = "float"
+	ExportTypeBool    = "bool"
+	// the value keeps its structure, a string holding JSON is parsed
+	ExportTypeJSON = "json"
+	// like json, the value must be a JSON object
+	ExportTypeObject = "object"
+	// every matched value, or the elements of a single matched array
+	ExportTypeArray = "array"
+)
+
+var ExportTypes = []string{ExportTypeString, ExportTypeInteger, ExportTypeFloat, ExportTypeBool,
+	ExportTypeJSON, ExportTypeObject, ExportTypeArray}
+
 type Export struct {
 	Xpath    string `yaml:"xpath"`
 	ExportTo string `yaml:"exportTo"`
-	Type     string `yaml:"type"`
+	// string by default, see ExportTypes
+	Type string `yaml:"type"`
+	// optional, json | xml | html | text, detected from the Content-Type by default
+	Format string `yaml:"format,omitempty"`
+	// alternatives to Xpath for JSON bodies
+	JSONPath string `yaml:"jsonpath,omitempty"`
+	JMESPath string `yaml:"jmespath,omitempty"`
+}
+
+func (e *Export) Query() rule.Query {
+	return rule.Query{Format: e.Format, Xpath: e.Xpath, JSONPath: e.JSONPath, JMESPath: e.JMESPath}
 }
 
 type RequestHttp struct {
@@ -96,6 +353,8 @@ type RequestHttp struct {
 type TestCaseGrpc struct {
 	ID   uint64 `yaml:"id"`
 	Desc string `yaml:"desc"`
+	// labels to filter the testcases in the report
+	Tags []string `yaml:"tags,omitempty"`
 	// Delay for a while before executing
 	Delay       time.Duration    `yaml:"delay,omitempty"`
 	Request     RequestGrpc      `yaml:"request"`
@@ -103,12 +362,52 @@ type TestCaseGrpc struct {
 	DependOnIDs []uint64         `yaml:"dependOnIDs,omitempty"`
 	Export      *Export          `yaml:"export"`
 	VerifyRules []rule.VerifyRuleGrpc
+	// Skip the testcase
+	Skip bool `yaml:"skip,omitempty"`
+	// Skip the testcase if the condition is true, e.g. "ENV == 'dev'",
+	// it is evaluated against the environment and exported variables
+	SkipIf string `yaml:"skipIf,omitempty"`
+	// Lua script, skip the testcase if function skip() returns true
+	LuaSkipIf string `yaml:"luaSkipIf,omitempty"`
+	// timeout, retry and rate limiter of the request
+	RequestOptions `yaml:",inline"`
+	// Run the testcase several times, a testcase that passes only sometimes is flaky
+	Repeat int `yaml:"repeat,omitempty"`
+	// Known flaky testcase, its failures do not fail the run
+	Quarantine bool `yaml:"quarantine,omitempty"`
+	// Data-driven testcase, it is expanded into one testcase per row
+	Parameters []map[string]any `yaml:"parameters,omitempty"`
+	// CSV or JSON file, its rows are appended to Parameters
+	DataFile string `yaml:"dataFile,omitempty"`
+	// ID of the data-driven testcase this one was expanded from
+	ParentID uint64 `yaml:"-"`
+	// line of the testcase in the rule file
+	Line int `yaml:"-"`
+	// variables of the row, only available to this testcase
+	RowVars map[string]any `yaml:"-"`
 }
 
 func (t *TestCaseGrpc) GetID() uint64 {
 	return t.ID
 }
 
+func (t *TestCaseGrpc) SetLine(line int) {
+	t.Line = line
+}
+
+func (t *TestCaseGrpc) GetRequestOptions() *RequestOptions {
+	return &t.RequestOptions
+}
+
+// GetDeclaredID returns the ID written in the rule file,
+// for an expanded testcase it is the ID of the data-driven testcase.
+func (t *TestCaseGrpc) GetDeclaredID() uint64 {
+	if t.ParentID > 0 {
+		return t.ParentID
+	}
+	return t.ID
+}
+
 type RequestGrpc struct {
 	Address string   `yaml:"address"`
 	Symbol  string   `yaml:"symbol"`
@@ -4,6 +4,10 @@ const (
 	StateNotExecuted State = 0
 	StateSuccessFul  State = 1
 	StateFailed      State = 2
+	StateSkipped     State = 3
+	StateCancelled   State = 4
+	// some runs of a repeated testcase passed and some failed
+	StateFlaky State = 5
 )
 
 const (
@@ -13,6 +17,15 @@ const (
 	ReasonDependentItemNotCompleted Reason = 3
 	ReasonTemplateRenderError       Reason = 4
 	ReasonDependentItemFailed       Reason = 5
+	ReasonSetupFailed               Reason = 6
+	ReasonSkipped                   Reason = 7
+	ReasonSkipConditionMet          Reason = 8
+	ReasonDependentItemSkipped      Reason = 9
+	ReasonSkipConditionError        Reason = 10
+	ReasonCancelled                 Reason = 11
+	ReasonFlaky                     Reason = 12
+	// the exported variable could not be extracted or converted to its type
+	ReasonExportFailed Reason = 13
 )
 
 const (
@@ -20,3 +33,23 @@ const (
 	TypeString  = "string"
 	TypeFloat   = "float"
 )
+
+// The ID of a testcase expanded from a data-driven testcase is
+// ID * RowIDMultiplier + row number (starting from 1)
+const (
+	RowIDMultiplier = 1000
+	MaxRowsPerCase  = RowIDMultiplier - 1
+)
+
+// Exit codes of autotest
+const (
+	ExitCodeSuccess = 0
+	// some testcases failed
+	ExitCodeTestFailed = 1
+	// configuration files are invalid
+	ExitCodeConfigError = 2
+	// the services under test or the environment could not be reached
+	ExitCodeInfraError = 3
+	// the run was interrupted by SIGINT or SIGTERM
+	ExitCodeCancelled = 130
+)
@@ -16,6 +16,12 @@ func (s State) String() string {
 		return "StateSuccessFul"
 	case StateFailed:
 		return "StateFailed"
+	case StateSkipped:
+		return "StateSkipped"
+	case StateCancelled:
+		return "StateCancelled"
+	case StateFlaky:
+		return "StateFlaky"
 	}
 	return ""
 }
@@ -36,6 +42,22 @@ func (r Reason) String() string {
 		return "ReasonTemplateRenderError"
 	case ReasonDependentItemFailed:
 		return "ReasonDependentItemFailed"
+	case ReasonSetupFailed:
+		return "ReasonSetupFailed"
+	case ReasonSkipped:
+		return "ReasonSkipped"
+	case ReasonSkipConditionMet:
+		return "ReasonSkipConditionMet"
+	case ReasonDependentItemSkipped:
+		return "ReasonDependentItemSkipped"
+	case ReasonSkipConditionError:
+		return "ReasonSkipConditionError"
+	case ReasonCancelled:
+		return "ReasonCancelled"
+	case ReasonFlaky:
+		return "ReasonFlaky"
+	case ReasonExportFailed:
+		return "ReasonExportFailed"
 	}
 	return ""
 }
@@ -44,7 +66,9 @@ type ExportType int
 
 type StateGroup struct {
 	states map[uint64]State
-	locker sync.RWMutex
+	// data-driven testcase ID -> IDs of the testcases expanded from it
+	members map[uint64][]uint64
+	locker  sync.RWMutex
 }
 
 func (g *StateGroup) SetState(id uint64, s State) {
@@ -54,11 +78,46 @@ func (g *StateGroup) SetState(id uint64, s State) {
 	g.states[id] = s
 }
 
+// AddMember registers a testcase expanded from a data-driven testcase,
+// the state of the data-driven testcase is aggregated from its members.
+func (g *StateGroup) AddMember(parentID uint64, id uint64) {
+	g.locker.Lock()
+	defer g.locker.Unlock()
+
+	g.members[parentID] = append(g.members[parentID], id)
+}
+
 func (g *StateGroup) GetState(id uint64) State {
 	g.locker.RLock()
 	defer g.locker.RUnlock()
 
-	return g.states[id]
+	members, ok := g.members[id]
+	if !ok {
+		return g.states[id]
+	}
+
+	// failed if any member failed, then flaky if any member was flaky,
+	// skipped only if all the members were skipped
+	result := StateSkipped
+	for _, memberID := range members {
+		switch g.states[memberID] {
+		case StateNotExecuted:
+			return StateNotExecuted
+		case StateCancelled:
+			return StateCancelled
+		case StateFailed:
+			result = StateFailed
+		case StateFlaky:
+			if result != StateFailed {
+				result = StateFlaky
+			}
+		case StateSuccessFul:
+			if result == StateSkipped {
+				result = StateSuccessFul
+			}
+		}
+	}
+	return result
 }
 
 type IdItem interface {
@@ -68,6 +127,7 @@ type IdItem interface {
 func NewStateGroup() *StateGroup {
 	var g StateGroup
 	g.states = make(map[uint64]State, 0)
+	g.members = make(map[uint64][]uint64)
 	return &g
 }
 
@@ -0,0 +1,174 @@
+package resource
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/flosch/pongo2/v6"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+)
+
+// ExpandTestCasesHttp 将数据驱动的测试用例按行展开为多个测试用例
+func ExpandTestCasesHttp(ruleFile string, testcases []*config.TestCaseHttp) ([]*config.TestCaseHttp, error) {
+	result := make([]*config.TestCaseHttp, 0, len(testcases))
+	for _, c := range testcases {
+		rows, err := loadParameters(ruleFile, c.ID, c.Parameters, c.DataFile)
+		if err != nil {
+			return nil, err
+		}
+		if rows == nil {
+			result = append(result, c)
+			continue
+		}
+
+		for i, row := range rows {
+			item := *c
+			item.ID = DerivedID(c.ID, i+1)
+			item.Desc = derivedDesc(c.Desc, i+1, row)
+			item.ParentID = c.ID
+			item.RowVars = row
+			item.Request.Headers = slices.Clone(c.Request.Headers)
+			item.OriginRules = renderRules(c.OriginRules, row)
+			result = append(result, &item)
+		}
+	}
+	return result, nil
+}
+
+// ExpandTestCasesGrpc 将数据驱动的测试用例按行展开为多个测试用例
+func ExpandTestCasesGrpc(ruleFile string, testcases []*config.TestCaseGrpc) ([]*config.TestCaseGrpc, error) {
+	result := make([]*config.TestCaseGrpc, 0, len(testcases))
+	for _, c := range testcases {
+		rows, err := loadParameters(ruleFile, c.ID, c.Parameters, c.DataFile)
+		if err != nil {
+			return nil, err
+		}
+		if rows == nil {
+			result = append(result, c)
+			continue
+		}
+
+		for i, row := range rows {
+			item := *c
+			item.ID = DerivedID(c.ID, i+1)
+			item.Desc = derivedDesc(c.Desc, i+1, row)
+			item.ParentID = c.ID
+			item.RowVars = row
+			item.Request.Headers = slices.Clone(c.Request.Headers)
+			item.OriginRules = renderRules(c.OriginRules, row)
+			result = append(result, &item)
+		}
+	}
+	return result, nil
+}
+
+// DerivedID 计算展开后测试用例的ID，row从1开始
+func DerivedID(id uint64, row int) uint64 {
+	return id*model.RowIDMultiplier + uint64(row)
+}
+
+// derivedDesc 描述中可以引用行变量，并追加行号
+func derivedDesc(desc string, row int, rowVars map[string]any) string {
+	tpl, err := pongo2.FromString(desc)
+	if err == nil {
+		rendered, err := tpl.Execute(pongo2.Context(rowVars))
+		if err == nil {
+			desc = rendered
+		}
+	}
+	return fmt.Sprintf("%v [row %d]", desc, row)
+}
+
+// renderRules 使用行变量渲染规则中字符串类型的expected
+func renderRules(rules []map[string]any, rowVars map[string]any) []map[string]any {
+	result := make([]map[string]any, 0, len(rules))
+	for _, r := range rules {
+		item := maps.Clone(r)
+		if expected, ok := item["expected"].(string); ok {
+			tpl, err := pongo2.FromString(expected)
+			if err == nil {
+				rendered, err := tpl.Execute(pongo2.Context(rowVars))
+				if err == nil {
+					item["expected"] = rendered
+				}
+			}
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// loadParameters 合并parameters与dataFile中的数据行，非数据驱动的用例返回nil
+func loadParameters(ruleFile string, id uint64, parameters []map[string]any, dataFile string) ([]map[string]any, error) {
+	if len(parameters) == 0 && len(dataFile) == 0 {
+		return nil, nil
+	}
+
+	rows := make([]map[string]any, 0, len(parameters))
+	rows = append(rows, parameters...)
+	if len(dataFile) > 0 {
+		if !filepath.IsAbs(dataFile) {
+			dataFile = filepath.Join(filepath.Dir(ruleFile), dataFile)
+		}
+		fileRows, err := readDataFile(dataFile)
+		if err != nil {
+			return nil, fmt.Errorf("load dataFile failed, testCaseId:%v, %w", id, err)
+		}
+		rows = append(rows, fileRows...)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("data-driven testcase has no rows, testCaseId:%v", id)
+	}
+	if len(rows) > model.MaxRowsPerCase {
+		return nil, fmt.Errorf("data-driven testcase has too many rows, testCaseId:%v, rows:%v, max:%v",
+			id, len(rows), model.MaxRowsPerCase)
+	}
+	return rows, nil
+}
+
+// readDataFile 读取CSV或JSON数据文件
+// CSV的第一行为列名；JSON必须是对象数组
+func readDataFile(filePath string) ([]map[string]any, error) {
+	b, err := readFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", filePath, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".csv":
+		reader := csv.NewReader(strings.NewReader(string(b)))
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", filePath, err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+		header := records[0]
+		rows := make([]map[string]any, 0, len(records)-1)
+		for _, record := range records[1:] {
+			row := make(map[string]any, len(header))
+			for i, key := range header {
+				row[strings.TrimSpace(key)] = record[i]
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case ".json":
+		var rows []map[string]any
+		err = json.Unmarshal(b, &rows)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", filePath, err)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unsupported dataFile:%v, only .csv and .json are supported", filePath)
+}
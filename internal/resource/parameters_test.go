@@ -0,0 +1,130 @@
+package resource
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/model"
+)
+
+func writeDataFile(t *testing.T, dir, name, content string) string {
+	filePath := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+	return filePath
+}
+
+func TestReadDataFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first line of a CSV file is the header, the values are strings
+	rows, err := readDataFile(writeDataFile(t, dir, "books.csv", "title, price\nGo, 10\n\"Rust, 2nd\", 20\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"title": "Go", "price": "10"}, {"title": "Rust, 2nd", "price": "20"}}, rows)
+
+	rows, err = readDataFile(writeDataFile(t, dir, "header.CSV", "title,price\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, rows)
+
+	_, err = readDataFile(writeDataFile(t, dir, "short.csv", "title,price\nGo\n"))
+	assert.ErrorContains(t, err, "short.csv")
+
+	// a JSON file is an array of objects
+	rows, err = readDataFile(writeDataFile(t, dir, "books.json", `[{"title": "Go", "price": 10}, {"tags": ["a"]}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"title": "Go", "price": float64(10)}, {"tags": []any{"a"}}}, rows)
+
+	_, err = readDataFile(writeDataFile(t, dir, "object.json", `{"title": "Go"}`))
+	assert.ErrorContains(t, err, "object.json")
+
+	_, err = readDataFile(writeDataFile(t, dir, "books.yml", "- title: Go\n"))
+	assert.ErrorContains(t, err, "only .csv and .json are supported")
+
+	_, err = readDataFile(filepath.Join(dir, "missing.csv"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadParameters(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "book.yml")
+	writeDataFile(t, dir, "books.csv", "title\nRust\n")
+
+	// not data-driven
+	rows, err := loadParameters(ruleFile, 1, nil, "")
+	assert.NoError(t, err)
+	assert.Nil(t, rows)
+
+	// the parameters first, the dataFile is relative to the rule file
+	rows, err = loadParameters(ruleFile, 1, []map[string]any{{"title": "Go"}}, "books.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"title": "Go"}, {"title": "Rust"}}, rows)
+
+	_, err = loadParameters(ruleFile, 1, nil, "missing.csv")
+	assert.ErrorContains(t, err, "load dataFile failed, testCaseId:1")
+
+	_, err = loadParameters(ruleFile, 2, nil, writeDataFile(t, dir, "empty.csv", ""))
+	assert.EqualError(t, err, "data-driven testcase has no rows, testCaseId:2")
+
+	parameters := make([]map[string]any, model.MaxRowsPerCase+1)
+	_, err = loadParameters(ruleFile, 3, parameters, "")
+	assert.EqualError(t, err, fmt.Sprintf("data-driven testcase has too many rows, testCaseId:3, rows:%v, max:%v",
+		model.MaxRowsPerCase+1, model.MaxRowsPerCase))
+	rows, err = loadParameters(ruleFile, 3, parameters[:model.MaxRowsPerCase], "")
+	assert.NoError(t, err)
+	assert.Len(t, rows, model.MaxRowsPerCase)
+}
+
+func TestDerivedID(t *testing.T) {
+	assert.Equal(t, uint64(1001), DerivedID(1, 1))
+	assert.Equal(t, uint64(12999), DerivedID(12, model.MaxRowsPerCase))
+}
+
+func TestDerivedDesc(t *testing.T) {
+	row := map[string]any{"title": "Go", "price": 10}
+	assert.Equal(t, "add Go for 10 [row 2]", derivedDesc("add {{ title }} for {{ price }}", 2, row))
+	// an invalid template is kept as it is
+	assert.Equal(t, "add {{ title [row 1]", derivedDesc("add {{ title", 1, row))
+}
+
+func TestRenderRules(t *testing.T) {
+	rules := []map[string]any{
+		{"name": "HttpBodyEqualRule", "xpath": "/title", "expected": "{{ title }}"},
+		{"name": "HttpStatusEqualRule", "expected": 200},
+	}
+	rendered := renderRules(rules, map[string]any{"title": "Go"})
+	assert.Equal(t, []map[string]any{
+		{"name": "HttpBodyEqualRule", "xpath": "/title", "expected": "Go"},
+		{"name": "HttpStatusEqualRule", "expected": 200},
+	}, rendered)
+	// the rules of the testcase are not changed
+	assert.Equal(t, "{{ title }}", rules[0]["expected"])
+}
+
+func TestExpandTestCasesHttp(t *testing.T) {
+	parent := &config.TestCaseHttp{ID: 2, Desc: "get {{ title }}",
+		Request:     config.RequestHttp{Headers: []string{"Accept: */*"}},
+		Parameters:  []map[string]any{{"title": "Go"}, {"title": "Rust"}},
+		OriginRules: []map[string]any{{"name": "HttpBodyEqualRule", "expected": "{{ title }}"}}}
+	testcases, err := ExpandTestCasesHttp("/rules/book.yml", []*config.TestCaseHttp{{ID: 1}, parent})
+	assert.NoError(t, err)
+	assert.Len(t, testcases, 3)
+	assert.Equal(t, uint64(1), testcases[0].ID)
+
+	row := testcases[2]
+	assert.Equal(t, uint64(2002), row.ID)
+	assert.Equal(t, uint64(2), row.ParentID)
+	assert.Equal(t, uint64(2), row.GetDeclaredID())
+	assert.Equal(t, "get Rust [row 2]", row.Desc)
+	assert.Equal(t, map[string]any{"title": "Rust"}, row.RowVars)
+	assert.Equal(t, "Rust", row.OriginRules[0]["expected"])
+	// the rows don't share the headers
+	row.Request.Headers[0] = "Accept: text/html"
+	assert.Equal(t, "Accept: */*", testcases[1].Request.Headers[0])
+
+	_, err = ExpandTestCasesGrpc("/rules/hello.yml",
+		[]*config.TestCaseGrpc{{ID: 1, DataFile: "missing.json"}})
+	assert.ErrorContains(t, err, "load dataFile failed, testCaseId:1, /rules/missing.json")
+}
@@ -3,15 +3,19 @@ package resource
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/flosch/pongo2/v6"
 	"github.com/go-resty/resty/v2"
 	"github.com/vearne/autotest/internal/config"
 	"github.com/vearne/autotest/internal/luavm"
@@ -27,6 +31,12 @@ var GlobalConfig config.AutoTestConfig
 var HttpTestCases map[string][]*config.TestCaseHttp
 var GrpcTestCases map[string][]*config.TestCaseGrpc
 
+// setup and teardown of each rule file, key is the absolute path of the rule file
+var FileHooks map[string]config.Hooks
+
+// absolute path of the directory of the config file, the reports record the rule files relative to it
+var ConfigDir string
+
 var EnvVars map[string]string
 var CustomerVars sync.Map
 
@@ -37,18 +47,32 @@ var TerminationFlag atomic.Bool
 var DescSourceCache *model.DescSourceCache
 var CacheManager *util.CacheManager
 var RateLimiter *util.RateLimiter
+
+// named rate limiters of global.concurrency.keys
+var KeyedRateLimiters map[string]*util.RateLimiter
+
+// rate limiters selected by the URL or gRPC address of a request
+var TargetRateLimiters *util.TargetRateLimiters
 var EnvironmentManager *util.EnvironmentManager
 var ReportGenerator *util.ReportGenerator
+
+// records the HTTP requests of the testcases, nil unless the har report format is enabled
+var HarRecorder *util.HarRecorder
 var NotificationService *util.NotificationService
 
+// masks the values of the secret variables in logs and reports
+var SecretMasker *util.SecretMasker
+
 var SingleFlightGroup singleflight.Group
 
 func init() {
 	EnvVars = make(map[string]string, 10)
 	HttpTestCases = make(map[string][]*config.TestCaseHttp, 10)
 	GrpcTestCases = make(map[string][]*config.TestCaseGrpc, 10)
+	FileHooks = make(map[string]config.Hooks, 10)
 	TerminationFlag.Store(false)
 	DescSourceCache = model.NewDescSourceCache()
+	pongo2.RegisterFilter("json", util.FilterJSON) //nolint:errcheck
 }
 
 // InitCacheManager 初始化缓存管理器
@@ -73,6 +97,55 @@ func InitRateLimiter() {
 
 	RateLimiter = util.NewRateLimiter(maxConcurrent, rateLimit)
 	slog.Info("Rate limiter initialized: MaxConcurrent=%d, RateLimit=%d/s", maxConcurrent, rateLimit)
+
+	// 每个 key 使用独立的令牌桶和并发控制，未配置的值使用上面的默认值
+	KeyedRateLimiters = make(map[string]*util.RateLimiter, len(GlobalConfig.Global.Concurrency.Keys))
+	for key, limit := range GlobalConfig.Global.Concurrency.Keys {
+		keyMaxConcurrent := maxConcurrent
+		keyRateLimit := rateLimit
+		if limit.MaxConcurrentRequests > 0 {
+			keyMaxConcurrent = limit.MaxConcurrentRequests
+		}
+		if limit.RateLimitPerSecond > 0 {
+			keyRateLimit = limit.RateLimitPerSecond
+		}
+		KeyedRateLimiters[key] = util.NewRateLimiter(keyMaxConcurrent, keyRateLimit)
+		slog.Info("Rate limiter [%v] initialized: MaxConcurrent=%d, RateLimit=%d/s",
+			key, keyMaxConcurrent, keyRateLimit)
+	}
+
+	// 按host限流，未配置的值同样使用上面的默认值
+	perHost := GlobalConfig.Global.Concurrency.PerHost
+	hostMaxConcurrent := maxConcurrent
+	hostRateLimit := rateLimit
+	if perHost != nil {
+		if perHost.MaxConcurrentRequests > 0 {
+			hostMaxConcurrent = perHost.MaxConcurrentRequests
+		}
+		if perHost.RateLimitPerSecond > 0 {
+			hostRateLimit = perHost.RateLimitPerSecond
+		}
+		slog.Info("Per-host rate limiter initialized: MaxConcurrent=%d, RateLimit=%d/s",
+			hostMaxConcurrent, hostRateLimit)
+	}
+	TargetRateLimiters = util.NewTargetRateLimiters(perHost != nil, hostMaxConcurrent, hostRateLimit)
+
+	// 配置了 pattern 的 key 按名称顺序匹配，保证匹配结果稳定
+	keys := make([]string, 0, len(GlobalConfig.Global.Concurrency.Keys))
+	for key, limit := range GlobalConfig.Global.Concurrency.Keys {
+		if len(limit.Pattern) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		// 正则表达式在校验配置时已经检查过
+		pattern, err := regexp.Compile(GlobalConfig.Global.Concurrency.Keys[key].Pattern)
+		if err != nil {
+			continue
+		}
+		TargetRateLimiters.AddGroup(pattern, KeyedRateLimiters[key])
+	}
 }
 
 // InitEnvironmentManager 初始化环境管理器
@@ -122,6 +195,81 @@ func LoadEnvironment(envName string) error {
 	return nil
 }
 
+// LoadSecrets 加载敏感变量，来自进程环境变量或文件的值加入 EnvVars，
+// 环境中同名变量的值也会被隐藏
+func LoadSecrets() error {
+	names := make([]string, 0, len(GlobalConfig.Secrets))
+	for _, secret := range GlobalConfig.Secrets {
+		names = append(names, secret.Name)
+	}
+	SecretMasker = util.NewSecretMasker(names)
+
+	for _, secret := range GlobalConfig.Secrets {
+		switch {
+		case len(secret.Env) > 0:
+			value, ok := os.LookupEnv(secret.Env)
+			if !ok {
+				return fmt.Errorf("secret %s, environment variable %s is not set", secret.Name, secret.Env)
+			}
+			setVar(secret.Name, value, util.SourceSecret+" env "+secret.Env)
+		case len(secret.File) > 0:
+			content, err := os.ReadFile(secret.File)
+			if err != nil {
+				return fmt.Errorf("secret %s, %w", secret.Name, err)
+			}
+			setVar(secret.Name, strings.TrimRight(string(content), "\r\n"), util.SourceSecret+" file "+secret.File)
+		}
+	}
+	for key, value := range EnvVars {
+		SecretMasker.Track(key, value)
+	}
+	if HarRecorder != nil {
+		HarRecorder.SetSecretMasker(SecretMasker)
+	}
+	rule.Mask = SecretMasker.Mask
+
+	slog.Info("Secrets loaded, %d variables are masked", len(names))
+	return nil
+}
+
+// SetVars 设置 --var 指定的变量，格式为 KEY=VALUE，优先级最高，
+// 值中的 ${NAME} 被替换为进程环境变量的值
+func SetVars(vars []string) error {
+	for _, item := range vars {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || len(key) <= 0 {
+			return fmt.Errorf("invalid --var %q, KEY=VALUE is expected", item)
+		}
+		if EnvironmentManager != nil {
+			var err error
+			value, err = EnvironmentManager.ExpandEnvRefs(value)
+			if err != nil {
+				return fmt.Errorf("--var %s, %w", key, err)
+			}
+		}
+		setVar(key, value, util.SourceVar)
+		SecretMasker.Track(key, value)
+	}
+	return nil
+}
+
+// setVar 设置 EnvVars 中的变量，并在环境管理器中记录来源
+func setVar(key, value, source string) {
+	EnvVars[key] = value
+	if EnvironmentManager != nil {
+		EnvironmentManager.SetVariable(key, value, source)
+	}
+}
+
+// VarSource 获取 EnvVars 中变量的来源
+func VarSource(key string) string {
+	if EnvironmentManager == nil {
+		return ""
+	}
+	return EnvironmentManager.Source(key)
+}
+
 func InitRestyClient(debug bool) {
 	httpClient := http.Client{
 		Transport: &http.Transport{
@@ -129,9 +277,31 @@ func InitRestyClient(debug bool) {
 		},
 	}
 	RestyClient = resty.NewWithClient(&httpClient)
+	RestyClient.SetLogger(&maskedRestyLogger{l: log.New(os.Stderr, "", log.Ldate|log.Lmicroseconds)})
 	RestyClient.SetDebug(debug)
 }
 
+// maskedRestyLogger 隐藏 resty 调试日志中的敏感变量值
+type maskedRestyLogger struct {
+	l *log.Logger
+}
+
+func (m *maskedRestyLogger) Errorf(format string, v ...any) {
+	m.output("ERROR", format, v...)
+}
+
+func (m *maskedRestyLogger) Warnf(format string, v ...any) {
+	m.output("WARN", format, v...)
+}
+
+func (m *maskedRestyLogger) Debugf(format string, v ...any) {
+	m.output("DEBUG", format, v...)
+}
+
+func (m *maskedRestyLogger) output(level string, format string, v ...any) {
+	m.l.Print(SecretMasker.Mask(fmt.Sprintf(level+" RESTY "+format, v...)))
+}
+
 // InitRetryClient 初始化带重试功能的HTTP客户端
 func InitRetryClient() {
 	// 设置重试机制的默认值
@@ -141,11 +311,8 @@ func InitRetryClient() {
 	if GlobalConfig.Global.Retry.RetryDelay <= 0 {
 		GlobalConfig.Global.Retry.RetryDelay = time.Second // 默认重试间隔1秒
 	}
-	if len(GlobalConfig.Global.Retry.RetryOnStatusCodes) == 0 {
-		// 默认重试的状态码：服务器错误、网关错误、服务不可用、网关超时、请求超时、请求过多
-		GlobalConfig.Global.Retry.RetryOnStatusCodes = []int{500, 502, 503, 504, 408, 429}
-	}
-
+	// 只有显式配置的状态码才会触发重试，默认不按状态码重试，
+	// 以免断言 5xx 的用例被重试，或者非幂等的请求被重复发送
 	RetryClient = util.NewRetryableHTTPClient(RestyClient, GlobalConfig)
 
 	slog.Info("RetryClient initialized: MaxAttempts=%d, RetryDelay=%v, RetryCodes=%v",
@@ -157,6 +324,7 @@ func InitRetryClient() {
 // InitReportGenerator 初始化报告生成器
 func InitReportGenerator() {
 	ReportGenerator = util.NewReportGenerator(GlobalConfig)
+	HarRecorder = ReportGenerator.HarRecorder()
 	slog.Info("ReportGenerator initialized")
 }
 
@@ -165,11 +333,12 @@ func InitNotificationService() {
 	NotificationService = util.NewNotificationService(GlobalConfig)
 
 	if GlobalConfig.Global.Notifications.Enabled {
-		slog.Info("NotificationService initialized: Enabled=%v, WebhookURL=%s, OnFailure=%v, OnSuccess=%v",
+		slog.Info("NotificationService initialized: Enabled=%v, WebhookURL=%s, OnFailure=%v, OnSuccess=%v, Channels=%v",
 			GlobalConfig.Global.Notifications.Enabled,
 			GlobalConfig.Global.Notifications.WebhookURL,
 			GlobalConfig.Global.Notifications.OnFailure,
-			GlobalConfig.Global.Notifications.OnSuccess)
+			GlobalConfig.Global.Notifications.OnSuccess,
+			len(GlobalConfig.Global.Notifications.Channels))
 	} else {
 		slog.Info("NotificationService initialized: Disabled")
 	}
@@ -251,6 +420,10 @@ func ParseConfigFile(filePath string) error {
 	if err != nil {
 		return err
 	}
+	ConfigDir, err = filepath.Abs(filepath.Dir(filePath))
+	if err != nil {
+		return err
+	}
 
 	slog.Info("1) parse global file")
 	err = yaml.Unmarshal(b, &GlobalConfig)
@@ -275,11 +448,28 @@ func ParseConfigFile(filePath string) error {
 		}
 
 		var testcases []*config.TestCaseHttp
-		err = yaml.Unmarshal(b, &testcases)
+		var hooks config.Hooks
+		testcases, hooks, err = parseRuleFile[*config.TestCaseHttp](b)
 		if err != nil {
 			slog.Error("file:%v parse error, %v", f, err)
 			return err
 		}
+		err = prepareHooks(hooks.Setup)
+		if err != nil {
+			slog.Error("file:%v parse setup error, %v", f, err)
+			return err
+		}
+		err = prepareHooks(hooks.Teardown)
+		if err != nil {
+			slog.Error("file:%v parse teardown error, %v", f, err)
+			return err
+		}
+
+		testcases, err = ExpandTestCasesHttp(f, testcases)
+		if err != nil {
+			slog.Error("file:%v expand testcases error, %v", f, err)
+			return err
+		}
 
 		for i := 0; i < len(testcases); i++ {
 			c := testcases[i]
@@ -303,6 +493,11 @@ func ParseConfigFile(filePath string) error {
 						slog.Error("parse rule[HttpBodyEqualRule], %v", err)
 						return err
 					}
+					item.Format, err = rule.NormalizeFormat(item.Format)
+					if err != nil {
+						slog.Error("parse rule[HttpBodyEqualRule], testCaseId:%v, %v", c.ID, err)
+						return err
+					}
 					c.VerifyRules = append(c.VerifyRules, &item)
 				case "HttpBodyAtLeastOneRule":
 					var item rule.HttpBodyAtLeastOneRule
@@ -311,6 +506,11 @@ func ParseConfigFile(filePath string) error {
 						slog.Error("parse rule[HttpBodyAtLeastOneRule], %v", err)
 						return err
 					}
+					item.Format, err = rule.NormalizeFormat(item.Format)
+					if err != nil {
+						slog.Error("parse rule[HttpBodyAtLeastOneRule], testCaseId:%v, %v", c.ID, err)
+						return err
+					}
 					c.VerifyRules = append(c.VerifyRules, &item)
 				case "HttpLuaRule":
 					var item rule.HttpLuaRule
@@ -329,6 +529,11 @@ func ParseConfigFile(filePath string) error {
 				if len(c.Export.Type) <= 0 {
 					c.Export.Type = "string"
 				}
+				c.Export.Format, err = rule.NormalizeFormat(c.Export.Format)
+				if err != nil {
+					slog.Error("parse export, testCaseId:%v, %v", c.ID, err)
+					return err
+				}
 			}
 		}
 
@@ -339,6 +544,7 @@ func ParseConfigFile(filePath string) error {
 			return err
 		}
 		HttpTestCases[absolutePath] = testcases
+		FileHooks[absolutePath] = hooks
 		GlobalConfig.HttpRuleFiles[idx] = absolutePath
 	}
 
@@ -354,11 +560,28 @@ func ParseConfigFile(filePath string) error {
 		}
 
 		var testcases []*config.TestCaseGrpc
-		err = yaml.Unmarshal(b, &testcases)
+		var hooks config.Hooks
+		testcases, hooks, err = parseRuleFile[*config.TestCaseGrpc](b)
 		if err != nil {
 			slog.Error("file:%v parse error, %v", f, err)
 			return err
 		}
+		err = prepareHooks(hooks.Setup)
+		if err != nil {
+			slog.Error("file:%v parse setup error, %v", f, err)
+			return err
+		}
+		err = prepareHooks(hooks.Teardown)
+		if err != nil {
+			slog.Error("file:%v parse teardown error, %v", f, err)
+			return err
+		}
+
+		testcases, err = ExpandTestCasesGrpc(f, testcases)
+		if err != nil {
+			slog.Error("file:%v expand testcases error, %v", f, err)
+			return err
+		}
 
 		for i := 0; i < len(testcases); i++ {
 			c := testcases[i]
@@ -420,9 +643,21 @@ func ParseConfigFile(filePath string) error {
 			return err
 		}
 		GrpcTestCases[absolutePath] = testcases
+		FileHooks[absolutePath] = hooks
 		GlobalConfig.GrpcRuleFiles[idx] = absolutePath
 	}
 
+	err = prepareHooks(GlobalConfig.Setup)
+	if err != nil {
+		slog.Error("parse setup error, %v", err)
+		return err
+	}
+	err = prepareHooks(GlobalConfig.Teardown)
+	if err != nil {
+		slog.Error("parse teardown error, %v", err)
+		return err
+	}
+
 	slog.Info("4) parse lua preload files")
 	for idx, f := range GlobalConfig.Global.Lua.PreloadFiles {
 		slog.Info("parse lua preload file:%v", f)
@@ -448,9 +683,109 @@ func ParseConfigFile(filePath string) error {
 	return nil
 }
 
+// parseRuleFile 解析规则文件，支持用例列表和包含setup/teardown/cases的映射两种形式
+// 同时记录每个用例在文件中的行号
+func parseRuleFile[T interface {
+	SetLine(int)
+	GetRequestOptions() *config.RequestOptions
+}](b []byte) ([]T, config.Hooks, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(b, &node)
+	if err != nil {
+		return nil, config.Hooks{}, err
+	}
+	if len(node.Content) == 0 {
+		return nil, config.Hooks{}, nil
+	}
+
+	var hooks config.Hooks
+	var testcases []T
+	casesNode := node.Content[0]
+	if casesNode.Kind == yaml.MappingNode {
+		var ruleFile struct {
+			config.Hooks `yaml:",inline"`
+			// timeout, retry and rate limiter of all the testcases in the rule file
+			config.RequestOptions `yaml:",inline"`
+			Cases                 []T `yaml:"cases"`
+		}
+		err = casesNode.Decode(&ruleFile)
+		if err != nil {
+			return nil, hooks, err
+		}
+		hooks = ruleFile.Hooks
+		testcases = ruleFile.Cases
+		for _, tc := range testcases {
+			tc.GetRequestOptions().Inherit(ruleFile.RequestOptions)
+		}
+		for i := 0; i+1 < len(casesNode.Content); i += 2 {
+			if casesNode.Content[i].Value == "cases" {
+				casesNode = casesNode.Content[i+1]
+				break
+			}
+		}
+	} else {
+		err = casesNode.Decode(&testcases)
+		if err != nil {
+			return nil, hooks, err
+		}
+	}
+
+	if casesNode.Kind == yaml.SequenceNode && len(casesNode.Content) == len(testcases) {
+		for i, item := range casesNode.Content {
+			testcases[i].SetLine(item.Line)
+		}
+	}
+	return testcases, hooks, nil
+}
+
+// prepareHooks 与测试用例一样处理hook的请求体和export
+func prepareHooks(hooks []config.Hook) error {
+	var err error
+	for i := range hooks {
+		hook := &hooks[i]
+		if hook.Http != nil {
+			hook.Http.Body = strings.ReplaceAll(hook.Http.Body, "\n", "")
+		}
+		if hook.Grpc != nil {
+			hook.Grpc.Body = strings.ReplaceAll(hook.Grpc.Body, "\n", "")
+		}
+		if hook.Export != nil {
+			if len(hook.Export.Type) <= 0 {
+				hook.Export.Type = "string"
+			}
+			hook.Export.Format, err = rule.NormalizeFormat(hook.Export.Format)
+			if err != nil {
+				return fmt.Errorf("hook:%v, %w", hook.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
 func readFile(filePath string) ([]byte, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, os.ErrNotExist
 	}
 	return os.ReadFile(filePath)
 }
+
+// RelRulePath 规则文件相对于配置文件所在目录的路径，报告中用它标识规则文件，
+// 不同目录中检出的同一套规则在多次运行间可以对应起来
+func RelRulePath(filePath string) string {
+	if len(ConfigDir) <= 0 {
+		return filePath
+	}
+	rel, err := filepath.Rel(ConfigDir, filePath)
+	if err != nil {
+		return filePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// AbsRulePath 报告中记录的规则文件路径对应的绝对路径
+func AbsRulePath(file string) string {
+	if filepath.IsAbs(file) || len(ConfigDir) <= 0 {
+		return file
+	}
+	return filepath.Join(ConfigDir, filepath.FromSlash(file))
+}
@@ -0,0 +1,96 @@
+package rule
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/vearne/autotest/internal/model"
+)
+
+// Mismatch describes a verify rule which failed, with the expected and the actual value
+type Mismatch struct {
+	Rule string `json:"rule"`
+	// locates the value in the body, empty for the status code and the lua rules
+	Expression string `json:"expression,omitempty"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual"`
+}
+
+// actual values which are not found in the body
+const (
+	ActualNotFound = "<not found>"
+	ActualFalse    = "false"
+)
+
+// ExplainHttp returns the expected and the actual value of a rule which failed on the response.
+func ExplainHttp(r VerifyRule, resp *resty.Response) Mismatch {
+	m := Mismatch{Rule: r.Name()}
+	switch rule := r.(type) {
+	case *HttpStatusEqualRule:
+		m.Expected = strconv.Itoa(rule.Expected)
+		m.Actual = strconv.Itoa(resp.StatusCode())
+	case *HttpBodyEqualRule:
+		q := httpQuery(resp, rule.Query())
+		m.Expression = q.Expression()
+		m.Expected = convStr(rule.Expected)
+		m.Actual = actualOne(resp.String(), q)
+	case *HttpBodyAtLeastOneRule:
+		q := httpQuery(resp, rule.Query())
+		m.Expression = q.Expression()
+		m.Expected = convStr(rule.Expected)
+		m.Actual = actualAll(resp.String(), q)
+	default:
+		m.Expected = "true"
+		m.Actual = ActualFalse
+	}
+	return m
+}
+
+// ExplainGrpc returns the expected and the actual value of a rule which failed on the response.
+func ExplainGrpc(r VerifyRuleGrpc, resp *model.GrpcResp) Mismatch {
+	m := Mismatch{Rule: r.Name()}
+	switch rule := r.(type) {
+	case *GrpcCodeEqualRule:
+		m.Expected = rule.Expected
+		m.Actual = resp.Code
+	case *GrpcBodyEqualRule:
+		m.Expression = rule.Query().Expression()
+		m.Expected = convStr(rule.Expected)
+		m.Actual = actualOne(resp.Body, rule.Query())
+	case *GrpcBodyAtLeastOneRule:
+		m.Expression = rule.Query().Expression()
+		m.Expected = convStr(rule.Expected)
+		m.Actual = actualAll(resp.Body, rule.Query())
+	default:
+		m.Expected = "true"
+		m.Actual = ActualFalse
+	}
+	return m
+}
+
+func actualOne(body string, q Query) string {
+	value, found, err := FindOne(body, q)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	if !found {
+		return ActualNotFound
+	}
+	return convStr(value)
+}
+
+func actualAll(body string, q Query) string {
+	values, err := FindAll(body, q)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	if len(values) <= 0 {
+		return ActualNotFound
+	}
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		strs = append(strs, convStr(value))
+	}
+	return "[" + strings.Join(strs, ", ") + "]"
+}
@@ -0,0 +1,52 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/model"
+)
+
+func TestExplainHttp(t *testing.T) {
+	var resp resty.Response
+	resp.SetBody([]byte(jsonStr1))
+
+	cases := []struct {
+		rule     VerifyRule
+		expected Mismatch
+	}{
+		{&HttpStatusEqualRule{Expected: 200},
+			Mismatch{Rule: "HttpStatusEqualRule", Expected: "200", Actual: "0"}},
+		{&HttpBodyEqualRule{JSONPath: "$[1].title", Expected: "Go in Action"},
+			Mismatch{Rule: "HttpBodyEqualRule", Expression: "jsonpath: $[1].title", Expected: "Go in Action", Actual: "Effective Go"}},
+		{&HttpBodyEqualRule{Xpath: "//isbn", Expected: "1"},
+			Mismatch{Rule: "HttpBodyEqualRule", Expression: "xpath: //isbn", Expected: "1", Actual: ActualNotFound}},
+		{&HttpBodyAtLeastOneRule{JMESPath: "[].id", Expected: 3},
+			Mismatch{Rule: "HttpBodyAtLeastOneRule", Expression: "jmespath: [].id", Expected: "3", Actual: "[1, 2]"}},
+		{&HttpLuaRule{LuaStr: "function verify(r) return false end"},
+			Mismatch{Rule: "HttpLuaRule", Expected: "true", Actual: ActualFalse}},
+	}
+	for _, item := range cases {
+		assert.Equal(t, item.expected, ExplainHttp(item.rule, &resp))
+	}
+}
+
+func TestExplainGrpc(t *testing.T) {
+	resp := model.GrpcResp{Code: "NotFound", Body: jsonStr1}
+
+	cases := []struct {
+		rule     VerifyRuleGrpc
+		expected Mismatch
+	}{
+		{&GrpcCodeEqualRule{Expected: "OK"},
+			Mismatch{Rule: "GrpcCodeEqualRule", Expected: "OK", Actual: "NotFound"}},
+		{&GrpcBodyEqualRule{Xpath: "(//author)[2]", Expected: "Rob Pike"},
+			Mismatch{Rule: "GrpcBodyEqualRule", Expression: "xpath: (//author)[2]", Expected: "Rob Pike", Actual: "The Go Authors"}},
+		{&GrpcBodyAtLeastOneRule{JSONPath: "$[*].missing", Expected: "x"},
+			Mismatch{Rule: "GrpcBodyAtLeastOneRule", Expression: "jsonpath: $[*].missing", Expected: "x", Actual: ActualNotFound}},
+	}
+	for _, item := range cases {
+		assert.Equal(t, item.expected, ExplainGrpc(item.rule, &resp))
+	}
+}
@@ -90,9 +90,9 @@ func (r *GrpcLuaRule) Verify(resp *model.GrpcResp) bool {
 	if err != nil {
 		zaplog.Error("GrpcLuaRule-Verify",
 			zap.String("code", resp.Code),
-			zap.String("body", resp.Body),
+			zap.String("body", Mask(resp.Body)),
 			zap.String("LuaStr", r.LuaStr),
-			zap.Error(err))
+			zap.String("error", Mask(err.Error())))
 		return false
 	}
 	return value == lua.LTrue
@@ -1,9 +1,6 @@
 package rule
 
 import (
-	"strings"
-
-	"github.com/antchfx/jsonquery"
 	"github.com/vearne/autotest/internal/model"
 )
 
@@ -23,19 +20,26 @@ func (r *GrpcCodeEqualRule) Verify(resp *model.GrpcResp) bool {
 type GrpcBodyEqualRule struct {
 	Xpath    string `json:"xpath"`
 	Expected any    `json:"expected"`
+	// alternatives to Xpath
+	JSONPath string `json:"jsonpath"`
+	JMESPath string `json:"jmespath"`
 }
 
 func (r *GrpcBodyEqualRule) Name() string {
 	return "GrpcBodyEqualRule"
 }
 
+// Query the body of a gRPC response is always rendered as JSON.
+func (r *GrpcBodyEqualRule) Query() Query {
+	return Query{Format: FormatJSON, Xpath: r.Xpath, JSONPath: r.JSONPath, JMESPath: r.JMESPath}
+}
+
 func (r *GrpcBodyEqualRule) Verify(resp *model.GrpcResp) bool {
-	doc, err := jsonquery.Parse(strings.NewReader(resp.Body))
+	value, found, err := FindOne(resp.Body, r.Query())
 	if err != nil {
 		return false
 	}
-	node := jsonquery.FindOne(doc, r.Xpath)
-	return node != nil && convStr(r.Expected) == convStr(node.Value())
+	return found && convStr(r.Expected) == convStr(value)
 }
 
 // implement VerifyRule
@@ -43,20 +47,27 @@ func (r *GrpcBodyEqualRule) Verify(resp *model.GrpcResp) bool {
 type GrpcBodyAtLeastOneRule struct {
 	Xpath    string `json:"xpath"`
 	Expected any    `json:"expected"`
+	// alternatives to Xpath
+	JSONPath string `json:"jsonpath"`
+	JMESPath string `json:"jmespath"`
 }
 
 func (r *GrpcBodyAtLeastOneRule) Name() string {
 	return "GrpcBodyAtLeastOneRule"
 }
 
+// Query the body of a gRPC response is always rendered as JSON.
+func (r *GrpcBodyAtLeastOneRule) Query() Query {
+	return Query{Format: FormatJSON, Xpath: r.Xpath, JSONPath: r.JSONPath, JMESPath: r.JMESPath}
+}
+
 func (r *GrpcBodyAtLeastOneRule) Verify(resp *model.GrpcResp) bool {
-	doc, err := jsonquery.Parse(strings.NewReader(resp.Body))
+	values, err := FindAll(resp.Body, r.Query())
 	if err != nil {
 		return false
 	}
-	nodes := jsonquery.Find(doc, r.Xpath)
-	for _, node := range nodes {
-		if node != nil && convStr(r.Expected) == convStr(node.Value()) {
+	for _, value := range values {
+		if convStr(r.Expected) == convStr(value) {
 			return true
 		}
 	}
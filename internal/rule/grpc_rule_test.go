@@ -19,7 +19,7 @@ func TestGrpcBodyAtLeastOneRule(t *testing.T) {
 	var resp model.GrpcResp
 	resp.Body = jsonStr1
 	for _, item := range cases {
-		rule := GrpcBodyAtLeastOneRule{item.xpath, item.expected}
+		rule := GrpcBodyAtLeastOneRule{Xpath: item.xpath, Expected: item.expected}
 		assert.True(t, rule.Verify(&resp))
 	}
 }
@@ -36,7 +36,7 @@ func TestGrpcBodyEqualRule(t *testing.T) {
 	var resp model.GrpcResp
 	resp.Body = jsonStr1
 	for _, item := range cases {
-		rule := GrpcBodyEqualRule{item.xpath, item.expected}
+		rule := GrpcBodyEqualRule{Xpath: item.xpath, Expected: item.expected}
 		assert.True(t, rule.Verify(&resp))
 	}
 
@@ -55,7 +55,16 @@ func TestGrpcBodyEqualRule2(t *testing.T) {
 	var resp model.GrpcResp
 	resp.Body = jsonStr2
 	for _, item := range cases {
-		rule := GrpcBodyEqualRule{item.xpath, item.expected}
+		rule := GrpcBodyEqualRule{Xpath: item.xpath, Expected: item.expected}
 		assert.True(t, rule.Verify(&resp))
 	}
 }
+
+func TestGrpcBodyEqualRuleJMESPath(t *testing.T) {
+	resp := model.GrpcResp{Code: "OK", Body: jsonStr2}
+	rule := GrpcBodyEqualRule{JMESPath: "person.name", Expected: "John"}
+	assert.True(t, rule.Verify(&resp))
+
+	rule2 := GrpcBodyAtLeastOneRule{JSONPath: "$.person.hobbies[*]", Expected: "football"}
+	assert.True(t, rule2.Verify(&resp))
+}
@@ -104,14 +104,14 @@ return verify(r);
 		fmt.Fprintln(&b, "body\t:", resp.String())
 		fmt.Fprintln(&b, "LuaStr\t:", r.LuaStr)
 		fmt.Fprintln(&b, "error\t:", err.Error())
-		os.Stderr.WriteString(b.String())
+		os.Stderr.WriteString(Mask(b.String()))
 
 		// 2. output in the log
 		zaplog.Error("HttpLuaRule-Verify",
 			zap.Int("status", resp.StatusCode()),
-			zap.String("body", resp.String()),
+			zap.String("body", Mask(resp.String())),
 			zap.String("LuaStr", r.LuaStr),
-			zap.Error(err))
+			zap.String("error", Mask(err.Error())))
 		return false
 	}
 	return value == lua.LTrue
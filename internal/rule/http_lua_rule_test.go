@@ -1,6 +1,9 @@
 package rule
 
 import (
+	"io"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/go-resty/resty/v2"
@@ -49,3 +52,35 @@ end
 	rule := HttpLuaRule{LuaStr: luaStr}
 	assert.False(t, rule.Verify(&resp))
 }
+
+func TestHttpLuaRuleMasked(t *testing.T) {
+	Mask = func(s string) string {
+		return strings.ReplaceAll(s, "s3cret", "******")
+	}
+	defer func() {
+		Mask = func(s string) string {
+			return s
+		}
+	}()
+
+	stderr := os.Stderr
+	reader, writer, err := os.Pipe()
+	assert.NoError(t, err)
+	os.Stderr = writer
+	var resp resty.Response
+	resp.SetBody([]byte(`{"token": "s3cret"}`))
+	rule := HttpLuaRule{LuaStr: `
+function verify(r)
+	error("unexpected body " .. r:body())
+end
+`}
+	result := rule.Verify(&resp)
+	os.Stderr = stderr
+	writer.Close()
+	output, _ := io.ReadAll(reader)
+
+	assert.False(t, result)
+	assert.Contains(t, string(output), `body	: {"token": "******"}`)
+	assert.Contains(t, string(output), `unexpected body {"token": "******"}`)
+	assert.NotContains(t, string(output), "s3cret")
+}
@@ -1,9 +1,6 @@
 package rule
 
 import (
-	"strings"
-
-	"github.com/antchfx/jsonquery"
 	"github.com/go-resty/resty/v2"
 )
 
@@ -24,19 +21,27 @@ func (r *HttpStatusEqualRule) Verify(resp *resty.Response) bool {
 type HttpBodyEqualRule struct {
 	Xpath    string `json:"xpath"`
 	Expected any    `json:"expected"`
+	// optional, json | xml | html | text, detected from the Content-Type by default
+	Format string `json:"format"`
+	// alternatives to Xpath for JSON bodies
+	JSONPath string `json:"jsonpath"`
+	JMESPath string `json:"jmespath"`
 }
 
 func (r *HttpBodyEqualRule) Name() string {
 	return "HttpBodyEqualRule"
 }
 
+func (r *HttpBodyEqualRule) Query() Query {
+	return Query{Format: r.Format, Xpath: r.Xpath, JSONPath: r.JSONPath, JMESPath: r.JMESPath}
+}
+
 func (r *HttpBodyEqualRule) Verify(resp *resty.Response) bool {
-	doc, err := jsonquery.Parse(strings.NewReader(resp.String()))
+	value, found, err := FindOne(resp.String(), httpQuery(resp, r.Query()))
 	if err != nil {
 		return false
 	}
-	node := jsonquery.FindOne(doc, r.Xpath)
-	return node != nil && convStr(r.Expected) == convStr(node.Value())
+	return found && convStr(r.Expected) == convStr(value)
 }
 
 // 实现 VerifyRule
@@ -44,22 +49,38 @@ func (r *HttpBodyEqualRule) Verify(resp *resty.Response) bool {
 type HttpBodyAtLeastOneRule struct {
 	Xpath    string `json:"xpath"`
 	Expected any    `json:"expected"`
+	// optional, json | xml | html | text, detected from the Content-Type by default
+	Format string `json:"format"`
+	// alternatives to Xpath for JSON bodies
+	JSONPath string `json:"jsonpath"`
+	JMESPath string `json:"jmespath"`
 }
 
 func (r *HttpBodyAtLeastOneRule) Name() string {
 	return "HttpBodyAtLeastOneRule"
 }
 
+func (r *HttpBodyAtLeastOneRule) Query() Query {
+	return Query{Format: r.Format, Xpath: r.Xpath, JSONPath: r.JSONPath, JMESPath: r.JMESPath}
+}
+
 func (r *HttpBodyAtLeastOneRule) Verify(resp *resty.Response) bool {
-	doc, err := jsonquery.Parse(strings.NewReader(resp.String()))
+	values, err := FindAll(resp.String(), httpQuery(resp, r.Query()))
 	if err != nil {
 		return false
 	}
-	nodes := jsonquery.Find(doc, r.Xpath)
-	for _, node := range nodes {
-		if node != nil && convStr(r.Expected) == convStr(node.Value()) {
+	for _, value := range values {
+		if convStr(r.Expected) == convStr(value) {
 			return true
 		}
 	}
 	return false
 }
+
+// httpQuery completes the query for a response, an explicit format wins over the Content-Type.
+func httpQuery(resp *resty.Response, q Query) Query {
+	if len(q.Format) <= 0 {
+		q.Format = DetectFormat(resp.Header().Get("Content-Type"))
+	}
+	return q
+}
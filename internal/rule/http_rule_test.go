@@ -1,6 +1,7 @@
 package rule
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/go-resty/resty/v2"
@@ -19,7 +20,7 @@ func TestHttpBodyAtLeastOneRule(t *testing.T) {
 	var resp resty.Response
 	resp.SetBody([]byte(jsonStr1))
 	for _, item := range cases {
-		rule := HttpBodyAtLeastOneRule{item.xpath, item.expected}
+		rule := HttpBodyAtLeastOneRule{Xpath: item.xpath, Expected: item.expected}
 		assert.True(t, rule.Verify(&resp))
 	}
 }
@@ -36,7 +37,7 @@ func TestHttpBodyEqualRule(t *testing.T) {
 	var resp resty.Response
 	resp.SetBody([]byte(jsonStr1))
 	for _, item := range cases {
-		rule := HttpBodyEqualRule{item.xpath, item.expected}
+		rule := HttpBodyEqualRule{Xpath: item.xpath, Expected: item.expected}
 		assert.True(t, rule.Verify(&resp))
 	}
 
@@ -55,7 +56,65 @@ func TestHttpBodyEqualRule2(t *testing.T) {
 	var resp resty.Response
 	resp.SetBody([]byte(jsonStr2))
 	for _, item := range cases {
-		rule := HttpBodyEqualRule{item.xpath, item.expected}
+		rule := HttpBodyEqualRule{Xpath: item.xpath, Expected: item.expected}
 		assert.True(t, rule.Verify(&resp))
 	}
 }
+
+const xmlStr1 = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <GetBookResponse>
+      <book id="1"><title>The Go Programming Language</title></book>
+      <book id="2"><title>Effective Go</title></book>
+    </GetBookResponse>
+  </soap:Body>
+</soap:Envelope>`
+
+const htmlStr1 = `<html><body>
+<h1 class="title">Admin Console</h1>
+<ul><li>alice</li><li>bob</li></ul>
+</body></html>`
+
+func newRespWithContentType(body string, contentType string) *resty.Response {
+	var resp resty.Response
+	resp.RawResponse = &http.Response{Header: http.Header{}}
+	resp.RawResponse.Header.Set("Content-Type", contentType)
+	resp.SetBody([]byte(body))
+	return &resp
+}
+
+func TestHttpBodyEqualRuleXML(t *testing.T) {
+	resp := newRespWithContentType(xmlStr1, "text/xml; charset=utf-8")
+	cases := []struct {
+		xpath    string
+		expected any
+	}{
+		{"//book[@id='2']/title", "Effective Go"},
+		{"(//book)[1]/@id", 1},
+	}
+	for _, item := range cases {
+		rule := HttpBodyEqualRule{Xpath: item.xpath, Expected: item.expected}
+		assert.True(t, rule.Verify(resp), item.xpath)
+	}
+}
+
+func TestHttpBodyAtLeastOneRuleHTML(t *testing.T) {
+	resp := newRespWithContentType(htmlStr1, "text/html")
+	rule := HttpBodyAtLeastOneRule{Xpath: "//li", Expected: "bob"}
+	assert.True(t, rule.Verify(resp))
+
+	rule2 := HttpBodyEqualRule{Xpath: "//h1[@class='title']", Expected: "Admin Console"}
+	assert.True(t, rule2.Verify(resp))
+}
+
+func TestHttpBodyEqualRuleText(t *testing.T) {
+	resp := newRespWithContentType("status=ok; version=1.2.3", "text/plain")
+	rule := HttpBodyEqualRule{Xpath: `version=([0-9.]+)`, Expected: "1.2.3"}
+	assert.True(t, rule.Verify(resp))
+
+	// an explicit format overrides the Content-Type
+	resp = newRespWithContentType(`<a><b>1</b></a>`, "application/octet-stream")
+	rule = HttpBodyEqualRule{Xpath: "/a/b", Expected: 1, Format: FormatXML}
+	assert.True(t, rule.Verify(resp))
+}
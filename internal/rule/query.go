@@ -0,0 +1,223 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/jsonquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/jmespath/go-jmespath"
+	"github.com/ohler55/ojg/jp"
+)
+
+// Supported response body formats
+const (
+	FormatJSON = "json"
+	FormatXML  = "xml"
+	FormatHTML = "html"
+	FormatText = "text"
+)
+
+var ErrNoExpression = errors.New("one of xpath, jsonpath and jmespath is required")
+var ErrTooManyExpressions = errors.New("only one of xpath, jsonpath and jmespath can be set")
+
+// Query locates values inside a response body.
+// Exactly one of Xpath, JSONPath and JMESPath is expected to be set.
+type Query struct {
+	// json | xml | html | text, detected from the Content-Type when empty
+	Format string
+	// XPath expression, or a regular expression when the body is plain text
+	Xpath string
+	// JSONPath expression, e.g. $.items[*].id, JSON bodies only
+	JSONPath string
+	// JMESPath expression, e.g. items[].id, JSON bodies only
+	JMESPath string
+}
+
+// Check verifies that the query holds exactly one expression
+// and that the expression can be used with the body format.
+func (q Query) Check() error {
+	count := 0
+	for _, expr := range []string{q.Xpath, q.JSONPath, q.JMESPath} {
+		if len(expr) > 0 {
+			count++
+		}
+	}
+	if count == 0 {
+		return ErrNoExpression
+	}
+	if count > 1 {
+		return ErrTooManyExpressions
+	}
+	if len(q.Xpath) <= 0 && len(q.Format) > 0 && q.Format != FormatJSON {
+		return fmt.Errorf("jsonpath and jmespath only support json bodies, format:%v", q.Format)
+	}
+	return nil
+}
+
+// Expression returns the expression of the query with its kind, e.g. "jsonpath: $.id".
+func (q Query) Expression() string {
+	switch {
+	case len(q.JSONPath) > 0:
+		return "jsonpath: " + q.JSONPath
+	case len(q.JMESPath) > 0:
+		return "jmespath: " + q.JMESPath
+	}
+	return "xpath: " + q.Xpath
+}
+
+// DetectFormat picks the body format from a Content-Type header.
+// Unknown or missing content types fall back to JSON.
+func DetectFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	switch {
+	case strings.Contains(mediaType, "json"):
+		return FormatJSON
+	case strings.Contains(mediaType, "html"):
+		return FormatHTML
+	case strings.Contains(mediaType, "xml"):
+		return FormatXML
+	case strings.HasPrefix(mediaType, "text/"):
+		return FormatText
+	}
+	return FormatJSON
+}
+
+// NormalizeFormat validates a user supplied format, empty means auto-detect.
+func NormalizeFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "", FormatJSON, FormatXML, FormatHTML, FormatText:
+		return format, nil
+	case "soap":
+		return FormatXML, nil
+	case "plain", "txt":
+		return FormatText, nil
+	}
+	return "", fmt.Errorf("unknown body format:%v", format)
+}
+
+// FindAll returns the values of all the nodes matched by the query.
+func FindAll(body string, q Query) ([]any, error) {
+	if len(q.JSONPath) > 0 {
+		return findJSONPath(body, q.JSONPath)
+	}
+	if len(q.JMESPath) > 0 {
+		result, err := searchJMESPath(body, q.JMESPath)
+		if err != nil || result == nil {
+			return nil, err
+		}
+		// a projection yields one value per element
+		if list, ok := result.([]any); ok {
+			return list, nil
+		}
+		return []any{result}, nil
+	}
+
+	switch q.Format {
+	case FormatXML:
+		doc, err := xmlquery.Parse(strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := xmlquery.QueryAll(doc, q.Xpath)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, 0, len(nodes))
+		for _, node := range nodes {
+			values = append(values, node.InnerText())
+		}
+		return values, nil
+	case FormatHTML:
+		doc, err := htmlquery.Parse(strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := htmlquery.QueryAll(doc, q.Xpath)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, 0, len(nodes))
+		for _, node := range nodes {
+			values = append(values, strings.TrimSpace(htmlquery.InnerText(node)))
+		}
+		return values, nil
+	case FormatText:
+		re, err := regexp.Compile(q.Xpath)
+		if err != nil {
+			return nil, err
+		}
+		var values []any
+		for _, match := range re.FindAllStringSubmatch(body, -1) {
+			// the first capture group wins, otherwise the whole match
+			if len(match) > 1 {
+				values = append(values, match[1])
+			} else {
+				values = append(values, match[0])
+			}
+		}
+		return values, nil
+	default:
+		doc, err := jsonquery.Parse(strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		nodes, err := jsonquery.QueryAll(doc, q.Xpath)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, 0, len(nodes))
+		for _, node := range nodes {
+			if node != nil {
+				values = append(values, node.Value())
+			}
+		}
+		return values, nil
+	}
+}
+
+// FindOne returns the value of the first node matched by the query.
+// For JMESPath the whole result of the expression is returned.
+func FindOne(body string, q Query) (value any, found bool, err error) {
+	if len(q.JMESPath) > 0 {
+		value, err = searchJMESPath(body, q.JMESPath)
+		return value, err == nil && value != nil, err
+	}
+
+	values, err := FindAll(body, q)
+	if err != nil || len(values) == 0 {
+		return nil, false, err
+	}
+	return values[0], true, nil
+}
+
+func findJSONPath(body string, expr string) ([]any, error) {
+	x, err := jp.ParseString(expr)
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	err = json.Unmarshal([]byte(body), &data)
+	if err != nil {
+		return nil, err
+	}
+	return x.Get(data), nil
+}
+
+func searchJMESPath(body string, expr string) (any, error) {
+	var data any
+	err := json.Unmarshal([]byte(body), &data)
+	if err != nil {
+		return nil, err
+	}
+	return jmespath.Search(expr, data)
+}
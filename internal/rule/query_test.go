@@ -0,0 +1,68 @@
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFormat(t *testing.T) {
+	cases := []struct {
+		contentType string
+		expected    string
+	}{
+		{"application/json; charset=utf-8", FormatJSON},
+		{"application/problem+json", FormatJSON},
+		{"text/xml", FormatXML},
+		{"application/soap+xml; charset=utf-8", FormatXML},
+		{"text/html; charset=UTF-8", FormatHTML},
+		{"application/xhtml+xml", FormatHTML},
+		{"text/plain", FormatText},
+		{"", FormatJSON},
+	}
+	for _, item := range cases {
+		assert.Equal(t, item.expected, DetectFormat(item.contentType), item.contentType)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	values, err := FindAll(jsonStr1, Query{Format: FormatJSON, Xpath: "//title"})
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"The Go Programming Language", "Effective Go"}, values)
+
+	values, err = FindAll(xmlStr1, Query{Format: FormatXML, Xpath: "//book/@id"})
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"1", "2"}, values)
+
+	values, err = FindAll("id=7,id=8", Query{Format: FormatText, Xpath: `id=(\d+)`})
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"7", "8"}, values)
+
+	_, err = FindAll("abc", Query{Format: FormatText, Xpath: `(`})
+	assert.NotNil(t, err)
+}
+
+func TestFindJSONPathAndJMESPath(t *testing.T) {
+	values, err := FindAll(jsonStr1, Query{JSONPath: "$[*].title"})
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"The Go Programming Language", "Effective Go"}, values)
+
+	value, found, err := FindOne(jsonStr2, Query{JSONPath: "$.person.hobbies[1]"})
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "eating", value)
+
+	values, err = FindAll(jsonStr1, Query{JMESPath: "[?id > `1`].title"})
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"Effective Go"}, values)
+
+	// JMESPath compares the whole result of the expression
+	value, found, err = FindOne(jsonStr2, Query{JMESPath: "person.hobbies"})
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, convStr([]string{"coding", "eating", "football"}), convStr(value))
+
+	_, found, err = FindOne(jsonStr2, Query{JMESPath: "person.missing"})
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
@@ -17,6 +17,12 @@ type VerifyRuleGrpc interface {
 	Verify(response *model.GrpcResp) bool
 }
 
+// Mask hides the values of the secrets in the output of the rules,
+// it is replaced once the secrets are loaded
+var Mask = func(s string) string {
+	return s
+}
+
 func convStr(v any) string {
 	return fmt.Sprintf("%v", v)
 }
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	slog "github.com/vearne/simplelog"
+)
+
+// AllureResultsDir Allure 结果文件所在的目录，位于报告目录下
+const AllureResultsDir = "allure-results"
+
+// Allure 用例和步骤的状态
+const (
+	AllureStatusPassed  = "passed"
+	AllureStatusFailed  = "failed"
+	AllureStatusBroken  = "broken"
+	AllureStatusSkipped = "skipped"
+)
+
+// allureResult Allure 的用例结果，对应 <uuid>-result.json
+type allureResult struct {
+	UUID          string              `json:"uuid"`
+	HistoryID     string              `json:"historyId"`
+	TestCaseID    string              `json:"testCaseId"`
+	Name          string              `json:"name"`
+	FullName      string              `json:"fullName"`
+	Status        string              `json:"status"`
+	StatusDetails allureStatusDetails `json:"statusDetails"`
+	Stage         string              `json:"stage"`
+	Start         int64               `json:"start,omitempty"`
+	Stop          int64               `json:"stop,omitempty"`
+	Labels        []allureLabel       `json:"labels"`
+	Steps         []allureStep        `json:"steps,omitempty"`
+	Attachments   []allureAttachment  `json:"attachments,omitempty"`
+}
+
+type allureStatusDetails struct {
+	Message string `json:"message,omitempty"`
+	Flaky   bool   `json:"flaky,omitempty"`
+	Muted   bool   `json:"muted,omitempty"`
+}
+
+type allureStep struct {
+	Name          string              `json:"name"`
+	Status        string              `json:"status"`
+	StatusDetails allureStatusDetails `json:"statusDetails"`
+	Stage         string              `json:"stage"`
+	Start         int64               `json:"start"`
+	Stop          int64               `json:"stop"`
+}
+
+type allureLabel struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type allureAttachment struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+}
+
+// generateAllureResults 生成 Allure 结果文件，每个用例一个结果文件，请求和响应作为附件
+func (rg *ReportGenerator) generateAllureResults(data ReportData) error {
+	dirPath := filepath.Join(rg.config.Global.Report.DirPath, AllureResultsDir)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("failed to create allure results directory: %w", err)
+	}
+
+	for _, tc := range data.TestCases {
+		result := newAllureResult(tc)
+		for _, attachment := range []struct{ name, content string }{
+			{"request", tc.RequestDetail},
+			{"response", tc.ResponseDetail},
+		} {
+			if len(attachment.content) <= 0 {
+				continue
+			}
+			source := newUUID() + "-attachment.txt"
+			if err := os.WriteFile(filepath.Join(dirPath, source), []byte(attachment.content), 0644); err != nil {
+				return fmt.Errorf("failed to write allure attachment: %w", err)
+			}
+			result.Attachments = append(result.Attachments,
+				allureAttachment{Name: attachment.name, Source: source, Type: "text/plain"})
+		}
+
+		content, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal allure result: %w", err)
+		}
+		filePath := filepath.Join(dirPath, result.UUID+"-result.json")
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return fmt.Errorf("failed to write allure result: %w", err)
+		}
+	}
+
+	slog.Info("Allure results generated: %s", dirPath)
+	return nil
+}
+
+// newAllureResult 用例结果转换为 Allure 结果，historyId 由协议、规则文件和用例ID得出，
+// 多次运行间保持不变
+func newAllureResult(tc TestCaseResult) allureResult {
+	key := CaseKey(tc.Protocol, tc.File, tc.ID)
+	result := allureResult{
+		UUID:       newUUID(),
+		HistoryID:  MD5(key),
+		TestCaseID: MD5(key),
+		Name:       tc.Description,
+		FullName:   fmt.Sprintf("%v#%v", tc.File, tc.ID),
+		Status:     allureStatus(tc),
+		Stage:      "finished",
+		Start:      allureTime(tc.StartTime),
+		Stop:       allureTime(tc.EndTime),
+		Labels: []allureLabel{
+			{Name: "parentSuite", Value: tc.Protocol},
+			{Name: "suite", Value: filepath.Base(tc.File)},
+			{Name: "framework", Value: "autotest"},
+		},
+	}
+	if len(result.Name) <= 0 {
+		result.Name = fmt.Sprintf("%v_%v", tc.Protocol, tc.ID)
+	}
+	result.StatusDetails = allureStatusDetails{
+		Message: tc.ErrorMsg,
+		Flaky:   tc.Status == StatusFlaky,
+		Muted:   tc.Quarantined,
+	}
+	if len(result.StatusDetails.Message) <= 0 {
+		result.StatusDetails.Message = tc.Reason
+	}
+	for _, tag := range tc.Tags {
+		result.Labels = append(result.Labels, allureLabel{Name: "tag", Value: tag})
+	}
+
+	for _, step := range tc.Steps {
+		status := AllureStatusPassed
+		if step.Status == StatusFailed {
+			status = AllureStatusBroken
+			if step.Name == StepVerify {
+				status = AllureStatusFailed
+			}
+		}
+		result.Steps = append(result.Steps, allureStep{
+			Name:          step.Name,
+			Status:        status,
+			StatusDetails: allureStatusDetails{Message: step.Error},
+			Stage:         "finished",
+			Start:         allureTime(step.StartTime),
+			Stop:          allureTime(step.EndTime),
+		})
+	}
+	return result
+}
+
+// allureStatus 校验规则不通过为 failed，请求失败等其他错误为 broken
+func allureStatus(tc TestCaseResult) string {
+	switch tc.Status {
+	case StatusPassed:
+		return AllureStatusPassed
+	case StatusSkipped, StatusCancelled:
+		return AllureStatusSkipped
+	}
+	if len(tc.Steps) <= 0 {
+		return AllureStatusBroken
+	}
+	for _, step := range tc.Steps {
+		if step.Status == StatusFailed && (step.Name == StepRender || step.Name == StepRequest) {
+			return AllureStatusBroken
+		}
+	}
+	return AllureStatusFailed
+}
+
+// allureTime Allure 使用毫秒时间戳，未执行的用例没有时间
+func allureTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// newUUID 随机生成 UUID v4
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:]) //nolint: errcheck
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
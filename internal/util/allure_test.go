@@ -0,0 +1,77 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+)
+
+func TestGenerateAllureResults(t *testing.T) {
+	var cfg config.AutoTestConfig
+	cfg.Global.Report.DirPath = t.TempDir()
+	cfg.Global.Report.Formats = []string{"allure"}
+
+	var data ReportData
+	data.TestCases = []TestCaseResult{
+		{ID: 1, Description: "get book", Protocol: "http", File: "/rules/book.yml", Status: StatusFailed,
+			Reason: "ReasonRuleVerifyFailed", ErrorMsg: "ReasonRuleVerifyFailed", Tags: []string{"smoke"},
+			Steps: []CaseStep{
+				{Name: StepRender, Status: StatusPassed},
+				{Name: StepRequest, Status: StatusPassed},
+				{Name: StepVerify, Status: StatusFailed, Error: "verify rule #1 failed"},
+			},
+			RequestDetail: "GET /books/1\n", ResponseDetail: "STATUS: 500\n"},
+		{ID: 2, Description: "add book", Protocol: "http", File: "/rules/book.yml", Status: StatusFailed,
+			Steps: []CaseStep{
+				{Name: StepRender, Status: StatusPassed},
+				{Name: StepRequest, Status: StatusFailed, Error: "connection refused"},
+			}},
+		{ID: 1, Protocol: "grpc", File: "/rules/hello.yml", Status: StatusSkipped, Reason: "ReasonSkipped"},
+	}
+	assert.NoError(t, NewReportGenerator(cfg).GenerateReports(data))
+
+	dirPath := filepath.Join(cfg.Global.Report.DirPath, AllureResultsDir)
+	entries, err := os.ReadDir(dirPath)
+	assert.NoError(t, err)
+	results := map[string]map[string]any{}
+	var attachments int
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), "-attachment.txt") {
+			attachments++
+			continue
+		}
+		assert.True(t, strings.HasSuffix(entry.Name(), "-result.json"), entry.Name())
+		b, _ := os.ReadFile(filepath.Join(dirPath, entry.Name()))
+		var result map[string]any
+		assert.NoError(t, json.Unmarshal(b, &result))
+		results[result["fullName"].(string)] = result
+	}
+	assert.Len(t, results, 3)
+	assert.Equal(t, 2, attachments)
+
+	getBook := results["/rules/book.yml#1"]
+	assert.Equal(t, "failed", getBook["status"])
+	assert.Equal(t, MD5("http:/rules/book.yml:1"), getBook["historyId"])
+	assert.Contains(t, getBook["labels"], map[string]any{"name": "tag", "value": "smoke"})
+	assert.Contains(t, getBook["labels"], map[string]any{"name": "suite", "value": "book.yml"})
+	steps := getBook["steps"].([]any)
+	assert.Len(t, steps, 3)
+	assert.Equal(t, "failed", steps[2].(map[string]any)["status"])
+	attachment := getBook["attachments"].([]any)[0].(map[string]any)
+	assert.Equal(t, "request", attachment["name"])
+	content, err := os.ReadFile(filepath.Join(dirPath, attachment["source"].(string)))
+	assert.NoError(t, err)
+	assert.Equal(t, "GET /books/1\n", string(content))
+
+	// a failed request is broken rather than failed
+	assert.Equal(t, "broken", results["/rules/book.yml#2"]["status"])
+	hello := results["/rules/hello.yml#1"]
+	assert.Equal(t, "skipped", hello["status"])
+	assert.Equal(t, "grpc_1", hello["name"])
+	assert.Equal(t, "ReasonSkipped", hello["statusDetails"].(map[string]any)["message"])
+}
@@ -0,0 +1,209 @@
+package util
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vearne/autotest/internal/config"
+)
+
+// SMTP 连接的加密方式
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// SMTPTLSModes 支持的加密方式
+var SMTPTLSModes = []string{SMTPStartTLS, SMTPTLS, SMTPNone}
+
+// emailAttachments 邮件附带的报告，只附带本次运行生成了的文件
+var emailAttachments = []string{"report.html", "junit.xml"}
+
+// emailRecipients 按运行结果选择收件人
+func emailRecipients(ch config.NotifierChannel, status string) []string {
+	recipients := append([]string{}, ch.To...)
+	if status == NotifyStatusSuccess {
+		recipients = append(recipients, ch.ToOnSuccess...)
+	} else {
+		recipients = append(recipients, ch.ToOnFailure...)
+	}
+	return recipients
+}
+
+// sendEmail 通过 SMTP 发送通知，正文为汇总信息，附带 HTML 报告和 JUnit 报告
+func (ns *NotificationService) sendEmail(ch config.NotifierChannel, n notification) error {
+	recipients := emailRecipients(ch, n.Status)
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var attachments []string
+	for _, name := range emailAttachments {
+		path := filepath.Join(ns.config.Global.Report.DirPath, name)
+		if _, err := os.Stat(path); err == nil {
+			attachments = append(attachments, path)
+		}
+	}
+	msg, err := buildEmail(ch.SMTP.From, recipients, n, attachments)
+	if err != nil {
+		return err
+	}
+	return sendSMTP(ch.SMTP, recipients, msg, ns.client.Timeout)
+}
+
+// buildEmail 构造 multipart/mixed 邮件
+func buildEmail(from string, to []string, n notification, attachments []string) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	var html bytes.Buffer
+	if err := emailTemplate.Execute(&html, n); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, html.Bytes())
+
+	for _, path := range attachments {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if len(contentType) <= 0 {
+			contentType = "application/octet-stream"
+		}
+		part, err = writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(path)})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, content)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", n.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// writeBase64 按每行76个字符写入 base64 编码的内容
+func writeBase64(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n")) //nolint: errcheck
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n")) //nolint: errcheck
+}
+
+// sendSMTP 连接 SMTP 服务器并发送邮件，支持 STARTTLS、隐式 TLS 和认证
+func sendSMTP(cfg *config.SMTP, to []string, msg []byte, timeout time.Duration) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dialer := &net.Dialer{Timeout: timeout}
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	var conn net.Conn
+	var err error
+	if cfg.TLS == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout)) //nolint: errcheck
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if cfg.TLS == "" || cfg.TLS == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %v does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	if len(cfg.Username) > 0 {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("smtp auth failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(cfg.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %v failed: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// 邮件正文模板
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif;">
+    <h2>{{.Title}}</h2>
+    <table style="border-collapse: collapse;">
+        {{range .Fields}}
+        <tr>
+            <td style="border: 1px solid #ddd; padding: 6px;"><strong>{{.Title}}</strong></td>
+            <td style="border: 1px solid #ddd; padding: 6px;">{{.Value}}</td>
+        </tr>
+        {{end}}
+    </table>
+    {{if .FailedCases}}
+    <h3>{{.FailedCasesTitle}}</h3>
+    <p>{{range .FailedCases}}{{.}}<br>{{end}}</p>
+    {{end}}
+</body>
+</html>`))
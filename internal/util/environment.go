@@ -3,46 +3,120 @@ package util
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/vearne/autotest/internal/config"
 	slog "github.com/vearne/simplelog"
 )
 
+// 变量来源，优先级从低到高:
+// 基础环境(extends) < 选中的环境 < 环境的 env_file < 敏感变量(secrets) < --var
+const (
+	SourceEnvironment = "environment"
+	SourceEnvFile     = "env_file"
+	SourceSecret      = "secret"
+	SourceVar         = "--var"
+)
+
+// envRefRegex 匹配 ${NAME} 形式的进程环境变量引用
+var envRefRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
 // EnvironmentManager 环境管理器
 type EnvironmentManager struct {
 	config config.AutoTestConfig
 	vars   map[string]string
+	// 变量的来源
+	sources map[string]string
+	// 创建时的进程环境变量，${NAME} 引用的是它们，而不是加载环境时设置的变量
+	processEnv map[string]string
 }
 
 // NewEnvironmentManager 创建环境管理器
 func NewEnvironmentManager(cfg config.AutoTestConfig) *EnvironmentManager {
+	processEnv := make(map[string]string)
+	for _, item := range os.Environ() {
+		key, value, _ := strings.Cut(item, "=")
+		processEnv[key] = value
+	}
 	return &EnvironmentManager{
-		config: cfg,
-		vars:   make(map[string]string),
+		config:     cfg,
+		vars:       make(map[string]string),
+		sources:    make(map[string]string),
+		processEnv: processEnv,
+	}
+}
+
+// EnvironmentChain 返回环境及其基础环境的名称，最底层的基础环境在前，
+// 环境不存在或 extends 形成循环时返回错误
+func EnvironmentChain(envs map[string]config.Environment, envName string) ([]string, error) {
+	var chain []string
+	for name := envName; len(name) > 0; name = envs[name].Extends {
+		if slices.Contains(chain, name) {
+			return nil, fmt.Errorf("environment '%s' extends itself, %s -> %s",
+				envName, strings.Join(chain, " -> "), name)
+		}
+		if _, exists := envs[name]; !exists {
+			if name == envName {
+				return nil, fmt.Errorf("environment '%s' not found in configuration", envName)
+			}
+			return nil, fmt.Errorf("environment '%s' extends '%s', which is not found", chain[len(chain)-1], name)
+		}
+		chain = append(chain, name)
 	}
+	slices.Reverse(chain)
+	return chain, nil
 }
 
-// LoadEnvironment 加载指定环境的配置
+// ExpandEnvRefs 把 value 中的 ${NAME} 替换为进程环境变量 NAME 的值，变量未设置时返回错误
+func (em *EnvironmentManager) ExpandEnvRefs(value string) (string, error) {
+	var err error
+	result := envRefRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envRefRegex.FindStringSubmatch(ref)[1]
+		v, ok := em.processEnv[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	return result, err
+}
+
+// LoadEnvironment 加载指定环境的配置，先加载基础环境，每个环境的 env_file 覆盖该环境中的变量
 func (em *EnvironmentManager) LoadEnvironment(envName string) error {
 	if envName == "" {
 		slog.Info("No environment specified, using default configuration")
 		return nil
 	}
 
-	envConfig, exists := em.config.Environments[envName]
-	if !exists {
-		return fmt.Errorf("environment '%s' not found in configuration", envName)
+	chain, err := EnvironmentChain(em.config.Environments, envName)
+	if err != nil {
+		return err
 	}
 
-	slog.Info("Loading environment: %s", envName)
+	slog.Info("Loading environment: %s", strings.Join(chain, " -> "))
 
-	// 加载环境变量
-	for key, value := range envConfig {
-		em.vars[key] = value
-		// 同时设置到系统环境变量中，以便模板引擎使用
-		os.Setenv(key, value)
-		slog.Debug("Set environment variable: %s=%s", key, value)
+	for _, name := range chain {
+		env := em.config.Environments[name]
+		// 按名称排序，使错误信息稳定
+		keys := make([]string, 0, len(env.Vars))
+		for key := range env.Vars {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			value, err := em.ExpandEnvRefs(env.Vars[key])
+			if err != nil {
+				return fmt.Errorf("environment '%s', variable %s, %w", name, key, err)
+			}
+			em.set(key, value, SourceEnvironment+" "+name)
+		}
+		if len(env.EnvFile) > 0 {
+			if err := em.LoadFromFile(env.EnvFile); err != nil {
+				return fmt.Errorf("environment '%s', %w", name, err)
+			}
+		}
 	}
 
 	return nil
@@ -57,7 +131,7 @@ func (em *EnvironmentManager) GetAllVars() map[string]string {
 	return result
 }
 
-// LoadFromFile 从文件加载环境变量
+// LoadFromFile 从文件加载环境变量，值中的 ${NAME} 会被替换，单引号中的值除外
 func (em *EnvironmentManager) LoadFromFile(filePath string) error {
 	if filePath == "" {
 		return nil
@@ -68,6 +142,7 @@ func (em *EnvironmentManager) LoadFromFile(filePath string) error {
 		return fmt.Errorf("failed to read environment file %s: %w", filePath, err)
 	}
 
+	var count int
 	lines := strings.Split(string(content), "\n")
 	for lineNum, line := range lines {
 		line = strings.TrimSpace(line)
@@ -87,26 +162,64 @@ func (em *EnvironmentManager) LoadFromFile(filePath string) error {
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 
-		// 移除引号
+		// 移除引号，单引号中的值按字面使用
+		literal := false
 		if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
 			(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
+			literal = value[0] == '\''
 			value = value[1 : len(value)-1]
 		}
+		if !literal {
+			value, err = em.ExpandEnvRefs(value)
+			if err != nil {
+				return fmt.Errorf("environment file %s, line %d, %w", filePath, lineNum+1, err)
+			}
+		}
 
-		em.vars[key] = value
-		os.Setenv(key, value)
-		slog.Debug("Loaded from file: %s=%s", key, value)
+		em.set(key, value, SourceEnvFile+" "+filePath)
+		count++
 	}
 
-	slog.Info("Loaded %d variables from environment file: %s", len(em.vars), filePath)
+	slog.Info("Loaded %d variables from environment file: %s", count, filePath)
 	return nil
 }
 
-// SetVariable 设置环境变量
-func (em *EnvironmentManager) SetVariable(key, value string) {
+// SetVariable 设置变量，覆盖已加载的同名变量，source 是变量的来源
+func (em *EnvironmentManager) SetVariable(key, value, source string) {
+	em.set(key, value, source)
+}
+
+// set 设置变量并记录来源，非敏感变量同时设置到系统环境变量中，以便模板引擎使用
+func (em *EnvironmentManager) set(key, value, source string) {
 	em.vars[key] = value
-	os.Setenv(key, value)
-	slog.Debug("Set variable: %s=%s", key, value)
+	em.sources[key] = source
+	if !em.isSecret(key) {
+		os.Setenv(key, value)
+	}
+	slog.Debug("Set variable from %s: %s=%s", source, key, em.displayValue(key, value))
+}
+
+// Source 获取变量的来源
+func (em *EnvironmentManager) Source(key string) string {
+	return em.sources[key]
+}
+
+// isSecret 变量是否为敏感变量
+func (em *EnvironmentManager) isSecret(key string) bool {
+	for _, secret := range em.config.Secrets {
+		if secret.Name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// displayValue 日志中显示的变量值，敏感变量的值被隐藏
+func (em *EnvironmentManager) displayValue(key, value string) string {
+	if em.isSecret(key) {
+		return SecretMask
+	}
+	return value
 }
 
 // GetVariable 获取环境变量
@@ -139,6 +252,7 @@ func (em *EnvironmentManager) ListAvailableEnvironments() []string {
 	for envName := range em.config.Environments {
 		envs = append(envs, envName)
 	}
+	slices.Sort(envs)
 	return envs
 }
 
@@ -148,16 +262,25 @@ func (em *EnvironmentManager) ValidateEnvironment(envName string) error {
 		return nil
 	}
 
-	envConfig, exists := em.config.Environments[envName]
-	if !exists {
-		availableEnvs := em.ListAvailableEnvironments()
-		return fmt.Errorf("environment '%s' not found. Available environments: %v", envName, availableEnvs)
+	chain, err := EnvironmentChain(em.config.Environments, envName)
+	if err != nil {
+		if _, exists := em.config.Environments[envName]; !exists {
+			availableEnvs := em.ListAvailableEnvironments()
+			return fmt.Errorf("environment '%s' not found. Available environments: %v", envName, availableEnvs)
+		}
+		return err
 	}
 
-	// 验证必需的环境变量
+	// 验证必需的环境变量，基础环境中的变量和 env_file 中的变量也算
 	requiredVars := []string{"HOST"} // 可以根据需要扩展
 	for _, requiredVar := range requiredVars {
-		if _, exists := envConfig[requiredVar]; !exists {
+		found := false
+		for _, name := range chain {
+			env := em.config.Environments[name]
+			_, exists := env.Vars[requiredVar]
+			found = found || exists || len(env.EnvFile) > 0
+		}
+		if !found {
 			slog.Warn("Required variable '%s' not found in environment '%s'", requiredVar, envName)
 		}
 	}
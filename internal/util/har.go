@@ -0,0 +1,355 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	slog "github.com/vearne/simplelog"
+)
+
+// HarFile HAR 文件名
+const HarFile = "report.har"
+
+// HarRedacted 被隐藏的 header 值
+const HarRedacted = "[REDACTED]"
+
+// DefaultHarRedactHeaders 总是被隐藏的 header，report.har_redact_headers 在此基础上追加
+var DefaultHarRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// HarLog HAR 1.2 的 log 对象
+type HarLog struct {
+	Version string     `json:"version"`
+	Creator HarCreator `json:"creator"`
+	Pages   []HarPage  `json:"pages"`
+	Entries []HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HarPage 一个用例对应一个 page
+type HarPage struct {
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     map[string]int `json:"pageTimings"`
+}
+
+// HarEntry 一次 HTTP 请求，重试时每一次尝试都是一个 entry
+type HarEntry struct {
+	PageRef         string      `json:"pageref,omitempty"`
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HarRequest  `json:"request"`
+	Response        HarResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HarTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	// 用例中的第几次尝试，从1开始
+	Attempt int `json:"_attempt"`
+	// 请求失败的原因，此时没有响应
+	Error string `json:"_error,omitempty"`
+}
+
+type HarRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	QueryString []HarNameValue `json:"queryString"`
+	PostData    *HarPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HarNameValue `json:"cookies"`
+	Headers     []HarNameValue `json:"headers"`
+	Content     HarContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HarTimings 各阶段耗时，单位毫秒，-1 表示不适用（例如复用的连接没有 dns 和 connect）
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HarCase 请求所属的用例
+type HarCase struct {
+	File        string
+	ID          uint64
+	Description string
+}
+
+// HarRecorder 记录一次运行中用例发出的所有 HTTP 请求，并发安全
+type HarRecorder struct {
+	mu      sync.Mutex
+	redact  map[string]bool
+	masker  *SecretMasker
+	pages   []HarPage
+	pageIDs map[string]bool
+	entries []HarEntry
+}
+
+// NewHarRecorder 创建 HAR 记录器，redactHeaders 追加到默认隐藏的 header 中
+func NewHarRecorder(redactHeaders []string) *HarRecorder {
+	h := &HarRecorder{redact: make(map[string]bool), pageIDs: make(map[string]bool)}
+	for _, name := range append(append([]string{}, DefaultHarRedactHeaders...), redactHeaders...) {
+		h.redact[strings.ToLower(name)] = true
+	}
+	return h
+}
+
+// SetSecretMasker 生成 HAR 时隐藏敏感变量的值
+func (h *HarRecorder) SetSecretMasker(masker *SecretMasker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.masker = masker
+}
+
+// Record 记录一次请求，resp 可能为空，err 为请求失败的原因
+func (h *HarRecorder) Record(tc HarCase, attempt int, started time.Time,
+	req *resty.Request, resp *resty.Response, err error) {
+	pageID := CaseKey("http", tc.File, tc.ID)
+	entry := HarEntry{
+		PageRef:         pageID,
+		StartedDateTime: started,
+		Request:         h.harRequest(req),
+		Response:        h.harResponse(resp),
+		Timings:         HarTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+		Attempt:         attempt,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if resp != nil && resp.RawResponse != nil {
+		trace := req.TraceInfo()
+		if !trace.IsConnReused {
+			entry.Timings.DNS = harMillis(trace.DNSLookup)
+			entry.Timings.Connect = harMillis(trace.TCPConnTime + trace.TLSHandshake)
+			if trace.TLSHandshake > 0 {
+				entry.Timings.SSL = harMillis(trace.TLSHandshake)
+			}
+		}
+		entry.Timings.Wait = harMillis(trace.ServerTime)
+		entry.Timings.Receive = harMillis(trace.ResponseTime)
+		if trace.RemoteAddr != nil {
+			entry.ServerIPAddress, _, _ = net.SplitHostPort(trace.RemoteAddr.String())
+		}
+	} else {
+		entry.Timings.Wait = harMillis(time.Since(started))
+	}
+	// time 是各阶段耗时之和，ssl 包含在 connect 中
+	for _, t := range []float64{entry.Timings.DNS, entry.Timings.Connect, entry.Timings.Send,
+		entry.Timings.Wait, entry.Timings.Receive} {
+		if t > 0 {
+			entry.Time += t
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.pageIDs[pageID] {
+		h.pageIDs[pageID] = true
+		h.pages = append(h.pages, HarPage{
+			StartedDateTime: started,
+			ID:              pageID,
+			Title:           fmt.Sprintf("HTTP_%d: %s", tc.ID, tc.Description),
+			PageTimings:     map[string]int{},
+		})
+	}
+	h.entries = append(h.entries, entry)
+}
+
+func (h *HarRecorder) harRequest(req *resty.Request) HarRequest {
+	result := HarRequest{
+		Method:      strings.ToUpper(req.Method),
+		URL:         req.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HarNameValue{},
+		QueryString: []HarNameValue{},
+		HeadersSize: -1,
+	}
+	header := req.Header
+	if req.RawRequest != nil {
+		result.URL = req.RawRequest.URL.String()
+		result.HTTPVersion = req.RawRequest.Proto
+		header = req.RawRequest.Header
+	}
+	result.Headers = h.harHeaders(header)
+	if u, err := url.Parse(result.URL); err == nil {
+		result.QueryString = harNameValues(u.Query())
+	}
+	if body, ok := req.Body.(string); ok && len(body) > 0 {
+		result.PostData = &HarPostData{MimeType: header.Get("Content-Type"), Text: body}
+		result.BodySize = len(body)
+	}
+	return result
+}
+
+func (h *HarRecorder) harResponse(resp *resty.Response) HarResponse {
+	result := HarResponse{
+		Cookies:     []HarNameValue{},
+		Headers:     []HarNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if resp == nil || resp.RawResponse == nil {
+		return result
+	}
+	body := resp.Body()
+	result.Status = resp.StatusCode()
+	result.StatusText = http.StatusText(resp.StatusCode())
+	result.HTTPVersion = resp.RawResponse.Proto
+	result.Headers = h.harHeaders(resp.Header())
+	result.RedirectURL = resp.Header().Get("Location")
+	result.BodySize = len(body)
+	result.Content = HarContent{Size: len(body), MimeType: resp.Header().Get("Content-Type"), Text: string(body)}
+	return result
+}
+
+// harHeaders 按名称排序，敏感的 header 被隐藏
+func (h *HarRecorder) harHeaders(header http.Header) []HarNameValue {
+	result := []HarNameValue{}
+	for _, item := range harNameValues(header) {
+		if h.redact[strings.ToLower(item.Name)] {
+			item.Value = HarRedacted
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func harNameValues(values map[string][]string) []HarNameValue {
+	result := []HarNameValue{}
+	for name, list := range values {
+		for _, value := range list {
+			result = append(result, HarNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// harCreatorVersion 构建时的模块版本
+func harCreatorVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && len(info.Main.Version) > 0 {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+func harMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Log 已记录的请求，entry 按开始时间排序，敏感变量的值被隐藏
+func (h *HarRecorder) Log() HarLog {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	log := HarLog{
+		Version: "1.2",
+		Creator: HarCreator{Name: "autotest", Version: harCreatorVersion()},
+		Pages:   make([]HarPage, 0, len(h.pages)),
+		Entries: make([]HarEntry, 0, len(h.entries)),
+	}
+	for _, page := range h.pages {
+		page.Title = h.masker.Mask(page.Title)
+		log.Pages = append(log.Pages, page)
+	}
+	for _, entry := range h.entries {
+		log.Entries = append(log.Entries, h.maskEntry(entry))
+	}
+	sort.SliceStable(log.Entries, func(i, j int) bool {
+		return log.Entries[i].StartedDateTime.Before(log.Entries[j].StartedDateTime)
+	})
+	return log
+}
+
+// maskEntry 隐藏 entry 中敏感变量的值，记录请求时后续用例导出的变量还不知道，因此在生成时隐藏
+func (h *HarRecorder) maskEntry(entry HarEntry) HarEntry {
+	if !h.masker.Enabled() {
+		return entry
+	}
+	maskNameValues := func(list []HarNameValue) []HarNameValue {
+		result := make([]HarNameValue, 0, len(list))
+		for _, item := range list {
+			result = append(result, HarNameValue{Name: item.Name, Value: h.masker.Mask(item.Value)})
+		}
+		return result
+	}
+	entry.Request.URL = h.masker.Mask(entry.Request.URL)
+	entry.Request.Headers = maskNameValues(entry.Request.Headers)
+	entry.Request.QueryString = maskNameValues(entry.Request.QueryString)
+	if entry.Request.PostData != nil {
+		postData := *entry.Request.PostData
+		postData.Text = h.masker.Mask(postData.Text)
+		entry.Request.PostData = &postData
+	}
+	entry.Response.Headers = maskNameValues(entry.Response.Headers)
+	entry.Response.RedirectURL = h.masker.Mask(entry.Response.RedirectURL)
+	entry.Response.Content.Text = h.masker.Mask(entry.Response.Content.Text)
+	entry.Error = h.masker.Mask(entry.Error)
+	return entry
+}
+
+// generateHarReport 把本次运行的 HTTP 请求写入 report.har
+func (rg *ReportGenerator) generateHarReport() error {
+	if rg.har == nil {
+		return nil
+	}
+	content, err := json.MarshalIndent(map[string]HarLog{"log": rg.har.Log()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal HAR: %w", err)
+	}
+	filePath := filepath.Join(rg.config.Global.Report.DirPath, HarFile)
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+
+	slog.Info("HAR file generated: %s", filePath)
+	return nil
+}
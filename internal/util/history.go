@@ -0,0 +1,340 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 历史记录文件和趋势页面，位于 report.dir_path 下，被所有运行共享
+const (
+	HistoryFile = "history.jsonl"
+	TrendFile   = "trend.html"
+)
+
+// HistoryRecord 一次运行中一个用例的结果，每行一条
+type HistoryRecord struct {
+	// 运行的报告目录名，例如 autotest_1718000000
+	RunID       string        `json:"run_id"`
+	RunTime     time.Time     `json:"run_time"`
+	Protocol    string        `json:"protocol"`
+	File        string        `json:"file"`
+	ID          uint64        `json:"id"`
+	Description string        `json:"description"`
+	Status      string        `json:"status"`
+	Duration    time.Duration `json:"duration"`
+	ErrorMsg    string        `json:"error_message,omitempty"`
+}
+
+// CaseKey 用例在多次运行间的标识
+func (r HistoryRecord) CaseKey() string {
+	return CaseKey(r.Protocol, r.File, r.ID)
+}
+
+// CaseKey 由协议、报告中记录的规则文件路径（相对于配置文件所在的目录）和用例ID组成，
+// 历史趋势和 autotest diff 都用它对应多次运行中的用例
+func CaseKey(protocol, file string, id uint64) string {
+	return fmt.Sprintf("%v:%v:%v", protocol, filepath.ToSlash(file), id)
+}
+
+// AppendHistory 把本次运行的用例结果追加到历史记录文件，被取消的用例不记录
+func AppendHistory(filePath string, runID string, data ReportData) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, tc := range data.TestCases {
+		if tc.Status == StatusCancelled {
+			continue
+		}
+		record := HistoryRecord{
+			RunID:       runID,
+			RunTime:     data.Summary.StartTime,
+			Protocol:    tc.Protocol,
+			File:        tc.File,
+			ID:          tc.ID,
+			Description: tc.Description,
+			Status:      tc.Status,
+			Duration:    tc.Duration,
+			ErrorMsg:    tc.ErrorMsg,
+		}
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write history record: %w", err)
+		}
+	}
+	return writer.Flush()
+}
+
+// LoadHistory 读取历史记录，文件不存在时返回空列表
+func LoadHistory(filePath string) ([]HistoryRecord, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []HistoryRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var record HistoryRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("%v:%v, %w", filePath, lineNo, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// TrendPoint 用例在一次运行中的结果
+type TrendPoint struct {
+	RunID    string
+	RunTime  time.Time
+	Status   string
+	Duration time.Duration
+}
+
+// CaseTrend 用例在最近若干次运行中的趋势
+type CaseTrend struct {
+	Key         string
+	Protocol    string
+	File        string
+	ID          uint64
+	Description string
+	Points      []TrendPoint
+	// 通过、失败（含不稳定）的次数，跳过的运行不计入通过率
+	Passed int
+	Failed int
+	// 当前连续失败开始的时间，最近一次执行通过时为零值
+	FirstFailure time.Time
+	LastError    string
+}
+
+// PassRate 通过率（百分比）
+func (t CaseTrend) PassRate() float64 {
+	if t.Passed+t.Failed == 0 {
+		return 0
+	}
+	return float64(t.Passed) / float64(t.Passed+t.Failed) * 100
+}
+
+// LastStatus 最近一次运行的状态
+func (t CaseTrend) LastStatus() string {
+	if len(t.Points) == 0 {
+		return ""
+	}
+	return t.Points[len(t.Points)-1].Status
+}
+
+// AvgDuration 执行过的运行的平均耗时
+func (t CaseTrend) AvgDuration() time.Duration {
+	var total time.Duration
+	count := 0
+	for _, p := range t.Points {
+		if p.Status == StatusSkipped {
+			continue
+		}
+		total += p.Duration
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+// Sparkline 耗时趋势的SVG折线坐标，宽 width 高 height
+func (t CaseTrend) Sparkline(width, height int) string {
+	if len(t.Points) == 0 {
+		return ""
+	}
+	var maxDuration time.Duration
+	for _, p := range t.Points {
+		maxDuration = max(maxDuration, p.Duration)
+	}
+	var builder strings.Builder
+	for i, p := range t.Points {
+		x := 0.0
+		if len(t.Points) > 1 {
+			x = float64(i) * float64(width) / float64(len(t.Points)-1)
+		}
+		y := float64(height)
+		if maxDuration > 0 {
+			y = float64(height) - float64(p.Duration)/float64(maxDuration)*float64(height)
+		}
+		if i > 0 {
+			builder.WriteString(" ")
+		}
+		fmt.Fprintf(&builder, "%.1f,%.1f", x, y)
+	}
+	return builder.String()
+}
+
+// BuildTrends 按用例汇总最近 lastRuns 次运行的结果，lastRuns <= 0 时使用全部运行
+func BuildTrends(records []HistoryRecord, lastRuns int) []CaseTrend {
+	// 运行按时间排序
+	runTimes := make(map[string]time.Time)
+	for _, r := range records {
+		runTimes[r.RunID] = r.RunTime
+	}
+	runs := make([]string, 0, len(runTimes))
+	for runID := range runTimes {
+		runs = append(runs, runID)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runTimes[runs[i]].Equal(runTimes[runs[j]]) {
+			return runs[i] < runs[j]
+		}
+		return runTimes[runs[i]].Before(runTimes[runs[j]])
+	})
+	if lastRuns > 0 && len(runs) > lastRuns {
+		runs = runs[len(runs)-lastRuns:]
+	}
+	selected := make(map[string]int, len(runs))
+	for idx, runID := range runs {
+		selected[runID] = idx
+	}
+
+	trends := make(map[string]*CaseTrend)
+	sorted := make([]HistoryRecord, 0, len(records))
+	for _, r := range records {
+		if _, ok := selected[r.RunID]; ok {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return selected[sorted[i].RunID] < selected[sorted[j].RunID]
+	})
+
+	for _, r := range sorted {
+		key := r.CaseKey()
+		trend, ok := trends[key]
+		if !ok {
+			trend = &CaseTrend{Key: key, Protocol: r.Protocol, File: r.File, ID: r.ID}
+			trends[key] = trend
+		}
+		trend.Description = r.Description
+		trend.Points = append(trend.Points, TrendPoint{RunID: r.RunID, RunTime: r.RunTime,
+			Status: r.Status, Duration: r.Duration})
+		switch r.Status {
+		case StatusPassed:
+			trend.Passed++
+			trend.FirstFailure = time.Time{}
+			trend.LastError = ""
+		case StatusFailed, StatusFlaky:
+			trend.Failed++
+			if trend.FirstFailure.IsZero() {
+				trend.FirstFailure = r.RunTime
+			}
+			trend.LastError = r.ErrorMsg
+		}
+	}
+
+	result := make([]CaseTrend, 0, len(trends))
+	for _, trend := range trends {
+		result = append(result, *trend)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Protocol != result[j].Protocol {
+			return result[i].Protocol < result[j].Protocol
+		}
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// GenerateTrendHTML 生成趋势页面
+func GenerateTrendHTML(filePath string, trends []CaseTrend) error {
+	tmpl, err := template.New("trend").Funcs(template.FuncMap{
+		"base": filepath.Base,
+	}).Parse(trendHTMLTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse trend template: %w", err)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create trend file: %w", err)
+	}
+	defer file.Close()
+
+	if err := tmpl.Execute(file, trends); err != nil {
+		return fmt.Errorf("failed to execute trend template: %w", err)
+	}
+	return nil
+}
+
+// 趋势页面模板
+const trendHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <title>AutoTest Trend</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; }
+        table { border-collapse: collapse; width: 100%; }
+        th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
+        th { background-color: #f2f2f2; }
+        .run { display: inline-block; width: 10px; height: 10px; margin-right: 2px; }
+        .run-passed { background-color: #28a745; }
+        .run-failed { background-color: #dc3545; }
+        .run-flaky { background-color: #fd7e14; }
+        .run-skipped { background-color: #ffc107; }
+        .fail { color: red; }
+    </style>
+</head>
+<body>
+    <h1>AutoTest Trend</h1>
+    <table>
+        <thead>
+            <tr>
+                <th>Protocol</th>
+                <th>File</th>
+                <th>ID</th>
+                <th>Description</th>
+                <th>Pass Rate</th>
+                <th>Runs</th>
+                <th>Latency</th>
+                <th>Avg Duration</th>
+                <th>First Failure</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{range .}}
+            <tr>
+                <td>{{.Protocol}}</td>
+                <td>{{base .File}}</td>
+                <td>{{.ID}}</td>
+                <td>{{.Description}}</td>
+                <td>{{printf "%.2f" .PassRate}}%</td>
+                <td>{{range .Points}}<span class="run run-{{.Status}}" title="{{.RunID}} {{.RunTime.Format "2006-01-02 15:04:05"}} {{.Status}} {{.Duration}}"></span>{{end}}</td>
+                <td><svg width="120" height="24"><polyline fill="none" stroke="#007bff" stroke-width="1.5" points="{{.Sparkline 120 24}}"/></svg></td>
+                <td>{{.AvgDuration}}</td>
+                <td>{{if not .FirstFailure.IsZero}}<span class="fail" title="{{.LastError}}">{{.FirstFailure.Format "2006-01-02 15:04:05"}}</span>{{else}}-{{end}}</td>
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+</body>
+</html>`
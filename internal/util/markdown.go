@@ -0,0 +1,115 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	slog "github.com/vearne/simplelog"
+)
+
+// EscapeMarkdownCell 转义 Markdown 表格单元格中的竖线和换行
+func EscapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// CaseTitle 用例的标题，例如 "HTTP_1: get book"
+func CaseTitle(tc TestCaseResult) string {
+	return fmt.Sprintf("%v_%v: %v", strings.ToUpper(tc.Protocol), tc.ID, tc.Description)
+}
+
+// generateMarkdownReport 生成 Markdown 报告，可以直接作为 PR 评论或 CI 的 job summary
+func (rg *ReportGenerator) generateMarkdownReport(data ReportData) error {
+	filePath := filepath.Join(rg.config.Global.Report.DirPath, "report.md")
+	content := markdownReport(data, rg.config.Global.Report.DirPath)
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write Markdown report: %w", err)
+	}
+
+	slog.Info("Markdown report generated: %s", filePath)
+	return nil
+}
+
+// markdownReport 汇总表、按规则文件的统计，以及每个失败用例的期望值和实际值
+func markdownReport(data ReportData, reportDir string) string {
+	var b strings.Builder
+	summary := data.Summary
+	result := TestResult{FailedTests: summary.FailedTests, CancelledTests: summary.CancelledTests,
+		FlakyTests: summary.FlakyTests}
+	fmt.Fprintf(&b, "## AutoTest Report - %v\n\n", labelsEn.Statuses[result.Status()])
+
+	b.WriteString("| Total | Passed | Failed | Skipped | Flaky | Cancelled | Pass Rate | Duration |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- |\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %d | %.2f%% | %v |\n\n", summary.TotalTests, summary.PassedTests,
+		summary.FailedTests, summary.SkippedTests, summary.FlakyTests, summary.CancelledTests, summary.PassRate,
+		summary.Duration.Round(time.Millisecond))
+
+	groups := newHTMLReport(data, reportDir).Groups
+	if len(groups) > 0 {
+		b.WriteString("| Protocol | File | Total | Passed | Failed | Skipped |\n")
+		b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+		for _, group := range groups {
+			fmt.Fprintf(&b, "| %v | %v | %d | %d | %d | %d |\n", group.Protocol, EscapeMarkdownCell(group.File),
+				group.Total, group.Passed, group.Failed, group.Skipped)
+		}
+		b.WriteString("\n")
+	}
+
+	var failures []TestCaseResult
+	for _, tc := range data.TestCases {
+		if tc.Status == StatusFailed || tc.Status == StatusFlaky {
+			failures = append(failures, tc)
+		}
+	}
+	if len(failures) <= 0 {
+		return b.String()
+	}
+
+	b.WriteString("### Failures\n")
+	for _, tc := range failures {
+		icon := "❌"
+		if tc.Status == StatusFlaky {
+			icon = "⚠️"
+		}
+		fmt.Fprintf(&b, "\n#### %v %v\n\n", icon, CaseTitle(tc))
+		location := tc.File
+		if tc.Line > 0 {
+			location = fmt.Sprintf("%v:%d", tc.File, tc.Line)
+		}
+		fmt.Fprintf(&b, "- **File**: `%v`\n", location)
+		fmt.Fprintf(&b, "- **Status**: %v\n", tc.Status)
+		if len(tc.Reason) > 0 {
+			fmt.Fprintf(&b, "- **Reason**: %v\n", tc.Reason)
+		}
+		if len(tc.ErrorMsg) > 0 && tc.ErrorMsg != tc.Reason {
+			fmt.Fprintf(&b, "- **Error**: %v\n", strings.ReplaceAll(tc.ErrorMsg, "\n", " "))
+		}
+		if tc.Runs > 0 {
+			fmt.Fprintf(&b, "- **Runs**: %d of %d passed\n", tc.PassedRuns, tc.Runs)
+		}
+		if tc.Quarantined {
+			b.WriteString("- **Quarantined**: the failure does not fail the run\n")
+		}
+		if tc.Mismatch != nil {
+			b.WriteString("\n| Rule | Expression | Expected | Actual |\n")
+			b.WriteString("| --- | --- | --- | --- |\n")
+			fmt.Fprintf(&b, "| %v | %v | %v | %v |\n", tc.Mismatch.Rule, markdownCode(tc.Mismatch.Expression),
+				markdownCode(tc.Mismatch.Expected), markdownCode(tc.Mismatch.Actual))
+		}
+		if len(tc.Repro) > 0 {
+			fmt.Fprintf(&b, "\n```sh\n%v\n```\n", tc.Repro)
+		}
+	}
+	return b.String()
+}
+
+// markdownCode 表格单元格中的代码，空值不输出
+func markdownCode(s string) string {
+	if len(s) <= 0 {
+		return ""
+	}
+	return "`" + EscapeMarkdownCell(s) + "`"
+}
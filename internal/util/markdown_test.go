@@ -0,0 +1,56 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/rule"
+)
+
+func newTextReportData() ReportData {
+	var data ReportData
+	data.Summary.TotalTests = 4
+	data.Summary.PassedTests = 1
+	data.Summary.FailedTests = 1
+	data.Summary.SkippedTests = 1
+	data.Summary.FlakyTests = 1
+	data.Summary.PassRate = 25
+	data.Summary.Duration = 1234567 * time.Microsecond
+	data.TestCases = []TestCaseResult{
+		{ID: 1, Description: "get book", Protocol: "http", File: "/rules/book.yml", Status: StatusPassed},
+		{ID: 2, Description: "add book #2", Protocol: "http", File: "/rules/book.yml", Line: 12, Status: StatusFailed,
+			Reason: "ReasonRuleVerifyFailed", ErrorMsg: "ReasonRuleVerifyFailed", Duration: 15 * time.Millisecond,
+			Mismatch: &rule.Mismatch{Rule: "HttpBodyEqualRule", Expression: "jsonpath: $.title", Expected: "Go", Actual: "Rust | C"},
+			Repro:    "curl \\\n  http://localhost/books/2"},
+		{ID: 1, Description: "say hello", Protocol: "grpc", File: "/rules/hello.yml", Status: StatusSkipped,
+			Reason: "ReasonSkipConditionMet"},
+		{ID: 2, Description: "list", Protocol: "grpc", File: "/rules/hello.yml", Status: StatusFlaky,
+			Reason: "ReasonFlaky", ErrorMsg: "passed 1 of 2 runs", Runs: 2, PassedRuns: 1, Quarantined: true},
+	}
+	return data
+}
+
+func TestGenerateMarkdownReport(t *testing.T) {
+	var cfg config.AutoTestConfig
+	cfg.Global.Report.DirPath = t.TempDir()
+	cfg.Global.Report.Formats = []string{"markdown"}
+	assert.NoError(t, NewReportGenerator(cfg).GenerateReports(newTextReportData()))
+
+	b, err := os.ReadFile(filepath.Join(cfg.Global.Report.DirPath, "report.md"))
+	assert.NoError(t, err)
+	md := string(b)
+	assert.True(t, strings.HasPrefix(md, "## AutoTest Report - ❌ Failed\n"))
+	assert.Contains(t, md, "| 4 | 1 | 1 | 1 | 1 | 0 | 25.00% | 1.235s |")
+	assert.Contains(t, md, "| http | /rules/book.yml | 2 | 1 | 1 | 0 |")
+	assert.Contains(t, md, "#### ❌ HTTP_2: add book #2\n\n- **File**: `/rules/book.yml:12`\n")
+	assert.Contains(t, md, "| HttpBodyEqualRule | `jsonpath: $.title` | `Go` | `Rust \\| C` |")
+	assert.Contains(t, md, "| `Rust \\| C` |\n\n```sh\ncurl \\\n  http://localhost/books/2\n```\n")
+	assert.Contains(t, md, "#### ⚠️ GRPC_2: list\n")
+	assert.Contains(t, md, "- **Error**: passed 1 of 2 runs\n- **Runs**: 1 of 2 passed\n- **Quarantined**")
+	assert.NotContains(t, md, "get book")
+}
@@ -3,8 +3,11 @@ package util
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/vearne/autotest/internal/config"
@@ -19,34 +22,54 @@ type NotificationService struct {
 
 // TestResult 测试结果
 type TestResult struct {
-	TotalTests  int           `json:"total_tests"`
-	PassedTests int           `json:"passed_tests"`
-	FailedTests int           `json:"failed_tests"`
+	TotalTests   int `json:"total_tests"`
+	PassedTests  int `json:"passed_tests"`
+	FailedTests  int `json:"failed_tests"`
+	SkippedTests int `json:"skipped_tests"`
+	// 因 SIGINT/SIGTERM 被取消的用例数
+	CancelledTests int `json:"cancelled_tests,omitempty"`
+	// 多次运行时只有部分通过的用例数
+	FlakyTests  int           `json:"flaky_tests,omitempty"`
 	Duration    time.Duration `json:"duration"`
 	StartTime   time.Time     `json:"start_time"`
 	EndTime     time.Time     `json:"end_time"`
 	FailedCases []string      `json:"failed_cases,omitempty"`
 }
 
-// SlackMessage Slack消息格式
-type SlackMessage struct {
-	Text        string       `json:"text"`
-	Attachments []Attachment `json:"attachments,omitempty"`
-}
+// 运行结果的状态
+const (
+	NotifyStatusSuccess   = "success"
+	NotifyStatusFailed    = "failed"
+	NotifyStatusCancelled = "cancelled"
+	NotifyStatusFlaky     = "flaky"
+)
 
-// Attachment Slack附件
-type Attachment struct {
-	Color  string  `json:"color"`
-	Title  string  `json:"title"`
-	Fields []Field `json:"fields"`
+// Status 运行结果的状态，依次为失败、取消、不稳定、成功
+func (r TestResult) Status() string {
+	switch {
+	case r.FailedTests > 0:
+		return NotifyStatusFailed
+	case r.CancelledTests > 0:
+		return NotifyStatusCancelled
+	case r.FlakyTests > 0:
+		return NotifyStatusFlaky
+	}
+	return NotifyStatusSuccess
 }
 
-// Field Slack字段
-type Field struct {
-	Title string `json:"title"`
-	Value string `json:"value"`
-	Short bool   `json:"short"`
-}
+// 通知渠道的类型
+const (
+	NotifierSlack    = "slack"
+	NotifierDingTalk = "dingtalk"
+	NotifierFeishu   = "feishu"
+	NotifierWeCom    = "wecom"
+	NotifierTeams    = "teams"
+	NotifierWebhook  = "webhook"
+	NotifierEmail    = "email"
+)
+
+// NotifierTypes 支持的通知渠道类型
+var NotifierTypes = []string{NotifierSlack, NotifierDingTalk, NotifierFeishu, NotifierWeCom, NotifierTeams, NotifierWebhook, NotifierEmail}
 
 // NewNotificationService 创建通知服务
 func NewNotificationService(cfg config.AutoTestConfig) *NotificationService {
@@ -58,122 +81,85 @@ func NewNotificationService(cfg config.AutoTestConfig) *NotificationService {
 	}
 }
 
-// SendTestResult 发送测试结果通知
+// SendTestResult 发送测试结果通知，每个渠道按自己的 on_success/on_failure 过滤，
+// 某个渠道发送失败不影响其他渠道
 func (ns *NotificationService) SendTestResult(result TestResult) error {
 	if !ns.config.Global.Notifications.Enabled {
 		return nil
 	}
 
-	isSuccess := result.FailedTests == 0
-
-	// 检查是否需要发送通知
-	if isSuccess && !ns.config.Global.Notifications.OnSuccess {
-		return nil
-	}
-	if !isSuccess && !ns.config.Global.Notifications.OnFailure {
-		return nil
-	}
-
-	return ns.sendSlackNotification(result)
-}
-
-// sendSlackNotification 发送Slack通知
-func (ns *NotificationService) sendSlackNotification(result TestResult) error {
-	if ns.config.Global.Notifications.WebhookURL == "" {
+	channels := ns.channels()
+	if len(channels) == 0 {
 		slog.Warn("Webhook URL not configured, skipping notification")
 		return nil
 	}
 
-	isSuccess := result.FailedTests == 0
-	color := "good" // 绿色
-	status := "✅ 成功"
-
-	if !isSuccess {
-		color = "danger" // 红色
-		status = "❌ 失败"
-	}
-
-	message := SlackMessage{
-		Text: fmt.Sprintf("AutoTest 执行完成 - %s", status),
-		Attachments: []Attachment{
-			{
-				Color: color,
-				Title: "测试结果详情",
-				Fields: []Field{
-					{
-						Title: "总测试数",
-						Value: fmt.Sprintf("%d", result.TotalTests),
-						Short: true,
-					},
-					{
-						Title: "通过数",
-						Value: fmt.Sprintf("%d", result.PassedTests),
-						Short: true,
-					},
-					{
-						Title: "失败数",
-						Value: fmt.Sprintf("%d", result.FailedTests),
-						Short: true,
-					},
-					{
-						Title: "执行时间",
-						Value: result.Duration.String(),
-						Short: true,
-					},
-					{
-						Title: "开始时间",
-						Value: result.StartTime.Format("2006-01-02 15:04:05"),
-						Short: true,
-					},
-					{
-						Title: "结束时间",
-						Value: result.EndTime.Format("2006-01-02 15:04:05"),
-						Short: true,
-					},
-				},
-			},
-		},
-	}
+	isSuccess := result.Status() == NotifyStatusSuccess
+	var errs []error
+	for idx, ch := range channels {
+		// 检查是否需要发送通知
+		if isSuccess && !ns.enabled(ch.OnSuccess, ns.config.Global.Notifications.OnSuccess) {
+			continue
+		}
+		if !isSuccess && !ns.enabled(ch.OnFailure, ns.config.Global.Notifications.OnFailure) {
+			continue
+		}
 
-	// 如果有失败的测试用例，添加失败详情
-	if len(result.FailedCases) > 0 {
-		failedCasesText := ""
-		for i, failedCase := range result.FailedCases {
-			if i > 0 {
-				failedCasesText += "\n"
-			}
-			failedCasesText += fmt.Sprintf("• %s", failedCase)
-
-			// 限制显示的失败用例数量
-			if i >= 9 {
-				failedCasesText += fmt.Sprintf("\n... 还有 %d 个失败用例", len(result.FailedCases)-10)
-				break
-			}
+		name := ch.Name
+		if len(name) <= 0 {
+			name = fmt.Sprintf("%v#%d", ch.Type, idx)
+		}
+		err := ns.send(ch, newNotification(result, ch.Locale))
+		if err != nil {
+			slog.Error("Failed to send notification, channel:%v, error:%v", name, err)
+			errs = append(errs, fmt.Errorf("channel %v: %w", name, err))
+			continue
 		}
+		slog.Info("Notification sent successfully, channel:%v", name)
+	}
+	return errors.Join(errs...)
+}
 
-		message.Attachments[0].Fields = append(message.Attachments[0].Fields, Field{
-			Title: "失败用例",
-			Value: failedCasesText,
-			Short: false,
+// channels 配置的通知渠道，webhook_url 作为一个 slack 渠道
+func (ns *NotificationService) channels() []config.NotifierChannel {
+	notifications := ns.config.Global.Notifications
+	var channels []config.NotifierChannel
+	if len(notifications.WebhookURL) > 0 {
+		channels = append(channels, config.NotifierChannel{
+			Name:       NotifierSlack,
+			Type:       NotifierSlack,
+			WebhookURL: notifications.WebhookURL,
 		})
 	}
+	return append(channels, notifications.Channels...)
+}
 
-	return ns.sendWebhook(message)
+func (ns *NotificationService) enabled(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
 }
 
-// sendWebhook 发送Webhook请求
-func (ns *NotificationService) sendWebhook(message SlackMessage) error {
-	jsonData, err := json.Marshal(message)
+// send 按渠道类型构造请求并发送
+func (ns *NotificationService) send(ch config.NotifierChannel, n notification) error {
+	if ch.Type == NotifierEmail {
+		return ns.sendEmail(ch, n)
+	}
+
+	webhookURL, body, err := buildNotifierRequest(ch, n, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to marshal notification message: %w", err)
+		return err
 	}
 
-	req, err := http.NewRequest("POST", ns.config.Global.Notifications.WebhookURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("failed to create webhook request: %w", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
+	for key, value := range ch.Headers {
+		req.Header.Set(key, value)
+	}
 
 	resp, err := ns.client.Do(req)
 	if err != nil {
@@ -181,10 +167,163 @@ func (ns *NotificationService) sendWebhook(message SlackMessage) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
 	}
+	return checkNotifierResponse(respBody)
+}
 
-	slog.Info("Notification sent successfully")
+// checkNotifierResponse 钉钉、飞书和企业微信在 HTTP 200 的响应中用错误码表示失败
+func checkNotifierResponse(body []byte) error {
+	var resp struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+	if resp.ErrCode != nil && *resp.ErrCode != 0 {
+		return fmt.Errorf("webhook returned errcode:%d, errmsg:%v", *resp.ErrCode, resp.ErrMsg)
+	}
+	if resp.Code != nil && *resp.Code != 0 {
+		return fmt.Errorf("webhook returned code:%d, msg:%v", *resp.Code, resp.Msg)
+	}
 	return nil
 }
+
+// notificationLabels 通知中的文字
+type notificationLabels struct {
+	Title       string
+	Details     string
+	Total       string
+	Passed      string
+	Failed      string
+	Skipped     string
+	Cancelled   string
+	Flaky       string
+	Duration    string
+	StartTime   string
+	EndTime     string
+	FailedCases string
+	// 失败用例过多时的提示，参数为未显示的数量
+	MoreFailedCases string
+	Statuses        map[string]string
+}
+
+var labelsZh = notificationLabels{
+	Title:           "AutoTest 执行完成",
+	Details:         "测试结果详情",
+	Total:           "总测试数",
+	Passed:          "通过数",
+	Failed:          "失败数",
+	Skipped:         "跳过数",
+	Cancelled:       "取消数",
+	Flaky:           "不稳定数",
+	Duration:        "执行时间",
+	StartTime:       "开始时间",
+	EndTime:         "结束时间",
+	FailedCases:     "失败用例",
+	MoreFailedCases: "... 还有 %d 个失败用例",
+	Statuses: map[string]string{
+		NotifyStatusSuccess:   "✅ 成功",
+		NotifyStatusFailed:    "❌ 失败",
+		NotifyStatusCancelled: "⚠️ 已取消",
+		NotifyStatusFlaky:     "⚠️ 不稳定",
+	},
+}
+
+var labelsEn = notificationLabels{
+	Title:           "AutoTest finished",
+	Details:         "Test result details",
+	Total:           "Total",
+	Passed:          "Passed",
+	Failed:          "Failed",
+	Skipped:         "Skipped",
+	Cancelled:       "Cancelled",
+	Flaky:           "Flaky",
+	Duration:        "Duration",
+	StartTime:       "Start time",
+	EndTime:         "End time",
+	FailedCases:     "Failed cases",
+	MoreFailedCases: "... and %d more failed cases",
+	Statuses: map[string]string{
+		NotifyStatusSuccess:   "✅ Passed",
+		NotifyStatusFailed:    "❌ Failed",
+		NotifyStatusCancelled: "⚠️ Cancelled",
+		NotifyStatusFlaky:     "⚠️ Flaky",
+	},
+}
+
+// ValidLocale 检查 locale 是否支持，空值使用中文
+func ValidLocale(locale string) bool {
+	locale = strings.ToLower(locale)
+	return locale == "" || strings.HasPrefix(locale, "zh") || strings.HasPrefix(locale, "en")
+}
+
+func labelsOf(locale string) notificationLabels {
+	if strings.HasPrefix(strings.ToLower(locale), "en") {
+		return labelsEn
+	}
+	return labelsZh
+}
+
+// notification 与渠道无关的通知内容，也是 webhook 模板的数据
+type notification struct {
+	Result TestResult
+	// success | failed | cancelled | flaky
+	Status string
+	// 带状态的标题，例如 "AutoTest 执行完成 - ✅ 成功"
+	Title   string
+	Details string
+	Fields  []Field
+	// 最多10个失败用例，每行一个
+	FailedCasesTitle string
+	FailedCases      []string
+}
+
+// Field 通知中的一项
+type Field struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func newNotification(result TestResult, locale string) notification {
+	labels := labelsOf(locale)
+	status := result.Status()
+	n := notification{
+		Result:           result,
+		Status:           status,
+		Title:            fmt.Sprintf("%s - %s", labels.Title, labels.Statuses[status]),
+		Details:          labels.Details,
+		FailedCasesTitle: labels.FailedCases,
+		Fields: []Field{
+			{Title: labels.Total, Value: fmt.Sprintf("%d", result.TotalTests), Short: true},
+			{Title: labels.Passed, Value: fmt.Sprintf("%d", result.PassedTests), Short: true},
+			{Title: labels.Failed, Value: fmt.Sprintf("%d", result.FailedTests), Short: true},
+			{Title: labels.Skipped, Value: fmt.Sprintf("%d", result.SkippedTests), Short: true},
+			{Title: labels.Duration, Value: result.Duration.String(), Short: true},
+			{Title: labels.StartTime, Value: result.StartTime.Format("2006-01-02 15:04:05"), Short: true},
+			{Title: labels.EndTime, Value: result.EndTime.Format("2006-01-02 15:04:05"), Short: true},
+		},
+	}
+	if result.CancelledTests > 0 {
+		n.Fields = append(n.Fields, Field{Title: labels.Cancelled, Value: fmt.Sprintf("%d", result.CancelledTests), Short: true})
+	}
+	if result.FlakyTests > 0 {
+		n.Fields = append(n.Fields, Field{Title: labels.Flaky, Value: fmt.Sprintf("%d", result.FlakyTests), Short: true})
+	}
+
+	// 限制显示的失败用例数量
+	for i, failedCase := range result.FailedCases {
+		if i >= 10 {
+			n.FailedCases = append(n.FailedCases, fmt.Sprintf(labels.MoreFailedCases, len(result.FailedCases)-10))
+			break
+		}
+		n.FailedCases = append(n.FailedCases, "• "+failedCase)
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vearne/autotest/internal/config"
+)
+
+// SlackMessage Slack消息格式
+type SlackMessage struct {
+	Text        string       `json:"text"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment Slack附件
+type Attachment struct {
+	Color  string  `json:"color"`
+	Title  string  `json:"title"`
+	Fields []Field `json:"fields"`
+}
+
+// buildNotifierRequest 按渠道类型构造请求地址和请求体
+func buildNotifierRequest(ch config.NotifierChannel, n notification, now time.Time) (string, []byte, error) {
+	var payload any
+	webhookURL := ch.WebhookURL
+	switch ch.Type {
+	case NotifierSlack:
+		payload = slackPayload(n)
+	case NotifierDingTalk:
+		payload = map[string]any{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"title": n.Title, "text": markdownText(n)},
+		}
+		if len(ch.Secret) > 0 {
+			webhookURL = dingTalkSignedURL(webhookURL, ch.Secret, now)
+		}
+	case NotifierFeishu:
+		body := map[string]any{
+			"msg_type": "interactive",
+			"card": map[string]any{
+				"header": map[string]any{
+					"title":    map[string]string{"tag": "plain_text", "content": n.Title},
+					"template": statusColor(n.Status, "green", "red", "orange"),
+				},
+				"elements": []any{
+					map[string]any{"tag": "div", "text": map[string]string{"tag": "lark_md", "content": markdownBody(n)}},
+				},
+			},
+		}
+		if len(ch.Secret) > 0 {
+			timestamp, sign := FeishuSign(ch.Secret, now)
+			body["timestamp"] = timestamp
+			body["sign"] = sign
+		}
+		payload = body
+	case NotifierWeCom:
+		payload = map[string]any{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": markdownText(n)},
+		}
+	case NotifierTeams:
+		facts := make([]map[string]string, 0, len(n.Fields))
+		for _, field := range n.Fields {
+			facts = append(facts, map[string]string{"name": field.Title, "value": field.Value})
+		}
+		section := map[string]any{"activityTitle": n.Details, "facts": facts}
+		if len(n.FailedCases) > 0 {
+			section["text"] = fmt.Sprintf("**%s**\n\n%s", n.FailedCasesTitle, strings.Join(n.FailedCases, "\n\n"))
+		}
+		payload = map[string]any{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"themeColor": statusColor(n.Status, "2EB886", "D50000", "FFA000"),
+			"summary":    n.Title,
+			"title":      n.Title,
+			"sections":   []any{section},
+		}
+	case NotifierWebhook:
+		body, err := renderWebhookTemplate(ch.Template, n)
+		return webhookURL, body, err
+	default:
+		return "", nil, fmt.Errorf("unknown notifier type:%v", ch.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal notification message: %w", err)
+	}
+	return webhookURL, body, nil
+}
+
+func slackPayload(n notification) SlackMessage {
+	attachment := Attachment{
+		Color:  statusColor(n.Status, "good", "danger", "warning"),
+		Title:  n.Details,
+		Fields: n.Fields,
+	}
+	if len(n.FailedCases) > 0 {
+		attachment.Fields = append(attachment.Fields, Field{
+			Title: n.FailedCasesTitle,
+			Value: strings.Join(n.FailedCases, "\n"),
+			Short: false,
+		})
+	}
+	return SlackMessage{Text: n.Title, Attachments: []Attachment{attachment}}
+}
+
+// statusColor 成功、失败以及取消或不稳定时使用的颜色
+func statusColor(status string, success, failed, warning string) string {
+	switch status {
+	case NotifyStatusSuccess:
+		return success
+	case NotifyStatusFailed:
+		return failed
+	}
+	return warning
+}
+
+// markdownText 带标题的 markdown 消息
+func markdownText(n notification) string {
+	return fmt.Sprintf("### %s\n%s", n.Title, markdownBody(n))
+}
+
+func markdownBody(n notification) string {
+	var builder strings.Builder
+	for _, field := range n.Fields {
+		fmt.Fprintf(&builder, "- **%s**: %s\n", field.Title, field.Value)
+	}
+	if len(n.FailedCases) > 0 {
+		fmt.Fprintf(&builder, "\n**%s**\n", n.FailedCasesTitle)
+		for _, failedCase := range n.FailedCases {
+			fmt.Fprintf(&builder, "%s\n", failedCase)
+		}
+	}
+	return builder.String()
+}
+
+// ParseWebhookTemplate 解析通用 webhook 的请求体模板，模板中可以使用 json 函数输出 JSON 字符串
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+func renderWebhookTemplate(text string, n notification) ([]byte, error) {
+	tmpl, err := ParseWebhookTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n); err != nil {
+		return nil, fmt.Errorf("failed to execute webhook template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// dingTalkSignedURL 钉钉加签：timestamp（毫秒）+"\n"+secret 以 secret 为密钥做 HmacSHA256
+func dingTalkSignedURL(webhookURL, secret string, now time.Time) string {
+	timestamp := now.UnixMilli()
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d\n%s", timestamp, secret)))
+	sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	sep := "?"
+	if strings.Contains(webhookURL, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%stimestamp=%d&sign=%s", webhookURL, sep, timestamp, sign)
+}
+
+// FeishuSign 飞书签名校验：以 timestamp（秒）+"\n"+secret 为密钥对空数据做 HmacSHA256
+func FeishuSign(secret string, now time.Time) (string, string) {
+	timestamp := fmt.Sprintf("%d", now.Unix())
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return timestamp, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const progressBarWidth = 25
+
+// ProgressBar 进度条
+// 不注册任何信号处理，SIGINT/SIGTERM 由调用方处理，以便中断后仍能生成报告
+type ProgressBar struct {
+	w io.Writer
+}
+
+// NewProgressBar 创建进度条
+func NewProgressBar(w io.Writer) *ProgressBar {
+	return &ProgressBar{w: w}
+}
+
+// Percent 输出当前进度，percent 的取值范围为 0-100
+func (b *ProgressBar) Percent(percent float64) {
+	percent = min(max(percent, 0), 100)
+	passed := int(percent / 100 * progressBarWidth)
+
+	var builder strings.Builder
+	builder.WriteString("[")
+	if passed > 0 {
+		builder.WriteString(strings.Repeat("-", passed-1))
+		builder.WriteString(">")
+	}
+	builder.WriteString(strings.Repeat("=", progressBarWidth-passed))
+	builder.WriteString("]")
+	fmt.Fprintf(b.w, "%v %.0f%%\n", builder.String(), percent)
+}
@@ -2,6 +2,9 @@ package util
 
 import (
 	"context"
+	"net/url"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,8 +22,13 @@ type RateLimiter struct {
 	once   sync.Once
 }
 
-// NewRateLimiter 创建限流器
+// NewRateLimiter 创建限流器，令牌桶初始是满的，允许一秒的突发请求
 func NewRateLimiter(maxConcurrent int, ratePerSecond int) *RateLimiter {
+	return NewRateLimiterWithBurst(maxConcurrent, ratePerSecond, ratePerSecond)
+}
+
+// NewRateLimiterWithBurst 创建限流器，令牌桶初始只有 burst 个令牌，压测时用于保持稳定的速率
+func NewRateLimiterWithBurst(maxConcurrent int, ratePerSecond int, burst int) *RateLimiter {
 	rl := &RateLimiter{
 		semaphore: semaphore.NewWeighted(int64(maxConcurrent)),
 		stopCh:    make(chan struct{}),
@@ -34,7 +42,7 @@ func NewRateLimiter(maxConcurrent int, ratePerSecond int) *RateLimiter {
 		go rl.tokenGenerator()
 
 		// 初始填充令牌桶
-		for i := 0; i < ratePerSecond && i < cap(rl.tokens); i++ {
+		for i := 0; i < burst && i < cap(rl.tokens); i++ {
 			select {
 			case rl.tokens <- struct{}{}:
 			default:
@@ -106,3 +114,86 @@ func (rl *RateLimiter) ExecuteWithLimit(ctx context.Context, fn func() error) er
 
 	return fn()
 }
+
+// TargetRateLimiters 按请求目标选择限流器，目标为HTTP请求的URL或gRPC请求的地址
+// 先按顺序匹配分组的正则表达式，没有匹配时每个host使用独立的限流器
+type TargetRateLimiters struct {
+	groups []targetGroup
+
+	// 每个host的并发数和速率，perHost 为 false 时不按host限流
+	perHost           bool
+	hostMaxConcurrent int
+	hostRatePerSecond int
+
+	mu    sync.Mutex
+	hosts map[string]*RateLimiter
+}
+
+type targetGroup struct {
+	pattern *regexp.Regexp
+	limiter *RateLimiter
+}
+
+// NewTargetRateLimiters 创建按目标选择的限流器，maxConcurrent 和 ratePerSecond 为每个host的限制
+func NewTargetRateLimiters(perHost bool, maxConcurrent int, ratePerSecond int) *TargetRateLimiters {
+	return &TargetRateLimiters{
+		perHost:           perHost,
+		hostMaxConcurrent: maxConcurrent,
+		hostRatePerSecond: ratePerSecond,
+		hosts:             make(map[string]*RateLimiter),
+	}
+}
+
+// AddGroup 添加一个分组，目标匹配 pattern 时使用分组的限流器
+func (t *TargetRateLimiters) AddGroup(pattern *regexp.Regexp, limiter *RateLimiter) {
+	t.groups = append(t.groups, targetGroup{pattern: pattern, limiter: limiter})
+}
+
+// Get 返回目标对应的限流器，没有匹配的分组并且不按host限流时返回nil
+func (t *TargetRateLimiters) Get(target string) *RateLimiter {
+	if t == nil {
+		return nil
+	}
+	for _, group := range t.groups {
+		if group.pattern.MatchString(target) {
+			return group.limiter
+		}
+	}
+	if !t.perHost {
+		return nil
+	}
+
+	host := TargetHost(target)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	limiter, ok := t.hosts[host]
+	if !ok {
+		limiter = NewRateLimiter(t.hostMaxConcurrent, t.hostRatePerSecond)
+		t.hosts[host] = limiter
+	}
+	return limiter
+}
+
+// Stop 停止所有按host创建的限流器
+func (t *TargetRateLimiters) Stop() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, limiter := range t.hosts {
+		limiter.Stop()
+	}
+}
+
+// TargetHost 返回URL中的host，gRPC的地址本身就是host:port
+func TargetHost(target string) string {
+	if !strings.Contains(target, "://") {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil || len(u.Host) <= 0 {
+		return target
+	}
+	return u.Host
+}
@@ -8,40 +8,96 @@ import (
 	"html/template"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/vearne/autotest/internal/config"
+	"github.com/vearne/autotest/internal/rule"
 	slog "github.com/vearne/simplelog"
 )
 
 // ReportGenerator 报告生成器
 type ReportGenerator struct {
 	config config.AutoTestConfig
+	// 报告格式包含 har 时记录用例的 HTTP 请求
+	har *HarRecorder
+}
+
+// 用例状态
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	// 运行被 SIGINT/SIGTERM 中断
+	StatusCancelled = "cancelled"
+	// 多次运行时只有部分通过
+	StatusFlaky = "flaky"
+)
+
+// 用例执行的步骤
+const (
+	StepRender  = "render"
+	StepRequest = "request"
+	StepExport  = "export"
+	StepVerify  = "verify"
+)
+
+// CaseStep 用例执行的一个步骤，重复运行时为最后一次运行的步骤
+type CaseStep struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Error     string    `json:"error,omitempty"`
 }
 
 // TestCaseResult 测试用例结果
 type TestCaseResult struct {
 	ID          uint64        `json:"id"`
 	Description string        `json:"description"`
+	Protocol    string        `json:"protocol"`
+	File        string        `json:"file"`
+	Line        int           `json:"line,omitempty"`
 	Status      string        `json:"status"`
+	Reason      string        `json:"reason,omitempty"`
 	Duration    time.Duration `json:"duration"`
 	ErrorMsg    string        `json:"error_message,omitempty"`
 	StartTime   time.Time     `json:"start_time"`
 	EndTime     time.Time     `json:"end_time"`
+	// 等待限流器的时间，包含在 Duration 中
+	LimiterWait time.Duration `json:"limiter_wait,omitempty"`
+	// 发生重试时每一次尝试的记录
+	Attempts []RetryAttempt `json:"attempts,omitempty"`
+	// 重复运行的次数和通过的次数
+	Runs       int `json:"runs,omitempty"`
+	PassedRuns int `json:"passed_runs,omitempty"`
+	// 已隔离的不稳定用例，失败不影响退出码
+	Quarantined bool       `json:"quarantined,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Steps       []CaseStep `json:"steps,omitempty"`
+	// 校验不通过的规则，以及期望值和实际值
+	Mismatch *rule.Mismatch `json:"mismatch,omitempty"`
+	// 复现请求的命令，HTTP 用例为 curl，gRPC 用例为 grpcurl
+	Repro string `json:"repro,omitempty"`
+	// 请求和响应的详情，不写入 JSON 报告
+	RequestDetail  string `json:"-"`
+	ResponseDetail string `json:"-"`
 }
 
 // ReportData 报告数据
 type ReportData struct {
 	Summary struct {
-		TotalTests   int           `json:"total_tests"`
-		PassedTests  int           `json:"passed_tests"`
-		FailedTests  int           `json:"failed_tests"`
-		SkippedTests int           `json:"skipped_tests"`
-		Duration     time.Duration `json:"duration"`
-		StartTime    time.Time     `json:"start_time"`
-		EndTime      time.Time     `json:"end_time"`
-		PassRate     float64       `json:"pass_rate"`
+		TotalTests     int           `json:"total_tests"`
+		PassedTests    int           `json:"passed_tests"`
+		FailedTests    int           `json:"failed_tests"`
+		SkippedTests   int           `json:"skipped_tests"`
+		CancelledTests int           `json:"cancelled_tests,omitempty"`
+		FlakyTests     int           `json:"flaky_tests,omitempty"`
+		Duration       time.Duration `json:"duration"`
+		StartTime      time.Time     `json:"start_time"`
+		EndTime        time.Time     `json:"end_time"`
+		PassRate       float64       `json:"pass_rate"`
 	} `json:"summary"`
 	TestCases []TestCaseResult `json:"test_cases"`
 }
@@ -90,9 +146,20 @@ type JUnitSkipped struct {
 
 // NewReportGenerator 创建报告生成器
 func NewReportGenerator(cfg config.AutoTestConfig) *ReportGenerator {
-	return &ReportGenerator{
+	rg := &ReportGenerator{
 		config: cfg,
 	}
+	for _, format := range cfg.Global.Report.Formats {
+		if strings.EqualFold(format, "har") {
+			rg.har = NewHarRecorder(cfg.Global.Report.HarRedactHeaders)
+		}
+	}
+	return rg
+}
+
+// HarRecorder 报告格式不包含 har 时为空
+func (rg *ReportGenerator) HarRecorder() *HarRecorder {
+	return rg.har
 }
 
 // GenerateReports 生成所有格式的报告
@@ -125,6 +192,22 @@ func (rg *ReportGenerator) GenerateReports(data ReportData) error {
 			if err := rg.generateJUnitReport(data); err != nil {
 				slog.Error("Failed to generate JUnit report: %v", err)
 			}
+		case "allure":
+			if err := rg.generateAllureResults(data); err != nil {
+				slog.Error("Failed to generate Allure results: %v", err)
+			}
+		case "markdown":
+			if err := rg.generateMarkdownReport(data); err != nil {
+				slog.Error("Failed to generate Markdown report: %v", err)
+			}
+		case "tap":
+			if err := rg.generateTAPReport(data); err != nil {
+				slog.Error("Failed to generate TAP report: %v", err)
+			}
+		case "har":
+			if err := rg.generateHarReport(); err != nil {
+				slog.Error("Failed to generate HAR file: %v", err)
+			}
 		default:
 			slog.Warn("Unsupported report format: %s", format)
 		}
@@ -133,6 +216,98 @@ func (rg *ReportGenerator) GenerateReports(data ReportData) error {
 	return nil
 }
 
+// FileReportName 规则文件对应的报告文件名，即去掉扩展名的文件名
+func FileReportName(file string) string {
+	filename := filepath.Base(file)
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// CaseDetailDir 规则文件中各用例请求/响应页面所在的目录名
+func CaseDetailDir(reportDir, file string) string {
+	return MD5(reportDir + FileReportName(file))
+}
+
+// CaseDetailLink 用例请求/响应页面相对报告目录的链接
+func CaseDetailLink(reportDir, file string, id uint64) string {
+	return fmt.Sprintf("./%v/%v.html", CaseDetailDir(reportDir, file), id)
+}
+
+// htmlReport HTML报告的数据，在 ReportData 的基础上按协议和规则文件分组
+type htmlReport struct {
+	ReportData
+	Groups []htmlReportGroup
+	// 用于过滤的状态和标签
+	Statuses []string
+	Tags     []string
+}
+
+// htmlReportGroup 一个规则文件的用例
+type htmlReportGroup struct {
+	Protocol string
+	File     string
+	// 规则文件的报告页面
+	Link    string
+	Total   int
+	Passed  int
+	Failed  int
+	Skipped int
+	Cases   []htmlReportCase
+}
+
+// htmlReportCase 带请求/响应页面链接的用例
+type htmlReportCase struct {
+	TestCaseResult
+	Link string
+}
+
+// newHTMLReport 按用例出现的顺序分组，并收集用例的状态和标签
+func newHTMLReport(data ReportData, reportDir string) htmlReport {
+	report := htmlReport{ReportData: data}
+	groupIdx := make(map[string]int)
+	statuses := make(map[string]bool)
+	tags := make(map[string]bool)
+	for _, tc := range data.TestCases {
+		key := tc.Protocol + ":" + tc.File
+		idx, ok := groupIdx[key]
+		if !ok {
+			idx = len(report.Groups)
+			groupIdx[key] = idx
+			report.Groups = append(report.Groups, htmlReportGroup{
+				Protocol: tc.Protocol,
+				File:     tc.File,
+				Link:     "./" + FileReportName(tc.File) + ".html",
+			})
+		}
+		group := &report.Groups[idx]
+		group.Total++
+		switch tc.Status {
+		case StatusPassed:
+			group.Passed++
+		case StatusFailed, StatusFlaky:
+			group.Failed++
+		default:
+			group.Skipped++
+		}
+		group.Cases = append(group.Cases, htmlReportCase{
+			TestCaseResult: tc,
+			Link:           CaseDetailLink(reportDir, tc.File, tc.ID),
+		})
+
+		if !statuses[tc.Status] {
+			statuses[tc.Status] = true
+			report.Statuses = append(report.Statuses, tc.Status)
+		}
+		for _, tag := range tc.Tags {
+			tags[tag] = true
+		}
+	}
+	for tag := range tags {
+		report.Tags = append(report.Tags, tag)
+	}
+	sort.Strings(report.Tags)
+	return report
+}
+
 // generateHTMLReport 生成HTML报告
 func (rg *ReportGenerator) generateHTMLReport(data ReportData) error {
 	templatePath := rg.config.Global.Report.TemplatePath
@@ -156,7 +331,8 @@ func (rg *ReportGenerator) generateHTMLReport(data ReportData) error {
 	}
 	defer file.Close()
 
-	if err := tmpl.Execute(file, data); err != nil {
+	report := newHTMLReport(data, rg.config.Global.Report.DirPath)
+	if err := tmpl.Execute(file, report); err != nil {
 		return fmt.Errorf("failed to execute HTML template: %w", err)
 	}
 
@@ -196,7 +372,8 @@ func (rg *ReportGenerator) generateCSVReport(data ReportData) error {
 	defer writer.Flush()
 
 	// 写入标题行
-	headers := []string{"ID", "Description", "Status", "Duration", "Start Time", "End Time", "Error Message"}
+	headers := []string{"ID", "Protocol", "File", "Description", "Status", "Reason", "Duration",
+		"Start Time", "End Time", "Error Message", "Attempts", "Limiter Wait", "Runs", "Passed Runs", "Quarantined"}
 	if err := writer.Write(headers); err != nil {
 		return fmt.Errorf("failed to write CSV headers: %w", err)
 	}
@@ -205,12 +382,20 @@ func (rg *ReportGenerator) generateCSVReport(data ReportData) error {
 	for _, testCase := range data.TestCases {
 		record := []string{
 			fmt.Sprintf("%d", testCase.ID),
+			testCase.Protocol,
+			filepath.Base(testCase.File),
 			testCase.Description,
 			testCase.Status,
+			testCase.Reason,
 			testCase.Duration.String(),
 			testCase.StartTime.Format("2006-01-02 15:04:05"),
 			testCase.EndTime.Format("2006-01-02 15:04:05"),
 			testCase.ErrorMsg,
+			fmt.Sprintf("%d", max(len(testCase.Attempts), 1)),
+			testCase.LimiterWait.String(),
+			fmt.Sprintf("%d", max(testCase.Runs, 1)),
+			fmt.Sprintf("%d", testCase.PassedRuns),
+			fmt.Sprintf("%v", testCase.Quarantined),
 		}
 		if err := writer.Write(record); err != nil {
 			return fmt.Errorf("failed to write CSV record: %w", err)
@@ -228,7 +413,7 @@ func (rg *ReportGenerator) generateJUnitReport(data ReportData) error {
 		Tests:     data.Summary.TotalTests,
 		Failures:  data.Summary.FailedTests,
 		Errors:    0,
-		Skipped:   data.Summary.SkippedTests,
+		Skipped:   data.Summary.SkippedTests + data.Summary.CancelledTests,
 		Time:      data.Summary.Duration.Seconds(),
 		Timestamp: data.Summary.StartTime.Format("2006-01-02T15:04:05"),
 	}
@@ -236,20 +421,25 @@ func (rg *ReportGenerator) generateJUnitReport(data ReportData) error {
 	for _, testCase := range data.TestCases {
 		junitCase := JUnitTestCase{
 			Name:      fmt.Sprintf("TestCase_%d", testCase.ID),
-			ClassName: "autotest",
+			ClassName: junitClassName(testCase),
 			Time:      testCase.Duration.Seconds(),
 		}
 
-		switch testCase.Status {
-		case "failed":
+		switch {
+		case testCase.Quarantined && (testCase.Status == StatusFailed || testCase.Status == StatusFlaky):
+			// 已隔离的用例不让构建失败
+			junitCase.Skipped = &JUnitSkipped{
+				Message: "quarantined: " + testCase.ErrorMsg,
+			}
+		case testCase.Status == StatusFailed || testCase.Status == StatusFlaky:
 			junitCase.Failure = &JUnitFailure{
 				Message: testCase.ErrorMsg,
 				Type:    "AssertionError",
 				Content: testCase.ErrorMsg,
 			}
-		case "skipped":
+		case testCase.Status == StatusSkipped || testCase.Status == StatusCancelled:
 			junitCase.Skipped = &JUnitSkipped{
-				Message: "Test skipped",
+				Message: testCase.Reason,
 			}
 		}
 
@@ -274,15 +464,25 @@ func (rg *ReportGenerator) generateJUnitReport(data ReportData) error {
 	return nil
 }
 
+// junitClassName 使用协议和规则文件名作为classname
+func junitClassName(testCase TestCaseResult) string {
+	if len(testCase.File) <= 0 {
+		return "autotest"
+	}
+	name := strings.TrimSuffix(filepath.Base(testCase.File), filepath.Ext(testCase.File))
+	return fmt.Sprintf("autotest.%v.%v", testCase.Protocol, name)
+}
+
 // getDefaultHTMLTemplate 获取默认HTML模板路径
 func (rg *ReportGenerator) getDefaultHTMLTemplate() string {
 	return filepath.Join(rg.config.Global.Report.DirPath, "default_template.html")
 }
 
-// 默认HTML模板
+// 默认HTML模板，HTTP 和 gRPC 用例按规则文件分组，可以按状态、标签过滤以及搜索
 const defaultHTMLTemplate = `<!DOCTYPE html>
 <html>
 <head>
+    <meta charset="UTF-8">
     <title>AutoTest Report</title>
     <style>
         body { font-family: Arial, sans-serif; margin: 20px; }
@@ -290,12 +490,21 @@ const defaultHTMLTemplate = `<!DOCTYPE html>
         .pass { color: green; }
         .fail { color: red; }
         .skip { color: orange; }
+        .filters { margin-bottom: 20px; }
+        .filters select, .filters input { margin-right: 10px; padding: 4px; }
+        .group h3 { margin-bottom: 5px; }
+        .group .counts { color: #666; font-size: 0.9em; margin-bottom: 8px; }
+        .tag { background: #e7f1ff; border-radius: 3px; padding: 1px 5px; margin-right: 3px; font-size: 0.85em; }
         table { border-collapse: collapse; width: 100%; }
         th, td { border: 1px solid #ddd; padding: 8px; text-align: left; }
         th { background-color: #f2f2f2; }
-        .status-pass { background-color: #d4edda; }
-        .status-fail { background-color: #f8d7da; }
-        .status-skip { background-color: #fff3cd; }
+        a { color: #007BFF; text-decoration: none; }
+        a:hover { text-decoration: underline; }
+        .status-passed { background-color: #d4edda; }
+        .status-failed { background-color: #f8d7da; }
+        .status-skipped { background-color: #fff3cd; }
+        .status-cancelled { background-color: #e2e3e5; }
+        .status-flaky { background-color: #ffe5b4; }
     </style>
 </head>
 <body>
@@ -307,38 +516,85 @@ const defaultHTMLTemplate = `<!DOCTYPE html>
         <p><strong>Passed:</strong> <span class="pass">{{.Summary.PassedTests}}</span></p>
         <p><strong>Failed:</strong> <span class="fail">{{.Summary.FailedTests}}</span></p>
         <p><strong>Skipped:</strong> <span class="skip">{{.Summary.SkippedTests}}</span></p>
+        {{if .Summary.FlakyTests}}<p><strong>Flaky:</strong> <span class="skip">{{.Summary.FlakyTests}}</span></p>{{end}}
+        {{if .Summary.CancelledTests}}<p><strong>Cancelled:</strong> <span class="skip">{{.Summary.CancelledTests}}</span></p>{{end}}
         <p><strong>Pass Rate:</strong> {{printf "%.2f" .Summary.PassRate}}%</p>
         <p><strong>Duration:</strong> {{.Summary.Duration}}</p>
         <p><strong>Start Time:</strong> {{.Summary.StartTime.Format "2006-01-02 15:04:05"}}</p>
         <p><strong>End Time:</strong> {{.Summary.EndTime.Format "2006-01-02 15:04:05"}}</p>
     </div>
 
-    <h2>Test Cases</h2>
-    <table>
-        <thead>
-            <tr>
-                <th>ID</th>
-                <th>Description</th>
-                <th>Status</th>
-                <th>Duration</th>
-                <th>Start Time</th>
-                <th>End Time</th>
-                <th>Error Message</th>
-            </tr>
-        </thead>
-        <tbody>
-            {{range .TestCases}}
-            <tr class="status-{{.Status}}">
-                <td>{{.ID}}</td>
-                <td>{{.Description}}</td>
-                <td>{{.Status}}</td>
-                <td>{{.Duration}}</td>
-                <td>{{.StartTime.Format "2006-01-02 15:04:05"}}</td>
-                <td>{{.EndTime.Format "2006-01-02 15:04:05"}}</td>
-                <td>{{.ErrorMsg}}</td>
-            </tr>
-            {{end}}
-        </tbody>
-    </table>
+    <div class="filters">
+        <select id="filter-status">
+            <option value="">All statuses</option>
+            {{range .Statuses}}<option value="{{.}}">{{.}}</option>{{end}}
+        </select>
+        <select id="filter-tag">
+            <option value="">All tags</option>
+            {{range .Tags}}<option value="{{.}}">{{.}}</option>{{end}}
+        </select>
+        <input id="filter-search" type="search" placeholder="Search id, description, error">
+    </div>
+
+    {{range .Groups}}
+    <div class="group">
+        <h3>{{.Protocol}} · <a href="{{.Link}}">{{.File}}</a></h3>
+        <div class="counts">Total: {{.Total}}, Passed: {{.Passed}}, Failed: {{.Failed}}, Skipped: {{.Skipped}}</div>
+        <table>
+            <thead>
+                <tr>
+                    <th>ID</th>
+                    <th>Description</th>
+                    <th>Tags</th>
+                    <th>Status</th>
+                    <th>Reason</th>
+                    <th>Duration</th>
+                    <th>Attempts</th>
+                    <th>Start Time</th>
+                    <th>End Time</th>
+                    <th>Error Message</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{range .Cases}}
+                <tr class="status-{{.Status}} case" data-status="{{.Status}}" data-tags="{{range .Tags}}|{{.}}{{end}}|" data-search="{{.ID}} {{.Description}} {{.ErrorMsg}}">
+                    <td><a href="{{.Link}}">{{.ID}}</a></td>
+                    <td><a href="{{.Link}}">{{.Description}}</a></td>
+                    <td>{{range .Tags}}<span class="tag">{{.}}</span>{{end}}</td>
+                    <td>{{.Status}}{{if .Runs}} ({{.PassedRuns}}/{{.Runs}} passed){{end}}{{if .Quarantined}} [quarantined]{{end}}</td>
+                    <td>{{.Reason}}</td>
+                    <td>{{.Duration}}{{if .LimiterWait}} <span class="skip">(limiter wait {{.LimiterWait}})</span>{{end}}</td>
+                    <td>{{if .Attempts}}<span class="skip" title="{{range .Attempts}}#{{.Attempt}} {{.Duration}} {{.Error}}{{if .Delay}} wait {{.Delay}}{{end}}&#10;{{end}}">{{len .Attempts}}</span>{{else}}1{{end}}</td>
+                    <td>{{.StartTime.Format "2006-01-02 15:04:05"}}</td>
+                    <td>{{.EndTime.Format "2006-01-02 15:04:05"}}</td>
+                    <td>{{.ErrorMsg}}{{if and .Repro (eq .Status "failed" "flaky")}}<details><summary>repro</summary><pre>{{.Repro}}</pre></details>{{end}}</td>
+                </tr>
+                {{end}}
+            </tbody>
+        </table>
+    </div>
+    {{end}}
+
+    <script>
+        function applyFilters() {
+            var status = document.getElementById("filter-status").value;
+            var tag = document.getElementById("filter-tag").value;
+            var search = document.getElementById("filter-search").value.toLowerCase();
+            document.querySelectorAll(".group").forEach(function (group) {
+                var visible = 0;
+                group.querySelectorAll("tr.case").forEach(function (row) {
+                    var show = (!status || row.dataset.status === status) &&
+                        (!tag || row.dataset.tags.indexOf("|" + tag + "|") >= 0) &&
+                        (!search || row.dataset.search.toLowerCase().indexOf(search) >= 0);
+                    row.style.display = show ? "" : "none";
+                    if (show) { visible++; }
+                });
+                group.style.display = visible > 0 ? "" : "none";
+            });
+        }
+        ["filter-status", "filter-tag", "filter-search"].forEach(function (id) {
+            document.getElementById(id).addEventListener("input", applyFilters);
+        });
+    </script>
 </body>
 </html>`
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+)
+
+func TestGenerateHTMLReportGroups(t *testing.T) {
+	var cfg config.AutoTestConfig
+	cfg.Global.Report.DirPath = t.TempDir()
+
+	var data ReportData
+	data.Summary.TotalTests = 3
+	data.TestCases = []TestCaseResult{
+		{ID: 1, Description: "get book", Protocol: "http", File: "/rules/book.yml", Status: StatusPassed, Tags: []string{"smoke"}},
+		{ID: 2, Description: "add <book>", Protocol: "http", File: "/rules/book.yml", Status: StatusFailed,
+			Tags: []string{"smoke", "write"}, ErrorMsg: "status code 500", Repro: "curl \\\n  -X POST \\\n  http://localhost/books"},
+		{ID: 1, Description: "say hello", Protocol: "grpc", File: "/rules/hello.yml", Status: StatusSkipped,
+			Repro: "grpcurl -plaintext \\\n  localhost:50031 Greeter/SayHello"},
+	}
+	assert.NoError(t, NewReportGenerator(cfg).GenerateReports(data))
+
+	b, err := os.ReadFile(filepath.Join(cfg.Global.Report.DirPath, "report.html"))
+	assert.NoError(t, err)
+	html := string(b)
+	// grouped by protocol and rule file, linked to the page of the file
+	assert.Contains(t, html, `<h3>http · <a href="./book.html">/rules/book.yml</a></h3>`)
+	assert.Contains(t, html, `<h3>grpc · <a href="./hello.html">/rules/hello.yml</a></h3>`)
+	assert.Contains(t, html, "Total: 2, Passed: 1, Failed: 1, Skipped: 0")
+	assert.Less(t, strings.Index(html, "book.html"), strings.Index(html, "hello.html"))
+	// filters
+	assert.Contains(t, html, `<option value="failed">failed</option>`)
+	assert.Contains(t, html, `<option value="smoke">smoke</option><option value="write">write</option>`)
+	assert.Contains(t, html, `data-status="failed" data-tags="|smoke|write|" data-search="2 add &lt;book&gt; status code 500"`)
+	// the failures carry the command to reproduce the request
+	assert.Contains(t, html, "<td>status code 500<details><summary>repro</summary><pre>curl \\\n  -X POST \\\n  http://localhost/books</pre></details></td>")
+	assert.NotContains(t, html, "grpcurl")
+	// linked to the request/response page
+	link := CaseDetailLink(cfg.Global.Report.DirPath, "/rules/hello.yml", 1)
+	assert.Equal(t, "./"+MD5(cfg.Global.Report.DirPath+"hello")+"/1.html", link)
+	assert.Contains(t, html, `<a href="`+link+`">say hello</a>`)
+}
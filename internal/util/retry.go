@@ -2,12 +2,19 @@ package util
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/vearne/autotest/internal/config"
 	slog "github.com/vearne/simplelog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -97,108 +104,342 @@ func IsRetryableStatusCode(statusCode int, retryCodes []int) bool {
 	return false
 }
 
-// ExecuteHttpWithRetry 执行HTTP请求并支持重试
-func ExecuteHttpWithRetry(ctx context.Context, cfg config.AutoTestConfig, operation func() error) error {
-	maxAttempts := cfg.Global.Retry.MaxAttempts
-	if maxAttempts <= 0 {
-		maxAttempts = 3 // 默认最多重试3次
+// 重试间隔的退避策略
+const (
+	BackoffFixed       = "fixed"
+	BackoffLinear      = "linear"
+	BackoffExponential = "exponential"
+)
+
+// 重试间隔的随机抖动，避免大量用例同时重试
+const (
+	JitterNone = "none"
+	// 在 [0, delay] 内随机
+	JitterFull = "full"
+	// 在 [delay/2, delay] 内随机
+	JitterEqual = "equal"
+)
+
+// RetryPolicy 重试策略，由全局配置、规则文件和用例的配置依次合并而来
+type RetryPolicy struct {
+	MaxAttempts int
+	Delay       time.Duration
+	Backoff     string
+	Jitter      string
+	// 退避后的最大重试间隔，0 表示不限制
+	MaxDelay time.Duration
+	// 需要重试的HTTP状态码，为空时不按状态码重试
+	StatusCodes []int
+	// 需要重试的gRPC状态码，为空时不按响应的状态码重试
+	GrpcCodes []codes.Code
+}
+
+// NewRetryPolicy 根据全局配置创建重试策略
+func NewRetryPolicy(cfg config.AutoTestConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: cfg.Global.Retry.MaxAttempts,
+		Delay:       cfg.Global.Retry.RetryDelay,
+		Backoff:     cfg.Global.Retry.Backoff,
+		Jitter:      cfg.Global.Retry.Jitter,
+		MaxDelay:    cfg.Global.Retry.MaxDelay,
+		StatusCodes: cfg.Global.Retry.RetryOnStatusCodes,
+		GrpcCodes:   parseGrpcCodes(cfg.Global.Retry.RetryOnGrpcCodes),
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3 // 默认最多重试3次
+	}
+	if policy.Delay <= 0 {
+		policy.Delay = time.Second // 默认重试间隔1秒
 	}
+	return policy
+}
 
-	retryDelay := cfg.Global.Retry.RetryDelay
-	if retryDelay <= 0 {
-		retryDelay = time.Second // 默认重试间隔1秒
+// Merge 使用规则文件或用例的重试配置覆盖当前策略，未设置的字段保持不变
+func (p RetryPolicy) Merge(retry *config.Retry) RetryPolicy {
+	if retry == nil {
+		return p
+	}
+	if retry.MaxAttempts > 0 {
+		p.MaxAttempts = retry.MaxAttempts
 	}
+	if retry.Delay > 0 {
+		p.Delay = retry.Delay
+	}
+	if len(retry.Backoff) > 0 {
+		p.Backoff = retry.Backoff
+	}
+	if len(retry.Jitter) > 0 {
+		p.Jitter = retry.Jitter
+	}
+	if retry.MaxDelay > 0 {
+		p.MaxDelay = retry.MaxDelay
+	}
+	if len(retry.StatusCodes) > 0 {
+		p.StatusCodes = retry.StatusCodes
+	}
+	if len(retry.GrpcCodes) > 0 {
+		p.GrpcCodes = parseGrpcCodes(retry.GrpcCodes)
+	}
+	return p
+}
 
-	retryStatusCodes := make(map[int]bool)
-	if len(cfg.Global.Retry.RetryOnStatusCodes) == 0 {
-		// 默认重试的状态码
-		defaultRetryCodes := []int{500, 502, 503, 504, 408, 429}
-		for _, code := range defaultRetryCodes {
-			retryStatusCodes[code] = true
+// NextDelay 第 attempt 次尝试失败后的等待时间，先按退避策略计算，再限制上限，最后加上随机抖动
+func (p RetryPolicy) NextDelay(attempt int) time.Duration {
+	delay := p.Delay
+	switch p.Backoff {
+	case BackoffLinear:
+		delay = p.Delay * time.Duration(attempt)
+	case BackoffExponential:
+		delay = p.Delay << min(attempt-1, 30)
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	switch p.Jitter {
+	case JitterFull:
+		return rand.N(delay + 1)
+	case JitterEqual:
+		return delay/2 + rand.N(delay-delay/2+1)
+	default:
+		return delay
+	}
+}
+
+// waitDelay 服务端给出了重试间隔（Retry-After 或 RetryInfo）时优先使用，否则按重试策略计算
+func (p RetryPolicy) waitDelay(attempt int, err error) (time.Duration, bool) {
+	var statusErr *RetryableStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter, true
+	}
+	if st, ok := status.FromError(err); ok {
+		if delay := GrpcRetryDelay(st); delay > 0 {
+			return delay, true
+		}
+	}
+	return p.NextDelay(attempt), false
+}
+
+// RetryOnStatus 检查HTTP状态码是否需要重试
+func (p RetryPolicy) RetryOnStatus(statusCode int) bool {
+	return slices.Contains(p.StatusCodes, statusCode)
+}
+
+// RetryOnGrpcCode 检查gRPC响应的状态码是否需要重试
+func (p RetryPolicy) RetryOnGrpcCode(code codes.Code) bool {
+	return slices.Contains(p.GrpcCodes, code)
+}
+
+// RetryableStatusError 响应的状态码需要重试，重试次数用尽时保留最后一次的响应，由用例的规则做判断
+type RetryableStatusError struct {
+	Status string
+	// 服务端建议的重试间隔，0 表示没有给出
+	RetryAfter time.Duration
+}
+
+func (e *RetryableStatusError) Error() string {
+	return fmt.Sprintf("retryable status:%v", e.Status)
+}
+
+// RetryAttempt 一次请求尝试的记录，用于在报告中展示不稳定的用例
+type RetryAttempt struct {
+	Attempt  int           `json:"attempt"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// 下一次尝试之前的等待时间
+	Delay time.Duration `json:"delay,omitempty"`
+	// 等待时间来自服务端的 Retry-After 或 RetryInfo
+	ServerHint bool `json:"server_hint,omitempty"`
+}
+
+// ParseRetryAfter 解析HTTP的 Retry-After 头，支持秒数和HTTP日期两种格式
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) <= 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// GrpcRetryDelay 读取gRPC状态中 google.rpc.RetryInfo 给出的重试间隔
+func GrpcRetryDelay(st *status.Status) time.Duration {
+	if st == nil {
+		return 0
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return max(info.GetRetryDelay().AsDuration(), 0)
 		}
-	} else {
-		for _, code := range cfg.Global.Retry.RetryOnStatusCodes {
-			retryStatusCodes[code] = true
+	}
+	return 0
+}
+
+// ValidateJitter 检查随机抖动是否合法
+func ValidateJitter(jitter string) error {
+	switch jitter {
+	case "", JitterNone, JitterFull, JitterEqual:
+		return nil
+	}
+	return fmt.Errorf("unknown jitter:%v, none | full | equal", jitter)
+}
+
+// ValidateBackoff 检查退避策略是否合法
+func ValidateBackoff(backoff string) error {
+	switch backoff {
+	case "", BackoffFixed, BackoffLinear, BackoffExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown backoff:%v, fixed | linear | exponential", backoff)
+}
+
+// ParseGrpcCode 解析gRPC状态码，支持 Unavailable、UNAVAILABLE、DEADLINE_EXCEEDED 等写法
+func ParseGrpcCode(name string) (codes.Code, error) {
+	normalized := strings.ReplaceAll(name, "_", "")
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if strings.EqualFold(code.String(), normalized) {
+			return code, nil
 		}
 	}
+	return codes.Unknown, fmt.Errorf("unknown gRPC code:%v", name)
+}
 
+// parseGrpcCodes 忽略无法解析的状态码，它们在校验配置时已经报错
+func parseGrpcCodes(names []string) []codes.Code {
+	var result []codes.Code
+	for _, name := range names {
+		code, err := ParseGrpcCode(name)
+		if err == nil {
+			result = append(result, code)
+		}
+	}
+	return result
+}
+
+// ExecuteHttpWithRetry 执行HTTP请求并支持重试，返回每一次尝试的记录
+func ExecuteHttpWithRetry(ctx context.Context, policy RetryPolicy, operation func() error) ([]RetryAttempt, error) {
 	var lastErr error
+	var attempts []RetryAttempt
+	maxAttempts := max(policy.MaxAttempts, 1)
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		slog.Debug("HTTP request attempt %d/%d", attempt, maxAttempts)
 
+		begin := time.Now()
 		lastErr = operation()
+		attempts = append(attempts, newRetryAttempt(attempt, time.Since(begin), lastErr))
 
 		if lastErr == nil {
 			slog.Debug("HTTP request succeeded on attempt %d", attempt)
-			return nil
+			return attempts, nil
+		}
+		// 超时或者运行被取消，重试没有意义
+		if ctx.Err() != nil {
+			return attempts, lastResponse(lastErr)
 		}
-
-		// TODO: 这里需要检查具体的 HTTP 状态码，但当前架构下比较困难
-		// 先简单地重试所有错误，后续可以优化
 
 		slog.Info("HTTP request failed (retryable), attempt %d/%d: %v", attempt, maxAttempts, lastErr)
 
 		// 如果不是最后一次尝试，等待重试间隔
 		if attempt < maxAttempts {
-			slog.Debug("Waiting %v before HTTP retry", retryDelay)
-			select {
-			case <-time.After(retryDelay):
-				// 继续重试
-			case <-ctx.Done():
-				return ctx.Err()
+			if err := waitRetry(ctx, policy, attempts, lastErr); err != nil {
+				return attempts, err
 			}
 		}
 	}
 
-	return fmt.Errorf("HTTP request failed after %d attempts: %w", maxAttempts, lastErr)
-}
-
-// ExecuteGrpcWithRetry 执行gRPC请求并支持重试
-func ExecuteGrpcWithRetry(ctx context.Context, cfg config.AutoTestConfig, operation func() error) error {
-	maxAttempts := cfg.Global.Retry.MaxAttempts
-	if maxAttempts <= 0 {
-		maxAttempts = 3 // 默认最多重试3次
-	}
-
-	retryDelay := cfg.Global.Retry.RetryDelay
-	if retryDelay <= 0 {
-		retryDelay = time.Second // 默认重试间隔1秒
+	if isRetryableStatus(lastErr) {
+		return attempts, nil
 	}
+	return attempts, fmt.Errorf("HTTP request failed after %d attempts: %w", maxAttempts, lastErr)
+}
 
+// ExecuteGrpcWithRetry 执行gRPC请求并支持重试，返回每一次尝试的记录
+func ExecuteGrpcWithRetry(ctx context.Context, policy RetryPolicy, operation func() error) ([]RetryAttempt, error) {
 	var lastErr error
+	var attempts []RetryAttempt
+	maxAttempts := max(policy.MaxAttempts, 1)
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		slog.Debug("gRPC request attempt %d/%d", attempt, maxAttempts)
 
+		begin := time.Now()
 		lastErr = operation()
+		attempts = append(attempts, newRetryAttempt(attempt, time.Since(begin), lastErr))
 
 		if lastErr == nil {
 			slog.Debug("gRPC request succeeded on attempt %d", attempt)
-			return nil
+			return attempts, nil
 		}
 
 		// 检查是否为可重试的 gRPC 错误
 		if !isRetryableGrpcError(lastErr) {
 			slog.Info("gRPC error not retryable: %v", lastErr)
-			return lastErr
+			return attempts, lastErr
+		}
+		// 超时或者运行被取消，重试没有意义
+		if ctx.Err() != nil {
+			return attempts, lastResponse(lastErr)
 		}
 
 		slog.Info("gRPC request failed (retryable), attempt %d/%d: %v", attempt, maxAttempts, lastErr)
 
 		// 如果不是最后一次尝试，等待重试间隔
 		if attempt < maxAttempts {
-			slog.Debug("Waiting %v before gRPC retry", retryDelay)
-			select {
-			case <-time.After(retryDelay):
-				// 继续重试
-			case <-ctx.Done():
-				return ctx.Err()
+			if err := waitRetry(ctx, policy, attempts, lastErr); err != nil {
+				return attempts, err
 			}
 		}
 	}
 
-	return fmt.Errorf("gRPC request failed after %d attempts: %w", maxAttempts, lastErr)
+	if isRetryableStatus(lastErr) {
+		return attempts, nil
+	}
+	return attempts, fmt.Errorf("gRPC request failed after %d attempts: %w", maxAttempts, lastErr)
+}
+
+func newRetryAttempt(attempt int, duration time.Duration, err error) RetryAttempt {
+	result := RetryAttempt{Attempt: attempt, Duration: duration}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// waitRetry 等待下一次重试，并把等待时间记录到最后一次尝试上
+func waitRetry(ctx context.Context, policy RetryPolicy, attempts []RetryAttempt, lastErr error) error {
+	last := &attempts[len(attempts)-1]
+	last.Delay, last.ServerHint = policy.waitDelay(last.Attempt, lastErr)
+	slog.Debug("Waiting %v before retry, server hint:%v", last.Delay, last.ServerHint)
+	select {
+	case <-time.After(last.Delay):
+		// 继续重试
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isRetryableStatus 请求本身成功，只是响应的状态码需要重试
+func isRetryableStatus(err error) bool {
+	var statusErr *RetryableStatusError
+	return errors.As(err, &statusErr)
+}
+
+// lastResponse 不再重试时，状态码需要重试的响应仍然作为结果交给用例的规则判断
+func lastResponse(err error) error {
+	if isRetryableStatus(err) {
+		return nil
+	}
+	return err
 }
 
 // isRetryableGrpcError 检查gRPC错误是否可重试
@@ -207,6 +448,10 @@ func isRetryableGrpcError(err error) bool {
 		return false
 	}
 
+	if isRetryableStatus(err) {
+		return true
+	}
+
 	// 检查是否为gRPC状态错误
 	if st, ok := status.FromError(err); ok {
 		switch st.Code() {
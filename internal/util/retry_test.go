@@ -0,0 +1,51 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestRetryPolicyNextDelay(t *testing.T) {
+	policy := RetryPolicy{Delay: 100 * time.Millisecond, Backoff: BackoffExponential}
+	assert.Equal(t, 100*time.Millisecond, policy.NextDelay(1))
+	assert.Equal(t, 400*time.Millisecond, policy.NextDelay(3))
+
+	policy.MaxDelay = 300 * time.Millisecond
+	assert.Equal(t, 300*time.Millisecond, policy.NextDelay(3))
+
+	policy.Backoff = BackoffLinear
+	assert.Equal(t, 200*time.Millisecond, policy.NextDelay(2))
+
+	for i := 0; i < 100; i++ {
+		policy.Jitter = JitterFull
+		delay := policy.NextDelay(3)
+		assert.True(t, delay >= 0 && delay <= 300*time.Millisecond)
+
+		policy.Jitter = JitterEqual
+		delay = policy.NextDelay(3)
+		assert.True(t, delay >= 150*time.Millisecond && delay <= 300*time.Millisecond)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 10, 17, 9, 5, 5, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, ParseRetryAfter("3", now))
+	assert.Equal(t, 10*time.Second, ParseRetryAfter("Thu, 17 Oct 2024 09:05:15 GMT", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("Thu, 17 Oct 2024 09:05:00 GMT", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("", now))
+}
+
+func TestGrpcRetryDelay(t *testing.T) {
+	st, err := status.New(codes.ResourceExhausted, "slow down").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(2 * time.Second)})
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, GrpcRetryDelay(st))
+	assert.Equal(t, time.Duration(0), GrpcRetryDelay(status.New(codes.Unavailable, "down")))
+}
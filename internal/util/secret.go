@@ -0,0 +1,174 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SecretMask 替换敏感变量值的字符串
+const SecretMask = "******"
+
+// SecretMinLength 短于此长度的值不隐藏，以免把报告中的常见字符都替换掉
+const SecretMinLength = 3
+
+// SecretMasker 隐藏日志和报告中的敏感变量值，并发安全，nil 表示没有敏感变量
+type SecretMasker struct {
+	mu       sync.RWMutex
+	names    map[string]bool
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// NewSecretMasker 创建 SecretMasker，names 为敏感变量的名称
+func NewSecretMasker(names []string) *SecretMasker {
+	m := &SecretMasker{names: make(map[string]bool), values: make(map[string]bool)}
+	for _, name := range names {
+		m.names[name] = true
+	}
+	return m
+}
+
+// IsSecret 变量是否为敏感变量
+func (m *SecretMasker) IsSecret(name string) bool {
+	if m == nil {
+		return false
+	}
+	return m.names[name]
+}
+
+// Add 添加需要隐藏的值，同时隐藏它在 JSON（转义和不转义 HTML 字符）和 HTML 中转义后的形式
+func (m *SecretMasker) Add(value string) {
+	if m == nil || len(value) < SecretMinLength {
+		return
+	}
+	variants := []string{value, html.EscapeString(value)}
+	for _, escapeHTML := range []bool{true, false} {
+		var b bytes.Buffer
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(escapeHTML)
+		if err := encoder.Encode(value); err == nil {
+			// 去掉引号和换行
+			encoded := strings.TrimSpace(b.String())
+			variants = append(variants, encoded[1:len(encoded)-1])
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range variants {
+		m.values[v] = true
+	}
+	// 较长的值优先替换，以免一个值是另一个值的一部分时只隐藏了一部分
+	all := make([]string, 0, len(m.values))
+	for v := range m.values {
+		all = append(all, v)
+	}
+	slices.SortFunc(all, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	oldnew := make([]string, 0, len(all)*2)
+	for _, v := range all {
+		oldnew = append(oldnew, v, SecretMask)
+	}
+	m.replacer = strings.NewReplacer(oldnew...)
+}
+
+// Track 变量是敏感变量时隐藏它的值，对象和数组隐藏其中的每个值
+func (m *SecretMasker) Track(name string, value any) {
+	if m.IsSecret(name) {
+		m.addValue(value)
+	}
+}
+
+// addValue 隐藏 value，对象和数组逐个隐藏其中的值
+func (m *SecretMasker) addValue(value any) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]any:
+		for _, item := range v {
+			m.addValue(item)
+		}
+	case []any:
+		for _, item := range v {
+			m.addValue(item)
+		}
+	default:
+		m.Add(fmt.Sprint(v))
+	}
+}
+
+// Enabled 是否有需要隐藏的值
+func (m *SecretMasker) Enabled() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.replacer != nil
+}
+
+// Mask 把 s 中的敏感变量值替换为 SecretMask
+func (m *SecretMasker) Mask(s string) string {
+	if m == nil {
+		return s
+	}
+	m.mu.RLock()
+	replacer := m.replacer
+	m.mu.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// MaskStrings 隐藏每个字符串中的敏感变量值
+func (m *SecretMasker) MaskStrings(list []string) []string {
+	if !m.Enabled() || len(list) <= 0 {
+		return list
+	}
+	result := make([]string, 0, len(list))
+	for _, s := range list {
+		result = append(result, m.Mask(s))
+	}
+	return result
+}
+
+// MaskTestCaseResult 隐藏用例结果中的敏感变量值
+func (m *SecretMasker) MaskTestCaseResult(tc TestCaseResult) TestCaseResult {
+	if !m.Enabled() {
+		return tc
+	}
+	tc.Description = m.Mask(tc.Description)
+	tc.ErrorMsg = m.Mask(tc.ErrorMsg)
+	tc.RequestDetail = m.Mask(tc.RequestDetail)
+	tc.ResponseDetail = m.Mask(tc.ResponseDetail)
+	tc.Repro = m.Mask(tc.Repro)
+	if tc.Mismatch != nil {
+		mismatch := *tc.Mismatch
+		mismatch.Expression = m.Mask(mismatch.Expression)
+		mismatch.Expected = m.Mask(mismatch.Expected)
+		mismatch.Actual = m.Mask(mismatch.Actual)
+		tc.Mismatch = &mismatch
+	}
+	if len(tc.Steps) > 0 {
+		tc.Steps = slices.Clone(tc.Steps)
+		for i := range tc.Steps {
+			tc.Steps[i].Error = m.Mask(tc.Steps[i].Error)
+		}
+	}
+	if len(tc.Attempts) > 0 {
+		tc.Attempts = slices.Clone(tc.Attempts)
+		for i := range tc.Attempts {
+			tc.Attempts[i].Error = m.Mask(tc.Attempts[i].Error)
+		}
+	}
+	return tc
+}
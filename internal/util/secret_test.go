@@ -0,0 +1,24 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretMasker(t *testing.T) {
+	var masker *SecretMasker
+	assert.Equal(t, "token abc", masker.Mask("token abc"))
+	assert.False(t, masker.Enabled())
+
+	masker = NewSecretMasker([]string{"TOKEN"})
+	masker.Track("HOST", "localhost")
+	masker.Track("TOKEN", "ab")
+	assert.False(t, masker.Enabled(), "short values are not masked")
+	masker.Track("TOKEN", "abc")
+	masker.Add(`abc"<def`)
+	assert.Equal(t, "Bearer ****** localhost", masker.Mask("Bearer abc localhost"))
+	// the longer value wins, the escaped forms are masked too
+	assert.Equal(t, `******, ******, ******`, masker.Mask(`abc"<def, abc\"<def, abc&#34;&lt;def`))
+	assert.Equal(t, []string{"******1"}, masker.MaskStrings([]string{"abc1"}))
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	slog "github.com/vearne/simplelog"
+	"gopkg.in/yaml.v3"
+)
+
+// tapDiagnostic 失败用例的 YAML 诊断信息
+type tapDiagnostic struct {
+	Message    string `yaml:"message,omitempty"`
+	Severity   string `yaml:"severity"`
+	Protocol   string `yaml:"protocol"`
+	File       string `yaml:"file"`
+	Line       int    `yaml:"line,omitempty"`
+	Status     string `yaml:"status"`
+	Reason     string `yaml:"reason,omitempty"`
+	DurationMS int64  `yaml:"duration_ms"`
+	Runs       int    `yaml:"runs,omitempty"`
+	PassedRuns int    `yaml:"passed_runs,omitempty"`
+	Rule       string `yaml:"rule,omitempty"`
+	Expression string `yaml:"expression,omitempty"`
+	Wanted     string `yaml:"wanted,omitempty"`
+	Found      string `yaml:"found,omitempty"`
+}
+
+// generateTAPReport 生成 TAP version 13 报告
+func (rg *ReportGenerator) generateTAPReport(data ReportData) error {
+	filePath := filepath.Join(rg.config.Global.Report.DirPath, "report.tap")
+	content, err := tapReport(data)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write TAP report: %w", err)
+	}
+
+	slog.Info("TAP report generated: %s", filePath)
+	return nil
+}
+
+// tapReport 每个用例一行，跳过和取消的用例为 SKIP，隔离的用例为 TODO，失败的用例附带 YAML 诊断信息
+func tapReport(data ReportData) (string, error) {
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(data.TestCases))
+	for idx, tc := range data.TestCases {
+		// # 在描述中表示指令的开始
+		title := strings.ReplaceAll(CaseTitle(tc), "#", "\\#")
+		switch tc.Status {
+		case StatusPassed:
+			fmt.Fprintf(&b, "ok %d - %v\n", idx+1, title)
+			continue
+		case StatusSkipped, StatusCancelled:
+			fmt.Fprintf(&b, "ok %d - %v # SKIP %v\n", idx+1, title, tc.Reason)
+			continue
+		}
+
+		fmt.Fprintf(&b, "not ok %d - %v", idx+1, title)
+		if tc.Quarantined {
+			b.WriteString(" # TODO quarantined")
+		}
+		b.WriteString("\n")
+
+		diagnostic := tapDiagnostic{
+			Message:    tc.ErrorMsg,
+			Severity:   "fail",
+			Protocol:   tc.Protocol,
+			File:       tc.File,
+			Line:       tc.Line,
+			Status:     tc.Status,
+			Reason:     tc.Reason,
+			DurationMS: tc.Duration.Milliseconds(),
+			Runs:       tc.Runs,
+			PassedRuns: tc.PassedRuns,
+		}
+		if tc.Mismatch != nil {
+			diagnostic.Rule = tc.Mismatch.Rule
+			diagnostic.Expression = tc.Mismatch.Expression
+			diagnostic.Wanted = tc.Mismatch.Expected
+			diagnostic.Found = tc.Mismatch.Actual
+		}
+		content, err := yaml.Marshal(diagnostic)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal TAP diagnostic: %w", err)
+		}
+		b.WriteString("  ---\n")
+		for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+		b.WriteString("  ...\n")
+	}
+	return b.String(), nil
+}
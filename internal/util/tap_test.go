@@ -0,0 +1,41 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vearne/autotest/internal/config"
+)
+
+func TestGenerateTAPReport(t *testing.T) {
+	var cfg config.AutoTestConfig
+	cfg.Global.Report.DirPath = t.TempDir()
+	cfg.Global.Report.Formats = []string{"tap"}
+	assert.NoError(t, NewReportGenerator(cfg).GenerateReports(newTextReportData()))
+
+	b, err := os.ReadFile(filepath.Join(cfg.Global.Report.DirPath, "report.tap"))
+	assert.NoError(t, err)
+	lines := strings.Split(string(b), "\n")
+	assert.Equal(t, []string{"TAP version 13", "1..4", "ok 1 - HTTP_1: get book", "not ok 2 - HTTP_2: add book \\#2",
+		"  ---",
+		"  message: ReasonRuleVerifyFailed",
+		"  severity: fail",
+		"  protocol: http",
+		"  file: /rules/book.yml",
+		"  line: 12",
+		"  status: failed",
+		"  reason: ReasonRuleVerifyFailed",
+		"  duration_ms: 15",
+		"  rule: HttpBodyEqualRule",
+		"  expression: 'jsonpath: $.title'",
+		"  wanted: Go",
+		"  found: Rust | C",
+		"  ...",
+		"ok 3 - GRPC_1: say hello # SKIP ReasonSkipConditionMet",
+		"not ok 4 - GRPC_2: list # TODO quarantined",
+	}, lines[:20])
+	assert.Contains(t, string(b), "  runs: 2\n  passed_runs: 1\n  ...\n")
+}
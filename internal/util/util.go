@@ -1,11 +1,15 @@
 package util
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/flosch/pongo2/v6"
 	slog "github.com/vearne/simplelog"
 )
 
@@ -30,3 +34,24 @@ func WriterCSV(path string, records [][]string) {
 func MD5(data string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(data)))
 }
+
+// PrettyJSON 格式化 JSON 字符串，不是合法 JSON 时原样返回
+func PrettyJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(strings.TrimSpace(s)), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// FilterJSON pongo2 过滤器 json，把变量序列化为 JSON，例如 {{ BOOK_IDS|json }}
+func FilterJSON(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(in.Interface()); err != nil {
+		return nil, &pongo2.Error{Sender: "filter:json", OrigError: err}
+	}
+	// 不需要 HTML 转义
+	return pongo2.AsSafeValue(strings.TrimSuffix(b.String(), "\n")), nil
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	"github.com/vearne/autotest/internal/command"
@@ -39,26 +42,122 @@ func main() {
 			},
 			{
 				Name: "run",
+				// the slice flags are repeated, the values of --var may contain commas
+				DisableSliceFlagSeparator: true,
 				Flags: []cli.Flag{
 					&cli.StringFlag{Name: "config-file", Aliases: []string{"c"}, Usage: "path to configuration file"},
 					&cli.StringFlag{Name: "environment", Aliases: []string{"env"}, Usage: "specify environment (dev/staging/prod) - loads variables from config"},
+					&cli.StringSliceFlag{Name: "var", Usage: "set a variable, KEY=VALUE, overrides the environment and the secrets"},
+					&cli.IntFlag{Name: "max-failures", Value: 0, Usage: "the run fails only if more testcases failed"},
+					&cli.StringFlag{Name: "annotations", Usage: "annotate failed testcases for CI: github | gitlab"},
+					&cli.BoolFlag{Name: "shuffle", Usage: "randomise the order of rule files and testcases"},
+					&cli.Int64Flag{Name: "seed", Usage: "the seed of --shuffle, a random seed is used if it is 0"},
+					&cli.IntFlag{Name: "repeat", Usage: "run each testcase N times, the testcases which pass only sometimes are flaky"},
+					&cli.StringFlag{Name: "quarantine", Usage: "file of known flaky testcases (<rule file>:<id> per line), they don't fail the run"},
 				},
 				Usage:  "run all test cases",
 				Action: command.RunTestCases,
 			},
+			{
+				Name:                      "bench",
+				DisableSliceFlagSeparator: true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config-file", Aliases: []string{"c"}, Usage: "path to configuration file"},
+					&cli.StringFlag{Name: "environment", Aliases: []string{"env"}, Usage: "specify environment (dev/staging/prod) - loads variables from config"},
+					&cli.StringSliceFlag{Name: "var", Usage: "set a variable, KEY=VALUE, overrides the environment and the secrets"},
+					&cli.StringSliceFlag{Name: "file", Aliases: []string{"f"}, Usage: "rule files to bench, path or file name, all if not set"},
+					&cli.IntSliceFlag{Name: "id", Usage: "IDs of the testcases to bench, all if not set"},
+					&cli.DurationFlag{Name: "duration", Aliases: []string{"d"}, Value: 30 * time.Second, Usage: "how long the bench runs"},
+					&cli.IntFlag{Name: "rps", Value: 0, Usage: "target requests per second of all the testcases, unlimited if 0"},
+					&cli.IntFlag{Name: "concurrency", Value: 10, Usage: "max in-flight requests"},
+					&cli.Float64Flag{Name: "max-error-rate", Value: 1, Usage: "exit with code 1 if the error rate (0-1) is higher"},
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "path of the JSON result, bench.json in the report directory by default"},
+				},
+				Usage:  "load test the existing testcases at a target RPS or concurrency",
+				Action: command.RunBench,
+			},
+			{
+				Name:                      "repro",
+				DisableSliceFlagSeparator: true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config-file", Aliases: []string{"c"}, Usage: "path to configuration file"},
+					&cli.StringFlag{Name: "environment", Aliases: []string{"env"}, Usage: "specify environment (dev/staging/prod) - loads variables from config"},
+					&cli.StringSliceFlag{Name: "var", Usage: "set a variable, KEY=VALUE, overrides the environment and the secrets"},
+					&cli.StringFlag{Name: "file", Aliases: []string{"f"}, Required: true, Usage: "rule file of the testcase, path or file name"},
+					&cli.IntFlag{Name: "id", Required: true, Usage: "ID of the testcase, as written in the rule file"},
+					&cli.BoolFlag{Name: "show-secrets", Usage: "print the values of the secrets instead of masking them"},
+				},
+				Usage:  "print the curl or grpcurl command of a testcase",
+				Action: command.PrintRepro,
+			},
+			{
+				Name:  "env",
+				Usage: "inspect the environments",
+				Commands: []*cli.Command{
+					{
+						Name:                      "show",
+						DisableSliceFlagSeparator: true,
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "config-file", Aliases: []string{"c"}, Usage: "path to configuration file"},
+							&cli.StringFlag{Name: "environment", Aliases: []string{"env"}, Usage: "specify environment (dev/staging/prod) - loads variables from config"},
+							&cli.StringSliceFlag{Name: "var", Usage: "set a variable, KEY=VALUE, overrides the environment and the secrets"},
+						},
+						Usage:  "print the resolved variables and where they come from, the values of the secrets are masked",
+						Action: command.ShowEnv,
+					},
+				},
+			},
+			{
+				Name: "history",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config-file", Aliases: []string{"c"}, Usage: "path to configuration file, its report.dir_path holds the history"},
+					&cli.StringFlag{Name: "dir", Usage: "directory of history.jsonl, replaces --config-file"},
+					&cli.IntFlag{Name: "last", Value: command.HistoryTrendRuns, Usage: "number of recent runs, all if 0"},
+					&cli.IntSliceFlag{Name: "id", Usage: "IDs of the testcases to show, all if not set"},
+					&cli.BoolFlag{Name: "failing", Usage: "only show the testcases failing in the latest runs"},
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "write the HTML trend page to this path"},
+				},
+				Usage:  "show the pass rate, latency trend and first failure of the testcases across runs",
+				Action: command.ShowHistory,
+			},
+			{
+				Name:      "diff",
+				ArgsUsage: "<runA> <runB>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "format", Value: command.DiffFormatConsole, Usage: "output format: console | markdown | json"},
+					&cli.Float64Flag{Name: "latency-threshold", Value: 0.2, Usage: "a passed testcase regressed if it is slower by this ratio (0.2 for 20%)"},
+					&cli.DurationFlag{Name: "min-latency-delta", Value: 10 * time.Millisecond, Usage: "ignore latency changes smaller than this"},
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "write the result to this file instead of stdout"},
+				},
+				Usage:  "compare the JSON reports of two runs, runA is the baseline",
+				Action: command.DiffRuns,
+			},
 			{
 				Name: "extract",
 				Flags: []cli.Flag{
 					&cli.StringFlag{Name: "xpath", Aliases: []string{"x"}},
+					&cli.StringFlag{Name: "jsonpath", Usage: "JSONPath expression, replaces --xpath"},
+					&cli.StringFlag{Name: "jmespath", Usage: "JMESPath expression, replaces --xpath"},
 					&cli.StringFlag{Name: "json", Aliases: []string{"j"}},
+					&cli.StringFlag{Name: "body", Aliases: []string{"b"}, Usage: "response body, replaces --json for non-JSON bodies"},
+					&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Usage: "body format: json | xml | html | text"},
 				},
-				Usage:  "try to extract data corresponding to xpath from json string",
+				Usage:  "try to extract data corresponding to xpath/jsonpath/jmespath from json/xml/html string",
 				Action: command.ExtractXpath,
 			},
 		},
 	}
 
-	if err := cmd.Run(context.Background(), os.Args); err != nil {
+	// SIGINT/SIGTERM cancels the run, the reports of the finished testcases are still generated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// a second signal terminates the process immediately
+		stop()
+	}()
+
+	if err := cmd.Run(ctx, os.Args); err != nil {
 		log.Fatal(err)
 	}
 }